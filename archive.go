@@ -0,0 +1,139 @@
+package mgrt
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"strings"
+)
+
+// LoadRevisionsArchive loads the revisions from the archive at the given path
+// into a Collection. The archive can be a .tar.gz, .tgz, .tar, or .zip file.
+// Each .sql file in the archive is unmarshalled via UnmarshalRevision, any
+// other file is ignored.
+//
+// An invalid revision does not stop the others from being loaded. Instead, the
+// returned Errors will contain a *RevisionError for each, with a Path in the
+// form of archive:member, and the Collection will contain the revisions that
+// were valid.
+func LoadRevisionsArchive(path string) (*Collection, error) {
+	var c Collection
+
+	errs := make(Errors, 0)
+
+	load := func(name string, r io.Reader) {
+		if !strings.HasSuffix(name, ".sql") {
+			return
+		}
+
+		member := path + ":" + name
+
+		rev, err := UnmarshalRevision(r)
+
+		if err == nil {
+			err = c.Put(rev)
+		}
+
+		if err != nil {
+			var rerr *RevisionError
+
+			if !errors.As(err, &rerr) {
+				rerr = &RevisionError{Err: err}
+			}
+
+			rerr.Path = member
+			errs = append(errs, rerr)
+		}
+	}
+
+	var err error
+
+	switch {
+	case strings.HasSuffix(path, ".zip"):
+		err = walkZip(path, load)
+	case strings.HasSuffix(path, ".tar.gz"), strings.HasSuffix(path, ".tgz"), strings.HasSuffix(path, ".tar"):
+		err = walkTar(path, load)
+	default:
+		err = errors.New("unsupported archive " + path)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	return &c, errs.err()
+}
+
+// walkZip calls the given function for each regular file in the zip archive at
+// the given path.
+func walkZip(path string, fn func(name string, r io.Reader)) error {
+	zr, err := zip.OpenReader(path)
+
+	if err != nil {
+		return err
+	}
+
+	defer zr.Close()
+
+	for _, f := range zr.File {
+		if !f.Mode().IsRegular() {
+			continue
+		}
+
+		rc, err := f.Open()
+
+		if err != nil {
+			return err
+		}
+
+		fn(f.Name, rc)
+		rc.Close()
+	}
+	return nil
+}
+
+// walkTar calls the given function for each regular file in the tar archive at
+// the given path. The archive is decompressed if it is gzip compressed.
+func walkTar(path string, fn func(name string, r io.Reader)) error {
+	f, err := os.Open(path)
+
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	var r io.Reader = f
+
+	if !strings.HasSuffix(path, ".tar") {
+		gr, err := gzip.NewReader(f)
+
+		if err != nil {
+			return err
+		}
+
+		defer gr.Close()
+
+		r = gr
+	}
+
+	tr := tar.NewReader(r)
+
+	for {
+		hdr, err := tr.Next()
+
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+
+		if !hdr.FileInfo().Mode().IsRegular() {
+			continue
+		}
+		fn(hdr.Name, tr)
+	}
+}
@@ -0,0 +1,134 @@
+package mgrt
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var archiveFiles = []struct {
+	name    string
+	content string
+}{
+	{"revisions/20060102150405.sql", "/*\nRevision: 20060102150405\nAuthor:   Andrew\n*/\n\nCREATE TABLE users ( id INT NOT NULL UNIQUE );"},
+	{"revisions/perms/20060102150405.sql", "/*\nRevision: perms/20060102150405\nAuthor:   Andrew\n*/\n\nGRANT SELECT ON users TO app;"},
+	{"revisions/20060102150406.sql", "/*\nRevision: not-an-id\nAuthor:   Andrew\n*/\n\nCREATE TABLE posts ( id INT NOT NULL UNIQUE );"},
+	{"revisions/README", "not a revision"},
+}
+
+func writeTarGz(path string) error {
+	f, err := os.Create(path)
+
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	gw := gzip.NewWriter(f)
+	tw := tar.NewWriter(gw)
+
+	for _, file := range archiveFiles {
+		hdr := &tar.Header{
+			Name: file.name,
+			Mode: 0644,
+			Size: int64(len(file.content)),
+		}
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+
+		if _, err := tw.Write([]byte(file.content)); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gw.Close()
+}
+
+func writeZip(path string) error {
+	f, err := os.Create(path)
+
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	zw := zip.NewWriter(f)
+
+	for _, file := range archiveFiles {
+		w, err := zw.Create(file.name)
+
+		if err != nil {
+			return err
+		}
+
+		if _, err := w.Write([]byte(file.content)); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+func Test_LoadRevisionsArchive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mgrt-archive-*")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name  string
+		write func(string) error
+	}{
+		{"revisions.tar.gz", writeTarGz},
+		{"revisions.zip", writeZip},
+	}
+
+	for _, test := range tests {
+		path := filepath.Join(dir, test.name)
+
+		if err := test.write(path); err != nil {
+			t.Fatal(err)
+		}
+
+		c, err := LoadRevisionsArchive(path)
+
+		var errs Errors
+
+		if !errors.As(err, &errs) || len(errs) != 1 {
+			t.Fatalf("%s - expected 1 error, got=%v\n", test.name, err)
+		}
+
+		if !errors.Is(errs[0], ErrInvalid) || !strings.Contains(errs[0].Error(), path+":revisions/20060102150406.sql") {
+			t.Fatalf("%s - unexpected error, got=%s\n", test.name, errs[0])
+		}
+
+		if c.Len() != 2 {
+			t.Fatalf("%s - unexpected revision count, expected=%d, got=%d\n", test.name, 2, c.Len())
+		}
+
+		for _, id := range []string{"20060102150405", "perms/20060102150405"} {
+			if !c.Has(id) {
+				t.Errorf("%s - expected revision %s\n", test.name, id)
+			}
+		}
+	}
+
+	if _, err := LoadRevisionsArchive(filepath.Join(dir, "revisions.rar")); err == nil {
+		t.Fatal("expected error for unsupported archive, got=nil")
+	}
+}
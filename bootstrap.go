@@ -0,0 +1,136 @@
+package mgrt
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// bootstrapBatch is the number of revisions recorded by each INSERT when
+// bootstrapping a database.
+const bootstrapBatch = 100
+
+// canBootstrap reports whether the given revisions can be performed via
+// bootstrap. This is only the case if no revisions have been performed in the
+// database, the database supports schema changes within a transaction, and
+// none of the revisions need to be performed outside of a transaction.
+func (m *Migrator) canBootstrap(revs []*Revision) (bool, error) {
+	if m.NoBootstrap || m.DB.execer != nil {
+		return false, nil
+	}
+
+	// MySQL implicitly commits the transaction for statements that change the
+	// schema, so the revisions would not be performed atomically.
+	if m.DB.Type != "sqlite3" && m.DB.Type != "pgx" {
+		return false, nil
+	}
+
+	for _, r := range revs {
+		if r.NoTransaction {
+			return false, nil
+		}
+	}
+
+	var performed bool
+
+	if err := m.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM mgrt_revisions)").Scan(&performed); err != nil {
+		return false, err
+	}
+	return !performed, nil
+}
+
+// bootstrap performs the given revisions against a database in which no
+// revisions have been performed, so none of the revisions are checked to see
+// if they have been performed. The revisions are all performed within a single
+// transaction, and are recorded via multi-row INSERTs, so either all of them
+// are performed, or none of them are.
+func (m *Migrator) bootstrap(revs []*Revision) error {
+	log := m.logger()
+
+	tx, err := m.DB.Begin()
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	performedBy := m.performedBy()
+
+	args := make([]interface{}, 0, bootstrapBatch*10)
+
+	record := func() error {
+		if len(args) == 0 {
+			return nil
+		}
+
+		n := len(args) / 10
+
+		q := "INSERT INTO mgrt_revisions (id, author, comment, sql, performed_at, hash, performed_by, duration_ms, version, sql_encoding) VALUES " +
+			strings.Repeat("(?, ?, ?, ?, ?, ?, ?, ?, ?, ?), ", n-1) + "(?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+
+		if _, err := tx.Exec(m.DB.Parameterize(q), args...); err != nil {
+			return err
+		}
+
+		args = args[:0]
+		return nil
+	}
+
+	for i, rev := range revs {
+		r, err := m.prepare(rev)
+
+		if err != nil {
+			log.Printf("revision %s failed: %s", rev.Slug(), err)
+			return err
+		}
+
+		if r.SQL == "" {
+			log.Printf("revision %s skipped: empty", r.Slug())
+		} else {
+			ctx, cancel := m.context()
+
+			start := time.Now()
+
+			err := m.execute(ctx, tx, r)
+			cancel()
+
+			if err != nil {
+				log.Printf("revision %s failed after %s: %s", r.Slug(), time.Since(start), err)
+				return err
+			}
+
+			duration := time.Since(start)
+
+			version := sql.NullString{
+				String: r.Version,
+				Valid:  r.Version != "",
+			}
+
+			if !r.NoRecord {
+				recorded, encoding, err := m.recordedSQL(r)
+
+				if err != nil {
+					return err
+				}
+				args = append(args, r.Slug(), r.Author, r.Comment, recorded, now().Unix(), r.genHash(), performedBy, duration.Milliseconds(), version, encoding)
+			}
+
+			if len(args) == bootstrapBatch*10 {
+				if err := record(); err != nil {
+					return err
+				}
+			}
+			log.Printf("revision %s performed in %s", r.Slug(), duration)
+		}
+
+		if m.OnProgress != nil {
+			m.OnProgress(i+1, len(revs), rev)
+		}
+	}
+
+	if err := record(); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -1,9 +1,12 @@
 package internal
 
 import (
+	"bytes"
+	"compress/gzip"
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -12,19 +15,75 @@ import (
 )
 
 var (
-	revisionsDir = "revisions"
+	revisionsDir = mgrt.DefaultRevisionsDir
 
 	AddCmd = &Command{
-		Usage: "add [comment]",
+		Usage: "add [-c category] [-message-file file] [comment]",
 		Short: "add a new revision",
 		Long:  `Add will open up the editor specified via EDITOR for creating the new revision.
-The -c flag can be given to specify a category for the new revision.`,
+The -c flag can be given to specify a category for the new revision.
+
+The -message-file flag reads the comment for the new revision from the given
+file, or from stdin if the file is -, instead of taking it as an argument.`,
 		Run:   addCmd,
 	}
 )
 
+// revisionPath returns the path to the revision with the given ID. If there is
+// no such revision, but there is a gzip compressed revision, then the path to
+// that is returned.
 func revisionPath(id string) string {
-	return filepath.Join(revisionsDir, id+".sql")
+	repo := mgrt.Repo{Dir: revisionsDir}
+	return repo.Path(id)
+}
+
+// revisionExt returns the file extension for a revision, depending on whether
+// it is gzip compressed.
+func revisionExt(gz bool) string {
+	if gz {
+		return ".sql.gz"
+	}
+	return ".sql"
+}
+
+// writeRevision writes the given revision to the given io.Writer. If gz is
+// true, then the revision is gzip compressed.
+func writeRevision(w io.Writer, rev *mgrt.Revision, gz bool) error {
+	if !gz {
+		_, err := rev.WriteTo(w)
+		return err
+	}
+
+	zw := gzip.NewWriter(w)
+
+	if _, err := rev.WriteTo(zw); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// readRevision returns the contents of the revision file at the given path,
+// decompressing it if it is gzip compressed.
+func readRevision(path string) ([]byte, error) {
+	b, err := os.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !bytes.HasPrefix(b, []byte{0x1f, 0x8b}) {
+		return b, nil
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(b))
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer zr.Close()
+
+	return io.ReadAll(zr)
 }
 
 func openInEditor(path string) error {
@@ -42,12 +101,16 @@ func openInEditor(path string) error {
 }
 
 func addCmd(cmd *Command, args []string) {
-	var category string
+	var (
+		category string
+		msgFile  string
+	)
 
 	argv0 := args[0]
 
 	fs := flag.NewFlagSet(cmd.Argv0+ " "+argv0, flag.ExitOnError)
 	fs.StringVar(&category, "c", "", "the category to put the revision under")
+	fs.StringVar(&msgFile, "message-file", "", "the file to read the comment from, - for stdin")
 	fs.Parse(args[1:])
 
 	args = fs.Args()
@@ -58,6 +121,22 @@ func addCmd(cmd *Command, args []string) {
 		comment = args[0]
 	}
 
+	if msgFile != "" {
+		if comment != "" {
+			fmt.Fprintf(os.Stderr, "%s %s: cannot give a comment with -message-file\n", cmd.Argv0, argv0)
+			os.Exit(1)
+		}
+
+		var err error
+
+		comment, err = readMessage(msgFile, os.Stdin)
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s %s: failed to read message: %s\n", cmd.Argv0, argv0, err)
+			os.Exit(1)
+		}
+	}
+
 	dir := revisionsDir
 
 	if category != "" {
@@ -65,14 +144,14 @@ func addCmd(cmd *Command, args []string) {
 	}
 
 	if err := os.MkdirAll(dir, os.FileMode(0755)); err != nil {
-		fmt.Fprintf(os.Stderr, "%s %s: failed to create %s directory: %s", cmd.Argv0, args[0], revisionsDir, err)
+		fmt.Fprintf(os.Stderr, "%s %s: failed to create %s directory: %s", cmd.Argv0, argv0, revisionsDir, err)
 		os.Exit(1)
 	}
 
-	author, err := mgrtAuthor()
+	author, err := resolveAuthor("", "")
 
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "%s %s: failed to get mgrt author: %s", cmd.Argv0, args[0], err)
+		fmt.Fprintf(os.Stderr, "%s %s: failed to get mgrt author: %s", cmd.Argv0, argv0, err)
 		os.Exit(1)
 	}
 
@@ -89,7 +168,7 @@ func addCmd(cmd *Command, args []string) {
 	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE, os.FileMode(0644))
 
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "%s %s: failed to create revision: %s", cmd.Argv0, args[0], err)
+		fmt.Fprintf(os.Stderr, "%s %s: failed to create revision: %s", cmd.Argv0, argv0, err)
 		os.Exit(1)
 	}
 
@@ -98,8 +177,8 @@ func addCmd(cmd *Command, args []string) {
 	f.WriteString(rev.String())
 
 	if err := openInEditor(path); err != nil {
-		fmt.Fprintf(os.Stderr, "%s %s: failed to open revision file: %s", cmd.Argv0, args[0], err)
+		fmt.Fprintf(os.Stderr, "%s %s: failed to open revision file: %s", cmd.Argv0, argv0, err)
 		os.Exit(1)
 	}
-	fmt.Println("revision created", rev.Slug())
+	cmd.Println("revision created", rev.Slug())
 }
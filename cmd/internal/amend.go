@@ -0,0 +1,170 @@
+package internal
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/andrewpillar/mgrt/v3"
+)
+
+var AmendCmd = &Command{
+	Usage: "amend [-author author] [-comment comment] [-force] <revision>",
+	Short: "change the author or comment of a revision",
+	Long: `Amend will change the author or comment of the given revision, and rewrite the
+revision file. The SQL of the revision is left exactly as it is. This is for
+correcting a revision before it has been performed anywhere.
+
+The -author flag specifies the new author of the revision.
+
+The -comment flag specifies the new comment of the revision.
+
+If a database is given, then amend will refuse to change a revision that has
+already been performed in it, since the revision would no longer match what was
+performed. The -force flag will amend the revision regardless. The database to
+connect to is specified via the -type and -dsn flags, or via the -db flag if a
+database connection has been configured via the "mgrt db" command.
+
+The -type flag specifies the type of database to connect to, it will be one of,
+
+    mysql
+    postgresql
+    sqlite3
+
+The -dsn flag specifies the data source name for the database. This will vary
+depending on the type of database you're connecting to. Environment variables
+referenced in the dsn, such as ${DB_PASSWORD}, will be expanded.`,
+	Run: amendCmd,
+}
+
+// amendRevision sets the author and comment of the revision at the given path
+// to those given, and rewrites it. An empty author or comment is left as is.
+// The SQL of the revision, and any whitespace after it, is written back
+// unchanged.
+func amendRevision(path, author, comment string) (*mgrt.Revision, error) {
+	for _, line := range strings.Split(comment, "\n") {
+		if strings.HasSuffix(strings.TrimRightFunc(line, unicode.IsSpace), "*/") {
+			return nil, errors.New("comment cannot have a line ending in */")
+		}
+	}
+
+	b, err := readRevision(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	rev, err := mgrt.UnmarshalRevision(bytes.NewReader(b))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if author != "" {
+		rev.Author = author
+	}
+
+	if comment != "" {
+		rev.Comment = comment
+	}
+
+	var buf bytes.Buffer
+
+	if _, err := rev.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+
+	if i := bytes.LastIndex(b, []byte(rev.SQL)); rev.SQL != "" && i >= 0 {
+		buf.Write(b[i+len(rev.SQL):])
+	}
+
+	if strings.HasSuffix(path, ".gz") {
+		var zbuf bytes.Buffer
+
+		zw := gzip.NewWriter(&zbuf)
+
+		if _, err := zw.Write(buf.Bytes()); err != nil {
+			return nil, err
+		}
+
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		buf = zbuf
+	}
+
+	if err := os.WriteFile(path, buf.Bytes(), os.FileMode(0644)); err != nil {
+		return nil, err
+	}
+	return rev, nil
+}
+
+func amendCmd(cmd *Command, args []string) {
+	argv0 := args[0]
+
+	var (
+		typ     string
+		dsn     string
+		dbname  string
+		author  string
+		comment string
+		force   bool
+	)
+
+	fs := flag.NewFlagSet(cmd.Argv0+" "+argv0, flag.ExitOnError)
+	fs.StringVar(&typ, "type", "", "the database type one of postgresql, sqlite3")
+	fs.StringVar(&dsn, "dsn", "", "the dsn for the database to check the revision against")
+	fs.StringVar(&dbname, "db", "", "the database to connect to")
+	fs.StringVar(&author, "author", "", "the new author of the revision")
+	fs.StringVar(&comment, "comment", "", "the new comment of the revision")
+	fs.BoolVar(&force, "force", false, "amend the revision even if it has been performed")
+	fs.Parse(args[1:])
+
+	args = fs.Args()
+
+	if len(args) != 1 || (author == "" && comment == "") {
+		fmt.Fprintf(os.Stderr, "usage: %s %s [-author author] [-comment comment] [-force] <revision>\n", cmd.Argv0, argv0)
+		os.Exit(ExitError)
+	}
+
+	path := revisionPath(args[0])
+
+	rev, err := mgrt.OpenRevision(path)
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s %s: failed to open revision: %s\n", cmd.Argv0, argv0, err)
+		os.Exit(ExitError)
+	}
+
+	if !force && (typ != "" || dsn != "" || dbname != "") {
+		db, err := openDB(typ, dsn, dbname)
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s %s: %s\n", cmd.Argv0, argv0, err)
+			os.Exit(ExitError)
+		}
+
+		err = mgrt.RevisionPerformed(db, rev)
+		db.Close()
+
+		if err != nil {
+			if errors.Is(err, mgrt.ErrPerformed) {
+				fmt.Fprintf(os.Stderr, "%s %s: refusing to amend %s, it has been performed, use -force to amend it anyway\n", cmd.Argv0, argv0, rev.Slug())
+				os.Exit(ExitError)
+			}
+			fmt.Fprintf(os.Stderr, "%s %s: %s\n", cmd.Argv0, argv0, err)
+			os.Exit(ExitError)
+		}
+	}
+
+	if _, err := amendRevision(path, author, comment); err != nil {
+		fmt.Fprintf(os.Stderr, "%s %s: failed to amend revision: %s\n", cmd.Argv0, argv0, err)
+		os.Exit(ExitError)
+	}
+	cmd.Println("revision amended", rev.Slug())
+}
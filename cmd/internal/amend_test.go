@@ -0,0 +1,124 @@
+package internal
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/andrewpillar/mgrt/v3"
+)
+
+func Test_AmendRevision(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mgrt-amend-*")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	sql := "CREATE TABLE users (\n\tid    INT NOT NULL UNIQUE, \n\tnotes TEXT -- keep */ this\n);\r\n\n/* trailing comment */\nSELECT '  spaced  ';"
+
+	rev := &mgrt.Revision{
+		ID:      "20060102150405",
+		Author:  "Wrong Author",
+		Comment: "Add users table",
+		SQL:     sql,
+	}
+
+	for _, gz := range []bool{false, true} {
+		path := filepath.Join(dir, rev.ID+revisionExt(gz))
+
+		f, err := os.Create(path)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = writeRevision(f, rev, gz)
+		f.Close()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		before, err := readRevision(path)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := amendRevision(path, "Andrew", "Add the users table\n\nWith notes."); err != nil {
+			t.Fatal(err)
+		}
+
+		after, err := readRevision(path)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.HasSuffix(before, []byte(sql)) || !bytes.HasSuffix(after, []byte(sql)) {
+			t.Fatalf("expected sql to be preserved, got=%q\n", after)
+		}
+
+		amended, err := mgrt.UnmarshalRevision(bytes.NewReader(after))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if amended.Author != "Andrew" {
+			t.Errorf("unexpected author, expected=%q, got=%q\n", "Andrew", amended.Author)
+		}
+
+		if amended.Comment != "Add the users table\n\nWith notes." {
+			t.Errorf("unexpected comment, expected=%q, got=%q\n", "Add the users table\n\nWith notes.", amended.Comment)
+		}
+
+		if amended.SQL != sql {
+			t.Errorf("unexpected sql, expected=%q, got=%q\n", sql, amended.SQL)
+		}
+
+		if _, err := amendRevision(path, "", "Bad comment */"); err == nil || !strings.Contains(err.Error(), "*/") {
+			t.Errorf("expected error for comment ending in */, got=%v\n", err)
+		}
+	}
+}
+
+func Test_AmendRevisionTrailingWhitespace(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mgrt-amend-*")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "20060102150405.sql")
+
+	raw := "/*\nRevision: 20060102150405\nAuthor:   Wrong Author\n*/\n\nSELECT 1;\n\n"
+
+	if err := ioutil.WriteFile(path, []byte(raw), os.FileMode(0644)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := amendRevision(path, "Andrew", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := strings.Replace(raw, "Wrong Author", "Andrew", 1)
+
+	if string(b) != expected {
+		t.Fatalf("unexpected revision, expected=%q, got=%q\n", expected, string(b))
+	}
+}
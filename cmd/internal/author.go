@@ -23,27 +23,55 @@ func git(subcmd string, args ...string) (string, string, error) {
 	return stdout.String(), stderr.String(), err
 }
 
-// mgrtAuthor will attempt to get author information from git using the
-// config.name and config.email properties. If this fails, then it falls back
-// to getting the current user's username.
-func mgrtAuthor() (string, error) {
-	stdout, _, err := git("config", "user.name")
+// gitConfig returns the value of the given git config property, or an empty
+// string if it is not set, or git cannot be run.
+func gitConfig(key string) string {
+	stdout, _, err := git("config", key)
 
 	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(stdout)
+}
+
+// resolveAuthor returns the author of a revision in the form of
+// "name <email>". If the given name is empty, then it is taken from the
+// user.name git config property, followed by the GIT_AUTHOR_NAME environment
+// variable. If the given email is empty, then it is taken from the user.email
+// git config property, followed by the GIT_AUTHOR_EMAIL and EMAIL environment
+// variables. If no name can be found, then the current user's username is used
+// instead. The email is omitted if none can be found.
+func resolveAuthor(name, email string) (string, error) {
+	if name == "" {
+		name = gitConfig("user.name")
+	}
+
+	if name == "" {
+		name = os.Getenv("GIT_AUTHOR_NAME")
+	}
+
+	if email == "" {
+		email = gitConfig("user.email")
+	}
+
+	for _, env := range []string{"GIT_AUTHOR_EMAIL", "EMAIL"} {
+		if email != "" {
+			break
+		}
+		email = os.Getenv(env)
+	}
+
+	if name == "" {
 		u, err := user.Current()
 
 		if err != nil {
 			return "", err
 		}
-		return u.Username, nil
+		name = u.Username
 	}
 
-	name := strings.TrimSpace(stdout)
-
-	stdout, _, err = git("config", "user.email")
-
-	if err != nil {
+	if email == "" {
 		return name, nil
 	}
-	return name + " <" + strings.TrimSpace(stdout) + ">", nil
+	return name + " <" + email + ">", nil
 }
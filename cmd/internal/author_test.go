@@ -0,0 +1,47 @@
+package internal
+
+import (
+	"os/user"
+	"testing"
+)
+
+func Test_ResolveAuthor(t *testing.T) {
+	// Empty the PATH so git cannot be run, and the environment is used.
+	setenv(t, "PATH", "")
+
+	u, err := user.Current()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name, email       string
+		envName, envEmail string
+		email2            string
+		expected          string
+	}{
+		{"Andrew", "me@andrewpillar.com", "Env", "env@example.com", "", "Andrew <me@andrewpillar.com>"},
+		{"", "", "Env", "env@example.com", "", "Env <env@example.com>"},
+		{"", "", "Env", "", "email@example.com", "Env <email@example.com>"},
+		{"Andrew", "", "", "", "", "Andrew"},
+		{"", "", "", "", "", u.Username},
+		{"", "me@andrewpillar.com", "", "", "", u.Username + " <me@andrewpillar.com>"},
+	}
+
+	for i, test := range tests {
+		setenv(t, "GIT_AUTHOR_NAME", test.envName)
+		setenv(t, "GIT_AUTHOR_EMAIL", test.envEmail)
+		setenv(t, "EMAIL", test.email2)
+
+		author, err := resolveAuthor(test.name, test.email)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if author != test.expected {
+			t.Errorf("tests[%d] - unexpected author, expected=%q, got=%q\n", i, test.expected, author)
+		}
+	}
+}
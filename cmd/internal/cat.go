@@ -56,9 +56,9 @@ func catCmd(cmd *Command, args []string) {
 		}
 
 		if sql {
-			fmt.Println(r.SQL)
+			cmd.Println(r.SQL)
 			return
 		}
-		fmt.Println(r.String())
+		cmd.Println(r.String())
 	}
 }
@@ -0,0 +1,48 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/andrewpillar/mgrt/v3"
+)
+
+var CheckCmd = &Command{
+	Usage: "check",
+	Short: "check that the local revisions are valid",
+	Long: `Check will check that each of the local revisions can be parsed, has a valid ID,
+has an author, and does not have the same ID as another revision. Each invalid
+revision is displayed, and check exits with 1 if any are found. No database is
+connected to, so this is suitable for use as a pre-commit hook.`,
+	Run: checkCmd,
+}
+
+func checkCmd(cmd *Command, args []string) {
+	argv0 := args[0]
+
+	info, err := os.Stat(revisionsDir)
+
+	if err != nil {
+		if os.IsNotExist(err) {
+			return
+		}
+
+		fmt.Fprintf(os.Stderr, "%s %s: failed to check revisions: %s\n", cmd.Argv0, argv0, err)
+		os.Exit(ExitError)
+	}
+
+	if !info.IsDir() {
+		fmt.Fprintf(os.Stderr, "%s %s: %s is not a directory\n", cmd.Argv0, argv0, revisionsDir)
+		os.Exit(ExitError)
+	}
+
+	errs := mgrt.ValidateDir(revisionsDir)
+
+	for _, err := range errs {
+		fmt.Fprintf(os.Stderr, "%s %s: %s\n", cmd.Argv0, argv0, err)
+	}
+
+	if len(errs) > 0 {
+		os.Exit(ExitError)
+	}
+}
@@ -2,8 +2,29 @@ package internal
 
 import (
 	"fmt"
+	"log"
 	"os"
 	"sort"
+
+	"github.com/andrewpillar/mgrt/v3"
+)
+
+// Verbosity is how much output a command displays. Errors are always
+// displayed, regardless of verbosity.
+type Verbosity int
+
+// The exit codes of the commands that report on, or perform revisions. These
+// allow for scripts to tell pending revisions apart from actual errors.
+const (
+	ExitOK      = 0 // ExitOK is used when all revisions have been performed.
+	ExitError   = 1 // ExitError is used when an error occurs.
+	ExitPending = 2 // ExitPending is used when there are revisions pending.
+)
+
+const (
+	Quiet   Verbosity = iota - 1 // Quiet displays nothing other than errors.
+	Normal                       // Normal is the default verbosity.
+	Verbose                      // Verbose displays each statement performed, and how long it took.
 )
 
 type Command struct {
@@ -20,6 +41,10 @@ type Command struct {
 
 	// Commands is the set of sub-commands the command could have.
 	Commands *CommandSet
+
+	// Verbosity is how much output the command displays. This is set from the
+	// CommandSet the command is run from.
+	Verbosity Verbosity
 }
 
 type CommandSet struct {
@@ -30,6 +55,9 @@ type CommandSet struct {
 	Argv0 string
 	Long  string
 	Usage func()
+
+	// Verbosity is passed to each command that is run from the set.
+	Verbosity Verbosity
 }
 
 type ErrCommandNotFound string
@@ -137,8 +165,42 @@ func (c *CommandSet) Parse(args []string) error {
 	if !ok {
 		return ErrCommandNotFound(name)
 	}
+
+	cmd.Verbosity = c.Verbosity
 	cmd.Run(cmd, args)
 	return nil
 }
 
+// Printf displays the formatted output of the command, unless the command is
+// quiet.
+func (c *Command) Printf(format string, v ...interface{}) {
+	if c.Verbosity > Quiet {
+		fmt.Printf(format, v...)
+	}
+}
+
+// Println displays the output of the command, unless the command is quiet.
+func (c *Command) Println(v ...interface{}) {
+	if c.Verbosity > Quiet {
+		fmt.Println(v...)
+	}
+}
+
+// Verbosef displays the formatted output of the command only if the command
+// is verbose.
+func (c *Command) Verbosef(format string, v ...interface{}) {
+	if c.Verbosity >= Verbose {
+		fmt.Printf(format, v...)
+	}
+}
+
+// Logger returns the logger for a Migrator to log the revisions it performs
+// to. This returns nil unless the command is verbose.
+func (c *Command) Logger() mgrt.Logger {
+	if c.Verbosity >= Verbose {
+		return log.New(os.Stdout, "", 0)
+	}
+	return nil
+}
+
 func (e ErrCommandNotFound) Error() string { return "command not found " + string(e) }
@@ -0,0 +1,63 @@
+package internal
+
+import (
+	"errors"
+	"os"
+)
+
+// colors colorizes the output of a command via ANSI escape codes. If colors
+// are not enabled, then the given strings are returned as is.
+type colors bool
+
+const (
+	colorReset  = "\x1b[0m"
+	colorBold   = "\x1b[1m"
+	colorDim    = "\x1b[2m"
+	colorYellow = "\x1b[33m"
+)
+
+// newColors returns the colors for output written to the given file, depending
+// on the given mode. The mode is one of auto, always, or never. If auto, then
+// colors are only enabled if the file is a terminal, and the NO_COLOR
+// environment variable is not set.
+func newColors(mode string, f *os.File) (colors, error) {
+	switch mode {
+	case "always":
+		return true, nil
+	case "never":
+		return false, nil
+	case "auto", "":
+		if _, ok := os.LookupEnv("NO_COLOR"); ok {
+			return false, nil
+		}
+		return colors(isTerminal(f)), nil
+	default:
+		return false, errors.New("unknown color mode " + mode + ", must be one of auto, always, never")
+	}
+}
+
+// isTerminal reports whether the given file is a terminal.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+func (c colors) wrap(code, s string) string {
+	if !c || s == "" {
+		return s
+	}
+	return code + s + colorReset
+}
+
+// revision colorizes the ID of a revision.
+func (c colors) revision(s string) string { return c.wrap(colorYellow, s) }
+
+// label colorizes a label, such as Author: or Performed:.
+func (c colors) label(s string) string { return c.wrap(colorBold, s) }
+
+// dim dims the given string, such as the SQL of a revision.
+func (c colors) dim(s string) string { return c.wrap(colorDim, s) }
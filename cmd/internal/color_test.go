@@ -0,0 +1,95 @@
+package internal
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andrewpillar/mgrt/v3"
+)
+
+func Test_NewColors(t *testing.T) {
+	f, err := ioutil.TempFile("", "mgrt-color-*")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	tests := []struct {
+		mode     string
+		expected colors
+	}{
+		{"always", true},
+		{"never", false},
+		{"auto", false},
+		{"", false},
+	}
+
+	for i, test := range tests {
+		c, err := newColors(test.mode, f)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if c != test.expected {
+			t.Errorf("tests[%d] - unexpected colors for %q, expected=%v, got=%v\n", i, test.mode, test.expected, c)
+		}
+	}
+
+	if _, err := newColors("sometimes", f); err == nil {
+		t.Errorf("expected error for unknown color mode")
+	}
+}
+
+func Test_FormatRevision(t *testing.T) {
+	rev := &mgrt.Revision{
+		ID:          "20060102150405",
+		Author:      "Andrew",
+		Comment:     "Add users\n\nAnd their emails",
+		SQL:         "CREATE TABLE users (\n\temail TEXT\n);",
+		PerformedAt: time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC),
+		PerformedBy: "andrew@host",
+		Duration:    time.Second,
+	}
+
+	expected := `revision 20060102150405
+Author:     Andrew
+Performed:  Mon Jan  2 15:04:05 2006 (took 1s)
+Performed by: andrew@host
+
+    Add users
+    
+    And their emails
+
+    CREATE TABLE users (
+    	email TEXT
+    );
+
+`
+
+	if s := formatRevision(rev, false, true); s != expected {
+		t.Errorf("unexpected revision, expected=%q, got=%q\n", expected, s)
+	}
+
+	s := formatRevision(rev, true, true)
+
+	for _, want := range []string{
+		"revision " + colorYellow + "20060102150405" + colorReset + "\n",
+		colorBold + "Performed:" + colorReset + "  Mon Jan  2",
+		"    " + colorDim + "CREATE TABLE users (" + colorReset + "\n",
+	} {
+		if !strings.Contains(s, want) {
+			t.Errorf("expected colorized revision to contain %q, got=%q\n", want, s)
+		}
+	}
+
+	if strings.Contains(formatRevision(rev, true, false), colorDim) {
+		t.Errorf("expected no sql in revision formatted without sql")
+	}
+}
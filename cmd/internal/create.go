@@ -0,0 +1,175 @@
+package internal
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/andrewpillar/mgrt/v3"
+)
+
+var CreateCmd = &Command{
+	Usage: "create [-author author] [-comment comment|-message-file file] [-category category] [-version version] [-template name] [-template-dir dir] [-var key=value] [-edit] [-gzip]",
+	Short: "create a new revision without opening an editor",
+	Long: `Create will create a new revision file and print its path. Unlike add, the
+editor is only opened if the -edit flag is given, which makes create suitable
+for use in scripts.
+
+The -author flag specifies the author of the revision. If not given, then the
+name and email of the author are taken from the user.name and user.email git
+config properties, followed by the GIT_AUTHOR_NAME, GIT_AUTHOR_EMAIL, and EMAIL
+environment variables. If no name is found, then the current user is used.
+
+The -comment flag specifies the comment for the revision.
+
+The -message-file flag reads the comment for the revision from the given file,
+or from stdin if the file is -. This is useful for comments that span multiple
+lines. This cannot be used with -comment.
+
+The -category flag, or -c, specifies the category to put the revision under.
+
+The -version flag specifies the release version the revision ships in, such as
+v2.3.0. This is recorded when the revision is performed.
+
+The -template flag fills in the SQL of the revision from the template of the
+given name. The built-in templates are,
+
+    create-table    CREATE TABLE {{.Table}} ( id INT NOT NULL UNIQUE );
+    add-column      ALTER TABLE {{.Table}} ADD COLUMN {{.Column}} {{.Type}};
+    add-index       CREATE INDEX {{.Table}}_{{.Column}}_idx ON {{.Table}} ({{.Column}});
+
+The -var flag sets a variable in the template, and can be given multiple times,
+for example,
+
+    mgrt create -template add-column -var Table=users -var Column=email -var Type=TEXT
+
+The -template-dir flag specifies a directory of templates, each being a file
+named after the template with the .sql extension. These are Go text/template
+templates, and take precedence over the built-in templates. If not given, then
+the MGRT_TEMPLATE_DIR environment variable is used.
+
+The -edit flag opens the new revision in the editor specified via EDITOR.
+
+The -gzip flag gzip compresses the new revision. This cannot be used with
+-edit.`,
+	Run: createCmd,
+}
+
+func createCmd(cmd *Command, args []string) {
+	argv0 := args[0]
+
+	var (
+		author   string
+		comment  string
+		msgFile  string
+		category string
+		vers     string
+		tmpl     string
+		tmplDir  string
+		edit     bool
+		gz       bool
+	)
+
+	vars := make(templateVars)
+
+	fs := flag.NewFlagSet(cmd.Argv0+" "+argv0, flag.ExitOnError)
+	fs.StringVar(&author, "author", "", "the author of the revision")
+	fs.StringVar(&comment, "comment", "", "the comment for the revision")
+	fs.StringVar(&msgFile, "message-file", "", "the file to read the comment from, - for stdin")
+	fs.StringVar(&category, "category", "", "the category to put the revision under")
+	fs.StringVar(&category, "c", "", "the category to put the revision under")
+	fs.StringVar(&vers, "version", "", "the version the revision ships in")
+	fs.StringVar(&tmpl, "template", "", "the template to fill in the revision from, one of "+strings.Join(templateNames(), ", "))
+	fs.StringVar(&tmplDir, "template-dir", os.Getenv("MGRT_TEMPLATE_DIR"), "the directory of templates")
+	fs.Var(vars, "var", "set a variable in the template")
+	fs.BoolVar(&edit, "edit", false, "open the revision in the editor")
+	fs.BoolVar(&gz, "gzip", false, "gzip compress the revision")
+	fs.Parse(args[1:])
+
+	if edit && gz {
+		fmt.Fprintf(os.Stderr, "%s %s: cannot use -edit with -gzip\n", cmd.Argv0, argv0)
+		os.Exit(1)
+	}
+
+	if comment != "" && msgFile != "" {
+		fmt.Fprintf(os.Stderr, "%s %s: cannot use -comment with -message-file\n", cmd.Argv0, argv0)
+		os.Exit(1)
+	}
+
+	if msgFile != "" {
+		var err error
+
+		comment, err = readMessage(msgFile, os.Stdin)
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s %s: failed to read message: %s\n", cmd.Argv0, argv0, err)
+			os.Exit(1)
+		}
+	}
+
+	if author == "" {
+		var err error
+
+		author, err = resolveAuthor("", "")
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s %s: failed to get mgrt author: %s\n", cmd.Argv0, argv0, err)
+			os.Exit(1)
+		}
+	}
+
+	var sql string
+
+	if tmpl != "" {
+		var err error
+
+		sql, err = execTemplate(tmplDir, tmpl, vars)
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s %s: failed to fill in template: %s\n", cmd.Argv0, argv0, err)
+			os.Exit(1)
+		}
+	}
+
+	dir := revisionsDir
+
+	if category != "" {
+		dir = filepath.Join(revisionsDir, category)
+	}
+
+	if err := os.MkdirAll(dir, os.FileMode(0755)); err != nil {
+		fmt.Fprintf(os.Stderr, "%s %s: failed to create %s directory: %s\n", cmd.Argv0, argv0, dir, err)
+		os.Exit(1)
+	}
+
+	rev := mgrt.NewRevisionCategory(category, author, comment)
+	rev.SQL = sql
+	rev.Version = vers
+
+	path := filepath.Join(dir, rev.ID+revisionExt(gz))
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, os.FileMode(0644))
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s %s: failed to create revision: %s\n", cmd.Argv0, argv0, err)
+		os.Exit(1)
+	}
+
+	err = writeRevision(f, rev, gz)
+	f.Close()
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s %s: failed to create revision: %s\n", cmd.Argv0, argv0, err)
+		os.Exit(1)
+	}
+
+	if edit {
+		if err := openInEditor(path); err != nil {
+			fmt.Fprintf(os.Stderr, "%s %s: failed to open revision file: %s\n", cmd.Argv0, argv0, err)
+			os.Exit(1)
+		}
+	}
+	cmd.Println(path)
+}
@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+
+	"github.com/andrewpillar/mgrt/v3"
 )
 
 type dbItem struct {
@@ -86,6 +88,152 @@ func getdbitem(name string) (dbItem, error) {
 	return it, nil
 }
 
+// getdbitems returns all of the databases configured via "mgrt db", sorted by
+// name.
+func getdbitems() ([]dbItem, error) {
+	dir, err := mgrtdir()
+
+	if err != nil {
+		return nil, err
+	}
+
+	ents, err := os.ReadDir(dir)
+
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]dbItem, 0, len(ents))
+
+	for _, ent := range ents {
+		if ent.IsDir() {
+			continue
+		}
+
+		it, err := getdbitem(ent.Name())
+
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, it)
+	}
+	return items, nil
+}
+
+// openDB opens a connection to the database of the given type and dsn, as
+// resolved by resolveDB. Any environment variables referenced in the dsn are
+// expanded before connecting. The given options are passed to mgrt.Open.
+func openDB(typ, dsn, name string, opts ...mgrt.Option) (*mgrt.DB, error) {
+	typ, dsn, err := resolveDB(typ, dsn, name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	dsn, err = mgrt.ExpandDSN(dsn)
+
+	if err != nil {
+		return nil, err
+	}
+	return mgrt.Open(typ, dsn, opts...)
+}
+
+// openDBReadOnly is like openDB, only the database is opened via
+// mgrt.OpenReadOnly, so nothing is written to it.
+func openDBReadOnly(typ, dsn, name string) (*mgrt.DB, error) {
+	typ, dsn, err := resolveDB(typ, dsn, name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	dsn, err = mgrt.ExpandDSN(dsn)
+
+	if err != nil {
+		return nil, err
+	}
+	return mgrt.OpenReadOnly(typ, dsn)
+}
+
+// openDBLazy is like openDB, only the database is opened via mgrt.OpenLazy, so
+// it is neither connected to, nor initialized.
+func openDBLazy(typ, dsn, name string) (*mgrt.DB, error) {
+	typ, dsn, err := resolveDB(typ, dsn, name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	dsn, err = mgrt.ExpandDSN(dsn)
+
+	if err != nil {
+		return nil, err
+	}
+	return mgrt.OpenLazy(typ, dsn)
+}
+
+// checkRevisionsTable returns an error if the mgrt_revisions table cannot be
+// queried. For a database opened via openDBReadOnly, this means that no
+// revisions have been performed in it, since the table is not created.
+func checkRevisionsTable(db *mgrt.DB) error {
+	var n int64
+	return db.QueryRow("SELECT COUNT(*) FROM mgrt_revisions").Scan(&n)
+}
+
+// resolveDB returns the type and dsn of the database to connect to. The given
+// type and dsn take precedence, followed by those of the database configured
+// via "mgrt db" with the given name, followed by the MGRT_TYPE and MGRT_DSN
+// environment variables. MGRT_TYPE is only used for the dsn in MGRT_DSN, so
+// it does not override the type of a dsn given explicitly. If no type is given
+// by any of these, then it is detected from the dsn via mgrt.DetectType.
+func resolveDB(typ, dsn, name string) (string, string, error) {
+	if name != "" {
+		it, err := getdbitem(name)
+
+		if err != nil {
+			if os.IsNotExist(err) {
+				return "", "", errors.New("database " + name + " does not exist")
+			}
+			return "", "", err
+		}
+
+		if typ == "" {
+			typ = it.Type
+		}
+
+		if dsn == "" {
+			dsn = it.DSN
+		}
+	}
+
+	if dsn == "" {
+		dsn = os.Getenv("MGRT_DSN")
+
+		if typ == "" {
+			typ = os.Getenv("MGRT_TYPE")
+		}
+	}
+
+	if dsn == "" {
+		return "", "", errors.New("database not specified")
+	}
+
+	if typ == "" {
+		expanded, err := mgrt.ExpandDSN(dsn)
+
+		if err != nil {
+			expanded = dsn
+		}
+
+		typ, err = mgrt.DetectType(expanded)
+
+		if err != nil {
+			return "", "", errors.New("database type not specified, " + err.Error())
+		}
+	}
+	return typ, dsn, nil
+}
+
 func DBCmd(argv0 string) *Command {
 	cmd := &Command{
 		Usage: "db <command> [arguments]",
@@ -107,6 +255,8 @@ func dbCmd(cmd *Command, args []string) {
 		fmt.Println("usage:", cmd.Argv0, cmd.Usage)
 	}
 
+	cmd.Commands.Verbosity = cmd.Verbosity
+
 	if err := cmd.Commands.Parse(args[1:]); err != nil {
 		fmt.Fprintf(os.Stderr, "%s %s: %s\n", cmd.Argv0, args[0], err)
 		os.Exit(1)
@@ -146,7 +296,7 @@ func dbLsCmd(cmd *Command, args []string) {
 			return err
 		}
 
-		fmt.Println(it.Name)
+		cmd.Println(it.Name)
 		return nil
 	})
 
@@ -183,14 +333,14 @@ func dbSetCmd(cmd *Command, args []string) {
 
 	if err != nil {
 		if !os.IsNotExist(err) {
-			fmt.Fprintf(os.Stderr, "%s: %s\n", cmd.Argv0, argv0, err)
+			fmt.Fprintf(os.Stderr, "%s %s: %s\n", cmd.Argv0, argv0, err)
 			os.Exit(1)
 		}
 	}
 
 	if err == nil {
 		if err := os.RemoveAll(fname); err != nil {
-			fmt.Fprintf(os.Stderr, "%s: %s\n", cmd.Argv0, argv0, err)
+			fmt.Fprintf(os.Stderr, "%s %s: %s\n", cmd.Argv0, argv0, err)
 			os.Exit(1)
 		}
 	}
@@ -0,0 +1,105 @@
+package internal
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func setenv(t *testing.T, key, val string) {
+	prev, ok := os.LookupEnv(key)
+
+	if err := os.Setenv(key, val); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		if ok {
+			os.Setenv(key, prev)
+			return
+		}
+		os.Unsetenv(key)
+	})
+}
+
+func Test_ResolveDB(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "mgrt-cfg-*")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(tmp)
+
+	setenv(t, "XDG_CONFIG_HOME", tmp)
+	setenv(t, "HOME", tmp)
+
+	dir, err := mgrtdir()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	item := `{"Type":"postgresql","DSN":"host=item"}`
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "item"), []byte(item), os.FileMode(0400)); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		typ, dsn, name string
+		env            bool
+		expectedTyp    string
+		expectedDSN    string
+		err            bool
+	}{
+		{"sqlite3", "flag.db", "item", true, "sqlite3", "flag.db", false},
+		{"", "", "item", true, "postgresql", "host=item", false},
+		{"", "flag.db", "item", true, "postgresql", "flag.db", false},
+		{"", "", "", true, "mysql", "env", false},
+		{"sqlite3", "", "", true, "sqlite3", "env", false},
+		{"", "acme.db", "", true, "sqlite3", "acme.db", false},
+		{"", "postgres://localhost/dev", "", true, "postgresql", "postgres://localhost/dev", false},
+		{"", "acme", "", true, "", "", true},
+		{"", "", "", false, "", "", true},
+		{"", "", "nonexistent", true, "", "", true},
+		{"", "postgres://localhost/dev", "", false, "postgresql", "postgres://localhost/dev", false},
+		{"", "acme.db", "", false, "sqlite3", "acme.db", false},
+		{"mysql", "acme.db", "", false, "mysql", "acme.db", false},
+		{"", "acme", "", false, "", "", true},
+	}
+
+	for i, test := range tests {
+		envTyp, envDSN := "", ""
+
+		if test.env {
+			envTyp, envDSN = "mysql", "env"
+		}
+
+		setenv(t, "MGRT_TYPE", envTyp)
+		setenv(t, "MGRT_DSN", envDSN)
+
+		typ, dsn, err := resolveDB(test.typ, test.dsn, test.name)
+
+		if err != nil {
+			if !test.err {
+				t.Errorf("tests[%d] - unexpected error %q\n", i, err)
+			}
+			continue
+		}
+
+		if test.err {
+			t.Errorf("tests[%d] - expected error\n", i)
+			continue
+		}
+
+		if typ != test.expectedTyp {
+			t.Errorf("tests[%d] - unexpected type, expected=%q, got=%q\n", i, test.expectedTyp, typ)
+		}
+
+		if dsn != test.expectedDSN {
+			t.Errorf("tests[%d] - unexpected dsn, expected=%q, got=%q\n", i, test.expectedDSN, dsn)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package internal
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/andrewpillar/mgrt/v3"
+)
+
+var DiffCmd = &Command{
+	Usage: "diff <-type type> <-dsn dsn> <-type2 type> <-dsn2 dsn>",
+	Short: "compare the revisions performed in two databases",
+	Long: `Diff will compare the revisions that have been performed in two databases. The
+revisions performed only in the first database are prefixed with -, and the
+revisions performed only in the second database are prefixed with +. Nothing is
+printed if both databases have performed the same revisions.
+
+The first database to connect to is specified via the -type and -dsn flags, or
+via the -db flag if a database connection has been configured via the "mgrt db"
+command. The second database is specified via the -type2 and -dsn2 flags, or
+via the -db2 flag.
+
+The -type and -type2 flags specify the type of database to connect to, it will
+be one of,
+
+    mysql
+    postgresql
+    sqlite3
+
+The -dsn and -dsn2 flags specify the data source name for the database. This
+will vary depending on the type of database you're connecting to.`,
+	Run: diffCmd,
+}
+
+func diffCmd(cmd *Command, args []string) {
+	argv0 := args[0]
+
+	var (
+		typ, typ2       string
+		dsn, dsn2       string
+		dbname, dbname2 string
+	)
+
+	fs := flag.NewFlagSet(cmd.Argv0+" "+argv0, flag.ExitOnError)
+	fs.StringVar(&typ, "type", "", "the type of the first database one of postgresql, sqlite3")
+	fs.StringVar(&dsn, "dsn", "", "the dsn for the first database")
+	fs.StringVar(&dbname, "db", "", "the first database to connect to")
+	fs.StringVar(&typ2, "type2", "", "the type of the second database one of postgresql, sqlite3")
+	fs.StringVar(&dsn2, "dsn2", "", "the dsn for the second database")
+	fs.StringVar(&dbname2, "db2", "", "the second database to connect to")
+	fs.Parse(args[1:])
+
+	a, err := openDBReadOnly(typ, dsn, dbname)
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s %s: %s\n", cmd.Argv0, argv0, err)
+		os.Exit(1)
+	}
+
+	defer a.Close()
+
+	b, err := openDBReadOnly(typ2, dsn2, dbname2)
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s %s: %s\n", cmd.Argv0, argv0, err)
+		os.Exit(1)
+	}
+
+	defer b.Close()
+
+	onlya, onlyb, err := mgrt.DiffApplied(a, b)
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s %s: failed to diff revisions: %s\n", cmd.Argv0, argv0, err)
+		os.Exit(1)
+	}
+
+	for _, rev := range onlya {
+		cmd.Printf("- %s: %s - %s\n", rev.Slug(), rev.Author, rev.PerformedAt.Format(time.ANSIC))
+	}
+
+	for _, rev := range onlyb {
+		cmd.Printf("+ %s: %s - %s\n", rev.Slug(), rev.Author, rev.PerformedAt.Format(time.ANSIC))
+	}
+}
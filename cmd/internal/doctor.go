@@ -0,0 +1,99 @@
+package internal
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/andrewpillar/mgrt/v3"
+)
+
+var DoctorCmd = &Command{
+	Usage: "doctor",
+	Short: "check that revisions can be performed against the database",
+	Long: `Doctor will check that revisions can be performed against the given database,
+before running them, so problems with a new environment are found early rather
+than part of the way through the revisions. Each check is displayed as it is
+made, and doctor stops at the first check that fails, displaying what needs to
+be done to fix it on stderr. If -quiet is given, then only the check that
+failed is displayed. The checks are,
+
+    the database can be connected to
+    the user can create and drop tables
+    the mgrt_revisions table can be read, or can be created
+
+The user's privileges are checked by creating and dropping a uniquely named
+table, and by creating the mgrt_revisions table if it does not exist, within a
+transaction that is rolled back. Nothing is left behind in the database, not
+even the mgrt_revisions table. Doctor exits with 1 if any of the checks fail.
+
+The database to connect to is specified via the -type and -dsn flags, or via
+the -db flag if a database connection has been configured via the "mgrt db"
+command.
+
+The -type flag specifies the type of database to connect to, it will be one of,
+
+    mysql
+    postgresql
+    sqlite3
+
+The -dsn flag specifies the data source name for the database. This will vary
+depending on the type of database you're connecting to. Environment variables
+referenced in the dsn, such as ${DB_PASSWORD}, will be expanded.`,
+	Run: doctorCmd,
+}
+
+// writeCheck writes the given check as an item in a checklist, along with the
+// given error if the check failed.
+func writeCheck(w io.Writer, check string, err error) {
+	if err != nil {
+		fmt.Fprintf(w, "[ ] %s: %s\n", check, err)
+		return
+	}
+	fmt.Fprintf(w, "[x] %s\n", check)
+}
+
+func doctorCmd(cmd *Command, args []string) {
+	argv0 := args[0]
+
+	var (
+		typ    string
+		dsn    string
+		dbname string
+	)
+
+	fs := flag.NewFlagSet(cmd.Argv0+" "+argv0, flag.ExitOnError)
+	fs.StringVar(&typ, "type", "", "the database type one of postgresql, sqlite3")
+	fs.StringVar(&dsn, "dsn", "", "the dsn for the database to check")
+	fs.StringVar(&dbname, "db", "", "the database to connect to")
+	fs.Parse(args[1:])
+
+	// A failed check is always displayed on stderr, the checks that pass are
+	// hidden if the command is quiet.
+	check := func(name string, err error) {
+		if err != nil {
+			writeCheck(os.Stderr, name, err)
+			return
+		}
+
+		if cmd.Verbosity != Quiet {
+			writeCheck(os.Stdout, name, nil)
+		}
+	}
+
+	// The database is opened lazily rather than as read-only, since the checks
+	// need to write to it, and connecting to it is the first check made.
+	db, err := openDBLazy(typ, dsn, dbname)
+
+	if err != nil {
+		check("database can be connected to", err)
+		os.Exit(ExitError)
+	}
+
+	defer db.Close()
+
+	if err := mgrt.PreflightFunc(db, check); err != nil {
+		os.Exit(ExitError)
+	}
+}
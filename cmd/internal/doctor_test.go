@@ -0,0 +1,28 @@
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func Test_WriteCheck(t *testing.T) {
+	tests := []struct {
+		check    string
+		err      error
+		expected string
+	}{
+		{"database can be connected to", nil, "[x] database can be connected to\n"},
+		{"user can create and drop tables", errors.New("permission denied"), "[ ] user can create and drop tables: permission denied\n"},
+	}
+
+	for i, test := range tests {
+		var buf bytes.Buffer
+
+		writeCheck(&buf, test.check, test.err)
+
+		if s := buf.String(); s != test.expected {
+			t.Errorf("tests[%d] - unexpected check, expected=%q, got=%q\n", i, test.expected, s)
+		}
+	}
+}
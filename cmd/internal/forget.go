@@ -0,0 +1,112 @@
+package internal
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/andrewpillar/mgrt/v3"
+)
+
+var ForgetCmd = &Command{
+	Usage: "forget [-yes] <revision>",
+	Short: "forget that a revision was performed",
+	Long: `Forget will delete the record of the given revision from the given database, so
+that it is no longer considered performed. The database to connect to is
+specified via the -type and -dsn flags, or via the -db flag if a database
+connection has been configured via the "mgrt db" command.
+
+Forget does not undo the SQL of the revision, it only changes what mgrt has
+recorded. This should only be used when the changes made by the revision have
+already been undone by other means, otherwise the revision will be performed
+again the next time revisions are run, which may fail, or worse, succeed.
+
+Before forgetting the revision, forget will ask for confirmation. The -yes flag
+will forget the revision without asking.
+
+The -type flag specifies the type of database to connect to, it will be one of,
+
+    mysql
+    postgresql
+    sqlite3
+
+The -dsn flag specifies the data source name for the database. This will vary
+depending on the type of database you're connecting to. Environment variables
+referenced in the dsn, such as ${DB_PASSWORD}, will be expanded.`,
+	Run: forgetCmd,
+}
+
+// confirm asks the given question, and reports whether the answer read from
+// the given io.Reader was yes.
+func confirm(r io.Reader, question string) bool {
+	fmt.Fprintf(os.Stderr, "%s [y/N] ", question)
+
+	line, _ := bufio.NewReader(r).ReadString('\n')
+
+	switch strings.ToLower(strings.TrimSpace(line)) {
+	case "y", "yes":
+		return true
+	}
+	return false
+}
+
+func forgetCmd(cmd *Command, args []string) {
+	argv0 := args[0]
+
+	var (
+		typ    string
+		dsn    string
+		dbname string
+		yes    bool
+	)
+
+	fs := flag.NewFlagSet(cmd.Argv0+" "+argv0, flag.ExitOnError)
+	fs.StringVar(&typ, "type", "", "the database type one of postgresql, sqlite3")
+	fs.StringVar(&dsn, "dsn", "", "the dsn for the database to forget the revision in")
+	fs.StringVar(&dbname, "db", "", "the database to connect to")
+	fs.BoolVar(&yes, "yes", false, "forget the revision without asking for confirmation")
+	fs.Parse(args[1:])
+
+	args = fs.Args()
+
+	if len(args) != 1 {
+		fmt.Fprintf(os.Stderr, "usage: %s %s [-yes] <revision>\n", cmd.Argv0, argv0)
+		os.Exit(ExitError)
+	}
+
+	id := args[0]
+
+	db, err := openDB(typ, dsn, dbname)
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s %s: %s\n", cmd.Argv0, argv0, err)
+		os.Exit(ExitError)
+	}
+
+	defer db.Close()
+
+	rev, err := mgrt.GetRevision(db, id)
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s %s: %s\n", cmd.Argv0, argv0, err)
+		os.Exit(ExitError)
+	}
+
+	if !yes {
+		question := "forget revision " + rev.Slug() + ": " + rev.Title() + "? Its SQL will not be undone"
+
+		if !confirm(os.Stdin, question) {
+			fmt.Fprintf(os.Stderr, "%s %s: revision not forgotten\n", cmd.Argv0, argv0)
+			os.Exit(ExitError)
+		}
+	}
+
+	if err := mgrt.ForgetRevision(db, rev.Slug()); err != nil {
+		fmt.Fprintf(os.Stderr, "%s %s: %s\n", cmd.Argv0, argv0, err)
+		os.Exit(ExitError)
+	}
+	cmd.Println("revision forgotten", rev.Slug())
+}
@@ -0,0 +1,120 @@
+package internal
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/andrewpillar/mgrt/v3"
+)
+
+var ImportCmd = &Command{
+	Usage: "import [-author author] [-c category] <dir>",
+	Short: "import a directory of raw SQL files as revisions",
+	Long: `Import will create a revision for each .sql file in the given directory. This
+is for adopting mgrt in a project that used another migration tool, where the
+SQL files have no mgrt comment block header.
+
+The files are imported in the order of their names. If the name of a file
+begins with a revision ID, such as 20060102150405_create_users.sql, then that
+is used as the ID of the revision, otherwise the modification time of the file
+is used. If this would result in an ID that is not after the previous revision,
+then the ID is moved forward a second at a time, so the order of the files is
+preserved. The rest of the name of the file, without any leading numbering, is
+used as the comment.
+
+The -author flag specifies the author of the revisions. If not given, then the
+name and email of the author are taken from the user.name and user.email git
+config properties, followed by the GIT_AUTHOR_NAME, GIT_AUTHOR_EMAIL, and EMAIL
+environment variables. If no name is found, then the current user is used.
+
+The -c flag specifies the category to put the revisions under.`,
+	Run: importCmd,
+}
+
+func importCmd(cmd *Command, args []string) {
+	argv0 := args[0]
+
+	var (
+		author   string
+		category string
+	)
+
+	fs := flag.NewFlagSet(cmd.Argv0+" "+argv0, flag.ExitOnError)
+	fs.StringVar(&author, "author", "", "the author of the revisions")
+	fs.StringVar(&category, "c", "", "the category to put the revisions under")
+	fs.Parse(args[1:])
+
+	args = fs.Args()
+
+	if len(args) != 1 {
+		fmt.Fprintf(os.Stderr, "usage: %s %s [-author author] [-c category] <dir>\n", cmd.Argv0, argv0)
+		os.Exit(1)
+	}
+
+	if author == "" {
+		var err error
+
+		author, err = resolveAuthor("", "")
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s %s: failed to get mgrt author: %s\n", cmd.Argv0, argv0, err)
+			os.Exit(1)
+		}
+	}
+
+	paths, err := filepath.Glob(filepath.Join(args[0], "*.sql"))
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s %s: %s\n", cmd.Argv0, argv0, err)
+		os.Exit(1)
+	}
+
+	sort.Strings(paths)
+
+	revs := make([]*mgrt.Revision, 0, len(paths))
+
+	var prev time.Time
+
+	for _, path := range paths {
+		rev, err := mgrt.ImportSQLFile(path, author)
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s %s: failed to import %s: %s\n", cmd.Argv0, argv0, path, err)
+			os.Exit(1)
+		}
+
+		t, err := time.Parse("20060102150405", rev.ID)
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s %s: failed to import %s: %s\n", cmd.Argv0, argv0, path, err)
+			os.Exit(1)
+		}
+
+		if !t.After(prev) && !prev.IsZero() {
+			t = prev.Add(time.Second)
+		}
+
+		prev = t
+
+		rev.ID = t.Format("20060102150405")
+		rev.Category = category
+
+		revs = append(revs, rev)
+	}
+
+	repo := mgrt.Repo{Dir: revisionsDir}
+
+	for i, rev := range revs {
+		path, err := repo.Add(rev)
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s %s: failed to import %s: %s\n", cmd.Argv0, argv0, paths[i], err)
+			os.Exit(1)
+		}
+		cmd.Println(paths[i], "->", path)
+	}
+}
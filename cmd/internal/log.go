@@ -1,9 +1,13 @@
 package internal
 
 import (
+	"encoding/csv"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
@@ -11,11 +15,42 @@ import (
 )
 
 var LogCmd = &Command{
-	Usage: "log",
+	Usage: "log [-n n] [-author author] [-version version] [-color mode] [-format format] [-sql]",
 	Short: "log the performed revisions",
 	Long: `Log displays all of the revisions that have been performed in the given
 database. The -n flag can be given to limit the number of revisions that are
-shown in the log. The database to connect to is specified via the -type and
+shown in the log. The -author flag can be given to only show the revisions by
+that author, this must match the author of the revisions exactly, for example,
+
+    -author "Andrew Pillar <me@andrewpillar.com>"
+
+The -version flag can be given to only show the revisions with that version, as
+set via the Version header of the revisions, for example -version v2.3.0.
+
+The -color flag specifies when the log is colorized, it will be one of,
+
+    auto
+    always
+    never
+
+by default this is auto, which colorizes the log only if it is displayed in a
+terminal, and the NO_COLOR environment variable is not set.
+
+The -format flag specifies how the log is displayed, it will be one of,
+
+    text
+    csv
+
+by default this is text. The csv format displays a header row, followed by a
+row for each revision with its id, author, comment, when it was performed as an
+RFC3339 timestamp, and how long it took to perform in milliseconds. This is for
+exporting the history of a database to a spreadsheet.
+
+The -sql flag includes the SQL of each revision, after its comment in the text
+format, or as the last column in the csv format. This is not included by
+default since it can make the output much larger.
+
+The database to connect to is specified via the -type and
 -dsn flags, or via the -db flag if a database connection has been configured
 via the "mgrt db" command.
 
@@ -26,7 +61,8 @@ The -type flag specifies the type of database to connect to, it will be one of,
     sqlite3
 
 The -dsn flag specifies the data source name for the database. This will vary
-depending on the type of database you're connecting to.
+depending on the type of database you're connecting to. Environment variables
+referenced in the dsn, such as ${DB_PASSWORD}, will be expanded.
 
 mysql and postgresql both allow for the URI connection string, such as,
 
@@ -43,6 +79,10 @@ sqlite3 however will accept a filepath, or the :memory: string, for example,
 	Run: logCmd,
 }
 
+// errLogDone stops the log once the number of revisions given via -n have been
+// shown.
+var errLogDone = errors.New("log done")
+
 func logCmd(cmd *Command, args []string) {
 	argv0 := args[0]
 
@@ -50,6 +90,11 @@ func logCmd(cmd *Command, args []string) {
 		typ    string
 		dsn    string
 		dbname string
+		author string
+		vers   string
+		color  string
+		format string
+		sql    bool
 		n      int
 	)
 
@@ -57,36 +102,27 @@ func logCmd(cmd *Command, args []string) {
 	fs.StringVar(&typ, "type", "", "the database type one of postgresql, sqlite3")
 	fs.StringVar(&dsn, "dsn", "", "the dsn for the database to run the revisions against")
 	fs.StringVar(&dbname, "db", "", "the database to connect to")
+	fs.StringVar(&author, "author", "", "only show revisions by the given author")
+	fs.StringVar(&vers, "version", "", "only show revisions with the given version")
 	fs.IntVar(&n, "n", 0, "the number of entries to show")
+	fs.StringVar(&color, "color", "auto", "when to colorize the log, one of auto, always, never")
+	fs.StringVar(&format, "format", "text", "the format to display the log in, one of text, csv")
+	fs.BoolVar(&sql, "sql", false, "include the sql of each revision")
 	fs.Parse(args[1:])
 
-	if dbname != "" {
-		it, err := getdbitem(dbname)
-
-		if err != nil {
-			if os.IsNotExist(err) {
-				fmt.Fprintf(os.Stderr, "%s %s: database %s does not exist\n", cmd.Argv0, argv0, dbname)
-				os.Exit(1)
-			}
-			fmt.Fprintf(os.Stderr, "%s %s: %s\n", cmd.Argv0, argv0, err)
-			os.Exit(1)
-		}
-
-		typ = it.Type
-		dsn = it.DSN
-	}
-
-	if typ == "" {
-		fmt.Fprintf(os.Stderr, "%s %s: database not specified\n", cmd.Argv0, argv0)
+	if format != "text" && format != "csv" {
+		fmt.Fprintf(os.Stderr, "%s %s: unknown format %s, must be one of text, csv\n", cmd.Argv0, argv0, format)
 		os.Exit(1)
 	}
 
-	if dsn == "" {
-		fmt.Fprintf(os.Stderr, "%s %s: database not specified\n", cmd.Argv0, argv0)
+	c, err := newColors(color, os.Stdout)
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s %s: %s\n", cmd.Argv0, argv0, err)
 		os.Exit(1)
 	}
 
-	db, err := mgrt.Open(typ, dsn)
+	db, err := openDBReadOnly(typ, dsn, dbname)
 
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%s %s: %s\n", cmd.Argv0, argv0, err)
@@ -95,24 +131,153 @@ func logCmd(cmd *Command, args []string) {
 
 	defer db.Close()
 
-	revs, err := mgrt.GetRevisions(db, n)
+	// The connection has already been checked, so if the mgrt_revisions table
+	// cannot be queried, then no revisions have been performed yet.
+	if err := checkRevisionsTable(db); err != nil {
+		if cmd.Verbosity != Quiet {
+			fmt.Fprintf(os.Stderr, "%s %s: warning: no revisions have been performed: %s\n", cmd.Argv0, argv0, err)
+		}
+		return
+	}
 
-	if err != nil {
+	if author != "" && vers != "" {
+		fmt.Fprintf(os.Stderr, "%s %s: cannot use -author with -version\n", cmd.Argv0, argv0)
+		os.Exit(1)
+	}
+
+	var w io.Writer = os.Stdout
+
+	if cmd.Verbosity == Quiet {
+		w = io.Discard
+	}
+
+	cw := csv.NewWriter(w)
+
+	if format == "csv" {
+		cw.Write(logCSVHeader(sql))
+	}
+
+	shown := 0
+
+	show := func(rev *mgrt.Revision) error {
+		if format == "csv" {
+			if err := cw.Write(logCSVRecord(rev, sql)); err != nil {
+				return err
+			}
+		} else {
+			cmd.Printf("%s", formatRevision(rev, c, sql))
+		}
+		shown++
+
+		if n > 0 && shown >= n {
+			return errLogDone
+		}
+		return nil
+	}
+
+	var revs []*mgrt.Revision
+
+	switch {
+	case author != "":
+		if revs, err = mgrt.GetRevisionsByAuthor(db, author, n); err == nil {
+			err = eachRevision(revs, show)
+		}
+	case vers != "":
+		if revs, err = mgrt.GetRevisionsByVersion(db, vers, n); err == nil {
+			err = eachRevision(revs, show)
+		}
+	default:
+		err = mgrt.GetRevisionsFunc(db, show)
+	}
+
+	if err != nil && err != errLogDone {
 		fmt.Fprintf(os.Stderr, "%s %s: failed to get revisions: %s\n", cmd.Argv0, argv0, err)
 		os.Exit(1)
 	}
 
+	cw.Flush()
+
+	if err := cw.Error(); err != nil {
+		fmt.Fprintf(os.Stderr, "%s %s: %s\n", cmd.Argv0, argv0, err)
+		os.Exit(1)
+	}
+}
+
+// eachRevision calls the given function for each of the given revisions,
+// stopping at the first error.
+func eachRevision(revs []*mgrt.Revision, fn func(*mgrt.Revision) error) error {
 	for _, rev := range revs {
-		fmt.Println("revision", rev.Slug())
-		fmt.Println("Author:    ", rev.Author)
-		fmt.Println("Performed: ", rev.PerformedAt.Format(time.ANSIC))
-		fmt.Println()
+		if err := fn(rev); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// logCSVHeader returns the header row of the csv format of the log. If sql is
+// true, then this includes the sql column.
+func logCSVHeader(sql bool) []string {
+	header := []string{"id", "author", "comment", "performed_at", "duration_ms"}
 
-		lines := strings.Split(rev.Comment, "\n")
+	if sql {
+		header = append(header, "sql")
+	}
+	return header
+}
+
+// logCSVRecord returns the row for the given performed revision in the csv
+// format of the log. If sql is true, then the SQL of the revision is the last
+// column.
+func logCSVRecord(rev *mgrt.Revision, sql bool) []string {
+	record := []string{
+		rev.Slug(),
+		rev.Author,
+		rev.Comment,
+		rev.PerformedAt.Format(time.RFC3339),
+		strconv.FormatInt(rev.Duration.Milliseconds(), 10),
+	}
+
+	if sql {
+		record = append(record, rev.SQL)
+	}
+	return record
+}
+
+// formatRevision formats the given performed revision for display, colorized
+// via the given colors. If sql is true, then the SQL of the revision follows
+// its comment.
+func formatRevision(rev *mgrt.Revision, c colors, sql bool) string {
+	var buf strings.Builder
+
+	buf.WriteString("revision " + c.revision(rev.Slug()) + "\n")
+	buf.WriteString(c.label("Author:") + "     " + rev.Author + "\n")
+
+	performed := rev.PerformedAt.Format(time.ANSIC)
+
+	if rev.Duration > 0 {
+		performed += " (took " + rev.Duration.String() + ")"
+	}
+	buf.WriteString(c.label("Performed:") + "  " + performed + "\n")
+
+	if rev.PerformedBy != "" {
+		buf.WriteString(c.label("Performed by:") + " " + rev.PerformedBy + "\n")
+	}
+
+	if rev.Version != "" {
+		buf.WriteString(c.label("Version:") + "    " + rev.Version + "\n")
+	}
+	buf.WriteString("\n")
+
+	for _, line := range strings.Split(rev.Comment, "\n") {
+		buf.WriteString("    " + line + "\n")
+	}
+	buf.WriteString("\n")
 
-		for _, line := range lines {
-			fmt.Println("   ", line)
+	if sql {
+		for _, line := range strings.Split(rev.SQL, "\n") {
+			buf.WriteString("    " + c.dim(line) + "\n")
 		}
-		fmt.Println()
+		buf.WriteString("\n")
 	}
+	return buf.String()
 }
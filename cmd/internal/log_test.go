@@ -0,0 +1,82 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/csv"
+	"testing"
+	"time"
+
+	"github.com/andrewpillar/mgrt/v3"
+)
+
+func Test_LogCSV(t *testing.T) {
+	performedAt := time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)
+
+	revs := []*mgrt.Revision{
+		{
+			ID:          "20060102150405",
+			Author:      "Andrew Pillar <me@andrewpillar.com>",
+			Comment:     "Add users table",
+			SQL:         "CREATE TABLE users ( id INT );",
+			PerformedAt: performedAt,
+			Duration:    1500 * time.Millisecond,
+		},
+		{
+			ID:          "20060102150406",
+			Category:    "perms",
+			Author:      "Andrew",
+			Comment:     "Grant \"select\", and insert\n\nOn users",
+			SQL:         "GRANT SELECT, INSERT ON users TO app;",
+			PerformedAt: performedAt,
+		},
+	}
+
+	tests := []struct {
+		sql      bool
+		expected string
+	}{
+		{
+			false,
+			"id,author,comment,performed_at,duration_ms\n" +
+				"20060102150405,Andrew Pillar <me@andrewpillar.com>,Add users table,2006-01-02T15:04:05Z,1500\n" +
+				"perms/20060102150406,Andrew,\"Grant \"\"select\"\", and insert\n\nOn users\",2006-01-02T15:04:05Z,0\n",
+		},
+		{
+			true,
+			"id,author,comment,performed_at,duration_ms,sql\n" +
+				"20060102150405,Andrew Pillar <me@andrewpillar.com>,Add users table,2006-01-02T15:04:05Z,1500,CREATE TABLE users ( id INT );\n" +
+				"perms/20060102150406,Andrew,\"Grant \"\"select\"\", and insert\n\nOn users\",2006-01-02T15:04:05Z,0,\"GRANT SELECT, INSERT ON users TO app;\"\n",
+		},
+	}
+
+	for i, test := range tests {
+		var buf bytes.Buffer
+
+		w := csv.NewWriter(&buf)
+		w.Write(logCSVHeader(test.sql))
+
+		for _, rev := range revs {
+			w.Write(logCSVRecord(rev, test.sql))
+		}
+
+		w.Flush()
+
+		if err := w.Error(); err != nil {
+			t.Fatal(err)
+		}
+
+		if s := buf.String(); s != test.expected {
+			t.Errorf("tests[%d] - unexpected csv, expected=\n%s\ngot=\n%s\n", i, test.expected, s)
+		}
+
+		records, err := csv.NewReader(&buf).ReadAll()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if records[2][2] != revs[1].Comment {
+			t.Errorf("tests[%d] - unexpected comment, expected=%q, got=%q\n", i, revs[1].Comment, records[2][2])
+		}
+	}
+}
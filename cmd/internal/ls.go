@@ -3,7 +3,6 @@ package internal
 import (
 	"fmt"
 	"os"
-	"path/filepath"
 
 	"github.com/andrewpillar/mgrt/v3"
 )
@@ -15,6 +14,14 @@ var LsCmd = &Command{
 	Run:   lsCmd,
 }
 
+// loadRevisions walks the given directory and opens every revision within it,
+// including those in categories. The revisions are opened lazily, so only their
+// headers are read.
+func loadRevisions(dir string) ([]*mgrt.Revision, error) {
+	repo := mgrt.Repo{Dir: dir}
+	return repo.Load()
+}
+
 func lsCmd(cmd *Command, args []string) {
 	info, err := os.Stat(revisionsDir)
 
@@ -32,43 +39,26 @@ func lsCmd(cmd *Command, args []string) {
 		os.Exit(1)
 	}
 
-	pad := 0
-
-	revs := make([]*mgrt.Revision, 0)
-
-	err = filepath.Walk(revisionsDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-
-		if info.IsDir() {
-			return nil
-		}
+	revs, err := loadRevisions(revisionsDir)
 
-		rev, err := mgrt.OpenRevision(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s %s: failed to list revision: %s\n", cmd.Argv0, args[0], err)
+		os.Exit(1)
+	}
 
-		if err != nil {
-			return err
-		}
+	pad := 0
 
-		if l := len(rev.Author); l > pad {
+	for _, r := range revs {
+		if l := len(r.Author); l > pad {
 			pad = l
 		}
-
-		revs = append(revs, rev)
-		return nil
-	})
-
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "%s %s: failed to list revision: %s\n", cmd.Argv0, args[0], err)
-		os.Exit(1)
 	}
 
 	for _, r := range revs {
 		if r.Comment != "" {
-			fmt.Printf("%s: %-*s - %s\n", r.Slug(), pad, r.Author, r.Title())
+			cmd.Printf("%s: %-*s - %s\n", r.Slug(), pad, r.Author, r.Title())
 			continue
 		}
-		fmt.Printf("%s: %s\n", r.Slug(), r.Author)
+		cmd.Printf("%s: %s\n", r.Slug(), r.Author)
 	}
 }
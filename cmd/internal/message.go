@@ -0,0 +1,40 @@
+package internal
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// readMessage reads the comment for a new revision from the file at the given
+// path, or from the given io.Reader if the path is "-". The comment is taken
+// verbatim, except for leading and trailing whitespace, which would otherwise
+// be lost when the revision is parsed. A line of the comment cannot end with
+// */, since this would end the comment block header of the revision early.
+func readMessage(path string, stdin io.Reader) (string, error) {
+	var (
+		b   []byte
+		err error
+	)
+
+	if path == "-" {
+		b, err = io.ReadAll(stdin)
+	} else {
+		b, err = os.ReadFile(path)
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	msg := strings.TrimSpace(string(b))
+
+	for _, line := range strings.Split(msg, "\n") {
+		if strings.HasSuffix(strings.TrimRightFunc(line, unicode.IsSpace), "*/") {
+			return "", errors.New("message cannot have a line ending in */")
+		}
+	}
+	return msg, nil
+}
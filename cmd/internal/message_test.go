@@ -0,0 +1,67 @@
+package internal
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/andrewpillar/mgrt/v3"
+)
+
+func Test_ReadMessage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mgrt-message-*")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	msg := `Add the users table
+
+This adds the "users" table, which replaces the 'accounts' table.
+
+    Author: not a header
+    - id is now the primary key`
+
+	path := filepath.Join(dir, "message")
+
+	if err := ioutil.WriteFile(path, []byte("\n"+msg+"\n\n"), os.FileMode(0644)); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, src := range []string{path, "-"} {
+		comment, err := readMessage(src, strings.NewReader(msg+"\n"))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if comment != msg {
+			t.Fatalf("unexpected message, expected=%q, got=%q\n", msg, comment)
+		}
+
+		rev := mgrt.NewRevision("Andrew", comment)
+		rev.SQL = "CREATE TABLE users ( id INT NOT NULL UNIQUE );"
+
+		parsed, err := mgrt.UnmarshalRevision(strings.NewReader(rev.String()))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if parsed.Comment != msg {
+			t.Errorf("unexpected comment, expected=%q, got=%q\n", msg, parsed.Comment)
+		}
+
+		if parsed.SQL != rev.SQL {
+			t.Errorf("unexpected sql, expected=%q, got=%q\n", rev.SQL, parsed.SQL)
+		}
+	}
+
+	if _, err := readMessage("-", strings.NewReader("Add users\n\n/* old */\n")); err == nil {
+		t.Errorf("expected error for message with a line ending in */")
+	}
+}
@@ -0,0 +1,174 @@
+package internal
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/andrewpillar/mgrt/v3"
+)
+
+var PlanCmd = &Command{
+	Usage: "plan [-c category]",
+	Short: "show the revisions that run would perform",
+	Long: `Plan will show the local revisions that have not yet been performed in the
+given database, in the order that run would perform them, along with whether
+each would be performed inside of a transaction. Nothing is written to the
+database, not even the mgrt_revisions table, so this is safe to run before
+deciding whether to run the revisions. The database to connect to is specified
+via the -type and -dsn flags, or via the -db flag if a database connection has
+been configured via the "mgrt db" command.
+
+Plan exits with 0 if there is nothing to perform, with 2 if there are revisions
+to perform, and with 1 if an error occurs. This can be used to gate a manual
+approval step before running the revisions.
+
+The -c flag specifies the category of revisions to plan, the same as for run.
+
+The -type flag specifies the type of database to connect to, it will be one of,
+
+    mysql
+    postgresql
+    sqlite3
+
+The -dsn flag specifies the data source name for the database. This will vary
+depending on the type of database you're connecting to. Environment variables
+referenced in the dsn, such as ${DB_PASSWORD}, will be expanded.`,
+	Run: planCmd,
+}
+
+// writePlan writes each of the given revisions on a numbered line, along with
+// whether it is performed inside of a transaction, and whether it is
+// recorded. The revisions are expected to be in the order they would be
+// performed.
+func writePlan(w io.Writer, revs []*mgrt.Revision) error {
+	if len(revs) == 0 {
+		_, err := fmt.Fprintln(w, "nothing to perform, database is up to date")
+		return err
+	}
+
+	if _, err := fmt.Fprintf(w, "%d revision(s) to perform:\n", len(revs)); err != nil {
+		return err
+	}
+
+	for i, rev := range revs {
+		tx := "transaction"
+
+		if rev.NoTransaction {
+			tx = "no transaction"
+		}
+
+		if rev.NoRecord {
+			tx += ", not recorded"
+		}
+
+		if _, err := fmt.Fprintf(w, "%4d. %s: %s (%s)\n", i+1, rev.Slug(), rev.Title(), tx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func planCmd(cmd *Command, args []string) {
+	argv0 := args[0]
+
+	var (
+		typ      string
+		dsn      string
+		dbname   string
+		category string
+	)
+
+	fs := flag.NewFlagSet(cmd.Argv0+" "+argv0, flag.ExitOnError)
+	fs.StringVar(&typ, "type", "", "the database type one of postgresql, sqlite3")
+	fs.StringVar(&dsn, "dsn", "", "the dsn for the database to plan the revisions against")
+	fs.StringVar(&dbname, "db", "", "the database to connect to")
+	fs.StringVar(&category, "c", "", "the category of revisions to plan")
+	fs.Parse(args[1:])
+
+	dir := revisionsDir
+
+	if category != "" {
+		dir = filepath.Join(revisionsDir, category)
+	}
+
+	local := make([]*mgrt.Revision, 0)
+
+	ents, err := os.ReadDir(dir)
+
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Fprintf(os.Stderr, "%s %s: failed to load revisions: %s\n", cmd.Argv0, argv0, err)
+		os.Exit(ExitError)
+	}
+
+	for _, ent := range ents {
+		if ent.IsDir() {
+			continue
+		}
+
+		rev, err := mgrt.OpenRevisionLazy(filepath.Join(dir, ent.Name()))
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s %s: failed to load revisions: %s\n", cmd.Argv0, argv0, err)
+			os.Exit(ExitError)
+		}
+
+		if category != "" && rev.Category != category {
+			continue
+		}
+		local = append(local, rev)
+	}
+
+	db, err := openDBReadOnly(typ, dsn, dbname)
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s %s: %s\n", cmd.Argv0, argv0, err)
+		os.Exit(ExitError)
+	}
+
+	defer db.Close()
+
+	var pending []*mgrt.Revision
+
+	// The connection has already been checked, so if the mgrt_revisions table
+	// cannot be queried, then no revisions have been performed yet.
+	if err := checkRevisionsTable(db); err != nil {
+		if cmd.Verbosity != Quiet {
+			fmt.Fprintf(os.Stderr, "%s %s: warning: no revisions have been performed: %s\n", cmd.Argv0, argv0, err)
+		}
+
+		var c mgrt.Collection
+
+		for _, rev := range local {
+			if err := c.Put(rev); err != nil {
+				fmt.Fprintf(os.Stderr, "%s %s: %s\n", cmd.Argv0, argv0, err)
+				os.Exit(ExitError)
+			}
+		}
+		pending = c.Slice()
+	} else {
+		pending, err = mgrt.PendingRevisions(db, local)
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s %s: failed to get pending revisions: %s\n", cmd.Argv0, argv0, err)
+			os.Exit(ExitError)
+		}
+	}
+
+	var w io.Writer = os.Stdout
+
+	if cmd.Verbosity == Quiet {
+		w = io.Discard
+	}
+
+	if err := writePlan(w, pending); err != nil {
+		fmt.Fprintf(os.Stderr, "%s %s: %s\n", cmd.Argv0, argv0, err)
+		os.Exit(ExitError)
+	}
+
+	if len(pending) > 0 {
+		os.Exit(ExitPending)
+	}
+}
@@ -0,0 +1,42 @@
+package internal
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/andrewpillar/mgrt/v3"
+)
+
+func Test_WritePlan(t *testing.T) {
+	revs := []*mgrt.Revision{
+		{ID: "20060102150405", Comment: "Add users table"},
+		{ID: "20060102150406", Category: "perms", Comment: "Index users by email", NoTransaction: true},
+		{ID: "20060102150407", Comment: "Refresh totals", NoRecord: true},
+	}
+
+	tests := []struct {
+		revs     []*mgrt.Revision
+		expected string
+	}{
+		{
+			revs,
+			"3 revision(s) to perform:\n" +
+				"   1. 20060102150405: Add users table (transaction)\n" +
+				"   2. perms/20060102150406: Index users by email (no transaction)\n" +
+				"   3. 20060102150407: Refresh totals (transaction, not recorded)\n",
+		},
+		{nil, "nothing to perform, database is up to date\n"},
+	}
+
+	for i, test := range tests {
+		var buf bytes.Buffer
+
+		if err := writePlan(&buf, test.revs); err != nil {
+			t.Fatal(err)
+		}
+
+		if s := buf.String(); s != test.expected {
+			t.Errorf("tests[%d] - unexpected plan, expected=\n%s\ngot=\n%s\n", i, test.expected, s)
+		}
+	}
+}
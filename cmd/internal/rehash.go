@@ -0,0 +1,65 @@
+package internal
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/andrewpillar/mgrt/v3"
+)
+
+var RehashCmd = &Command{
+	Usage: "rehash",
+	Short: "record the hashes of revisions performed without one",
+	Long: `Rehash will record the hash of each revision in the given database that was
+performed before mgrt recorded hashes. The hash is computed from the author and
+SQL that were recorded when the revision was performed, so no revisions are run.
+This allows for changes to these revisions to be detected. Rehash is safe to run
+repeatedly. The database to connect to is specified via the -type and -dsn
+flags, or via the -db flag if a database connection has been configured via the
+"mgrt db" command.
+
+The -type flag specifies the type of database to connect to, it will be one of,
+
+    mysql
+    postgresql
+    sqlite3
+
+The -dsn flag specifies the data source name for the database. This will vary
+depending on the type of database you're connecting to. Environment variables
+referenced in the dsn, such as ${DB_PASSWORD}, will be expanded.`,
+	Run: rehashCmd,
+}
+
+func rehashCmd(cmd *Command, args []string) {
+	argv0 := args[0]
+
+	var (
+		typ    string
+		dsn    string
+		dbname string
+	)
+
+	fs := flag.NewFlagSet(cmd.Argv0+" "+argv0, flag.ExitOnError)
+	fs.StringVar(&typ, "type", "", "the database type one of postgresql, sqlite3")
+	fs.StringVar(&dsn, "dsn", "", "the dsn for the database to rehash the revisions of")
+	fs.StringVar(&dbname, "db", "", "the database to connect to")
+	fs.Parse(args[1:])
+
+	db, err := openDB(typ, dsn, dbname)
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s %s: %s\n", cmd.Argv0, argv0, err)
+		os.Exit(1)
+	}
+
+	defer db.Close()
+
+	n, err := mgrt.BackfillHashes(db)
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s %s: failed to rehash revisions: %s\n", cmd.Argv0, argv0, err)
+		os.Exit(1)
+	}
+	cmd.Println("revisions rehashed", n)
+}
@@ -0,0 +1,100 @@
+package internal
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/andrewpillar/mgrt/v3"
+)
+
+var RmCmd = &Command{
+	Usage: "rm [-force] <revision>",
+	Short: "remove a revision that has not been performed",
+	Long: `Rm will remove the given local revision. Before removing the revision, rm will
+check that it has not been performed in the given database, and will refuse to
+remove it if it has. The database to connect to is specified via the -type and
+-dsn flags, or via the -db flag if a database connection has been configured via
+the "mgrt db" command.
+
+The revision may be prefixed with its category, otherwise the categories are
+searched for it. Gzip compressed revisions are removed too.
+
+The -force flag will remove the revision without checking the database.
+
+The -type flag specifies the type of database to connect to, it will be one of,
+
+    mysql
+    postgresql
+    sqlite3
+
+The -dsn flag specifies the data source name for the database. This will vary
+depending on the type of database you're connecting to. Environment variables
+referenced in the dsn, such as ${DB_PASSWORD}, will be expanded.`,
+	Run: rmCmd,
+}
+
+func rmCmd(cmd *Command, args []string) {
+	argv0 := args[0]
+
+	var (
+		typ    string
+		dsn    string
+		dbname string
+		force  bool
+	)
+
+	fs := flag.NewFlagSet(cmd.Argv0+" "+argv0, flag.ExitOnError)
+	fs.StringVar(&typ, "type", "", "the database type one of postgresql, sqlite3")
+	fs.StringVar(&dsn, "dsn", "", "the dsn for the database to check the revision against")
+	fs.StringVar(&dbname, "db", "", "the database to connect to")
+	fs.BoolVar(&force, "force", false, "remove the revision without checking the database")
+	fs.Parse(args[1:])
+
+	args = fs.Args()
+
+	if len(args) != 1 {
+		fmt.Fprintf(os.Stderr, "usage: %s %s [-force] <revision>\n", cmd.Argv0, argv0)
+		os.Exit(1)
+	}
+
+	id := args[0]
+
+	repo := mgrt.Repo{Dir: revisionsDir}
+
+	rev, err := repo.Find(id)
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s %s: failed to open revision %s: %s\n", cmd.Argv0, argv0, id, err)
+		os.Exit(1)
+	}
+
+	if !force {
+		db, err := openDB(typ, dsn, dbname)
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s %s: %s\n", cmd.Argv0, argv0, err)
+			os.Exit(1)
+		}
+
+		err = mgrt.RevisionPerformed(db, rev)
+		db.Close()
+
+		if err != nil {
+			if errors.Is(err, mgrt.ErrPerformed) {
+				fmt.Fprintf(os.Stderr, "%s %s: refusing to remove %s, it has been performed, use -force to remove it anyway\n", cmd.Argv0, argv0, rev.Slug())
+				os.Exit(1)
+			}
+
+			fmt.Fprintf(os.Stderr, "%s %s: %s\n", cmd.Argv0, argv0, err)
+			os.Exit(1)
+		}
+	}
+
+	if err := repo.Remove(id); err != nil {
+		fmt.Fprintf(os.Stderr, "%s %s: %s\n", cmd.Argv0, argv0, err)
+		os.Exit(1)
+	}
+	cmd.Println("revision removed", rev.Slug())
+}
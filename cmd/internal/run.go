@@ -1,23 +1,89 @@
 package internal
 
 import (
+	"bytes"
+	"database/sql"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/andrewpillar/mgrt/v3"
 )
 
 var RunCmd = &Command{
-	Usage: "run <revisions,...>",
+	Usage: "run [-strict] [-var key=value] [-lock-timeout duration] [-dump-schema cmd] [-schema-file file] <revisions,...|urls,...|archives,...|->",
 	Short: "run the given revisions",
-	Long: `Run will perform the given revisions against the given database. The database
-to connect to is specified via the -type and -dsn flags, or via the -db flag if a database
-connection has been configured via the "mgrt db" command.
-
-The -c flag specifies the category of revisions to run. If not given, then the
-default revisions will be run.
+	Long: `Run will perform the given revisions against the given database. If - is given
+as the only revision, then the revisions will be read from stdin. Each revision
+in stdin begins with its comment block header, so multiple revision files can
+be piped in at once, for example,
+
+    cat revisions/*.sql | mgrt run -type sqlite3 -dsn acme.db -
+
+A revision can also be given as an http or https URL, in which case it is
+fetched from there. The revision must be fetched within 30 seconds, and cannot
+be larger than 10MB.
+
+Revisions can also be given as a .tar.gz, .tgz, .tar, or .zip archive, in which
+case each .sql file in the archive is run. Run exits with 1 if any of the files
+in the archive are not valid revisions.
+
+The database to connect to is specified via the -type and -dsn flags, or via
+the -db flag if a database connection has been configured via the "mgrt db"
+command.
+
+Run displays each revision as it is performed, or skipped if it has already
+been performed, along with how many of the revisions are done.
+
+Run exits with 0 once the revisions have been performed, including when they
+had already been performed, and with 1 if an error occurs. If all of the
+revisions had already been performed, then run displays that the database is up
+to date.
+
+The -c flag, or -category, specifies the category of revisions to run. If not
+given, then the default revisions will be run. When revisions are given
+explicitly, or read from stdin, only those in the category will be run, unless
+the -to flag is given.
+
+The -to flag specifies the ID of the last revision to run. Revisions after it
+will not be run. If the revision is in a category, then the ID should be
+prefixed with the category, for example -to users/20060102150405.
+
+The -strict flag checks each revision that has already been performed against
+the hash that was recorded when it was performed. If a revision has changed
+since it was performed, then run exits with 1, rather than skipping it.
+
+The -var flag sets a variable in the SQL of the revisions, and can be given
+multiple times. When given, the SQL of each revision is rendered as a Go
+template, so {{.Schema}} would be replaced with the value of the Schema
+variable, and the rendered SQL is what is recorded. A revision that references
+a variable that is not set fails. The variables are substituted verbatim, so
+should only be used for values you control, such as the names of schemas.
+
+The -lock-timeout flag has run take the lock for performing revisions, so that
+only one run performs revisions against the database at a time, such as when
+multiple CI jobs run at once. If the lock is held by another run, then this is
+how long to wait for it to be released, for example 5m. If zero, or if the lock
+is still held once the timeout has passed, then run exits with 1, reporting
+that another migration is in progress. The lock expires after the duration
+given via the -lock-ttl flag, 10m by default, in case the run holding it dies,
+so this should be longer than the revisions take to perform. Giving -lock-ttl
+on its own also has run take the lock, without waiting for it.
+
+The -dump-schema flag specifies a command to run once the revisions have been
+performed successfully, the output of which is written to the file given via
+the -schema-file flag, schema.sql by default. The command is run via sh, with
+the same environment as mgrt, for example,
+
+    -dump-schema 'pg_dump --schema-only "$DATABASE_URL"'
+
+The command is not run if any of the revisions fail. If the command fails, then
+the schema file is left as is, and run exits with 1.
 
 The -type flag specifies the type of database to connect to, it will be one of,
 
@@ -26,7 +92,8 @@ The -type flag specifies the type of database to connect to, it will be one of,
     sqlite3
 
 The -dsn flag specifies the data source name for the database. This will vary
-depending on the type of database you're connecting to.
+depending on the type of database you're connecting to. Environment variables
+referenced in the dsn, such as ${DB_PASSWORD}, will be expanded.
 
 mysql and postgresql both allow for the URI connection string, such as,
 
@@ -44,22 +111,6 @@ sqlite3 however will accept a filepath, or the :memory: string, for example,
 }
 
 func runCmd(cmd *Command, args []string) {
-	info, err := os.Stat(revisionsDir)
-
-	if err != nil {
-		if os.IsNotExist(err) {
-			return
-		}
-
-		fmt.Fprintf(os.Stderr, "%s %s: failed to run revisions: %s\n", cmd.Argv0, args[0], err)
-		os.Exit(1)
-	}
-
-	if !info.IsDir() {
-		fmt.Fprintf(os.Stderr, "%s %s: %s is not a directory\n", cmd.Argv0, args[0], revisionsDir)
-		os.Exit(1)
-	}
-
 	argv0 := args[0]
 
 	var (
@@ -67,51 +118,144 @@ func runCmd(cmd *Command, args []string) {
 		dsn      string
 		category string
 		dbname   string
+		to       string
+		dump     string
+		schema   string
+		strict   bool
 		verbose  bool
+
+		lockTTL     time.Duration
+		lockTimeout time.Duration
 	)
 
+	vars := make(templateVars)
+
 	fs := flag.NewFlagSet(cmd.Argv0+" "+argv0, flag.ExitOnError)
 	fs.StringVar(&typ, "type", "", "the database type one of postgresql, sqlite3")
 	fs.StringVar(&dsn, "dsn", "", "the dsn for the database to run the revisions against")
 	fs.StringVar(&category, "c", "", "the category of revisions to run")
+	fs.StringVar(&category, "category", "", "the category of revisions to run")
 	fs.StringVar(&dbname, "db", "", "the database to connect to")
+	fs.StringVar(&to, "to", "", "the id of the last revision to run")
+	fs.BoolVar(&strict, "strict", false, "fail if a performed revision has changed")
+	fs.Var(vars, "var", "set a variable in the sql of the revisions")
+	fs.DurationVar(&lockTimeout, "lock-timeout", 0, "how long to wait for the lock if another run holds it")
+	fs.DurationVar(&lockTTL, "lock-ttl", defaultLockTTL, "how long the lock is held for before it expires")
+	fs.StringVar(&dump, "dump-schema", "", "the command to dump the schema with once the revisions are performed")
+	fs.StringVar(&schema, "schema-file", "schema.sql", "the file to write the dumped schema to")
 	fs.BoolVar(&verbose, "v", false, "display information about the revisions performed")
 	fs.Parse(args[1:])
 
-	if dbname != "" {
-		it, err := getdbitem(dbname)
+	lock := false
 
-		if err != nil {
-			if os.IsNotExist(err) {
-				fmt.Fprintf(os.Stderr, "%s %s: database %s does not exist\n", cmd.Argv0, argv0, dbname)
-				os.Exit(1)
-			}
-			fmt.Fprintf(os.Stderr, "%s %s: %s\n", cmd.Argv0, argv0, err)
-			os.Exit(1)
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "lock-timeout" || f.Name == "lock-ttl" {
+			lock = true
 		}
+	})
 
-		typ = it.Type
-		dsn = it.DSN
+	if !lock {
+		lockTTL = 0
 	}
 
-	if typ == "" {
-		fmt.Fprintf(os.Stderr, "%s %s: database not specified\n", cmd.Argv0, argv0)
-		os.Exit(1)
+	opts := runOptions{
+		typ:      typ,
+		dsn:      dsn,
+		dbname:   dbname,
+		category: category,
+		to:       to,
+		verbose:  verbose,
+		migrator: mgrt.Migrator{
+			Logger:        cmd.Logger(),
+			LogStatements: cmd.Verbosity >= Verbose,
+			Strict:        strict,
+			LockTTL:       lockTTL,
+			LockTimeout:   lockTimeout,
+			OnProgress: func(done, total int, rev *mgrt.Revision) {
+				cmd.Printf("[%d/%d] %s: %s\n", done, total, rev.Slug(), rev.Title())
+			},
+		},
 	}
 
-	if dsn == "" {
-		fmt.Fprintf(os.Stderr, "%s %s: database not specified\n", cmd.Argv0, argv0)
-		os.Exit(1)
+	if dump != "" {
+		opts.migrator.AfterBatch = dumpSchema(dump, schema)
+	}
+
+	if len(vars) > 0 {
+		opts.migrator.Vars = vars
 	}
 
 	revs := make([]*mgrt.Revision, 0)
 
+	if ids := fs.Args(); len(ids) == 1 && ids[0] == "-" {
+		revs, err := mgrt.UnmarshalRevisions(os.Stdin)
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s %s: failed to read revisions from stdin: %s\n", cmd.Argv0, argv0, err)
+			os.Exit(ExitError)
+		}
+
+		performRevisions(cmd, argv0, opts, revs)
+		return
+	}
+
+	ids := make([]string, 0, len(fs.Args()))
+
 	for _, id := range fs.Args() {
+		if isArchive(id) {
+			c, err := mgrt.LoadRevisionsArchive(id)
+
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s %s: failed to load revisions: %s\n", cmd.Argv0, argv0, err)
+				os.Exit(ExitError)
+			}
+			revs = append(revs, c.Slice()...)
+			continue
+		}
+
+		if !strings.HasPrefix(id, "http://") && !strings.HasPrefix(id, "https://") {
+			ids = append(ids, id)
+			continue
+		}
+
+		rev, err := mgrt.OpenRevisionURL(id)
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s %s: failed to open revision: %s\n", cmd.Argv0, argv0, err)
+			os.Exit(ExitError)
+		}
+		revs = append(revs, rev)
+	}
+
+	if len(revs) > 0 && len(ids) == 0 {
+		performRevisions(cmd, argv0, opts, revs)
+		return
+	}
+
+	info, err := os.Stat(revisionsDir)
+
+	if err != nil {
+		// Nothing to run unless revisions were given by their IDs, which
+		// cannot be opened without the directory.
+		if os.IsNotExist(err) && len(ids) == 0 {
+			return
+		}
+
+		fmt.Fprintf(os.Stderr, "%s %s: failed to run revisions: %s\n", cmd.Argv0, argv0, err)
+		os.Exit(ExitError)
+	}
+
+	if !info.IsDir() {
+		fmt.Fprintf(os.Stderr, "%s %s: %s is not a directory\n", cmd.Argv0, argv0, revisionsDir)
+		os.Exit(ExitError)
+	}
+
+	for _, id := range ids {
 		rev, err := mgrt.OpenRevision(revisionPath(id))
 
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "%s %s: failed to open revision %s: %s\n", cmd.Argv0, argv0, id, err)
-			os.Exit(1)
+			os.Exit(ExitError)
 		}
 		revs = append(revs, rev)
 	}
@@ -127,7 +271,7 @@ func runCmd(cmd *Command, args []string) {
 
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "%s %s: %s\n", cmd.Argv0, argv0, err)
-			os.Exit(1)
+			os.Exit(ExitError)
 		}
 
 		for _, ent := range ents {
@@ -139,30 +283,105 @@ func runCmd(cmd *Command, args []string) {
 
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "%s %s: %s\n", cmd.Argv0, argv0, err)
-				os.Exit(1)
+				os.Exit(ExitError)
 			}
 			revs = append(revs, rev)
 		}
 	}
+	performRevisions(cmd, argv0, opts, revs)
+}
+
+// isArchive reports whether the given revision argument is an archive of
+// revisions, to be loaded via mgrt.LoadRevisionsArchive.
+func isArchive(arg string) bool {
+	for _, ext := range []string{".tar.gz", ".tgz", ".tar", ".zip"} {
+		if strings.HasSuffix(arg, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// dumpSchema returns a function for Migrator.AfterBatch that runs the given
+// command via sh, and writes its output to the given file. The file is only
+// written if the command succeeds.
+func dumpSchema(command, file string) func(*sql.DB) error {
+	return func(*sql.DB) error {
+		var buf bytes.Buffer
+
+		cmd := exec.Command("sh", "-c", command)
+		cmd.Stdout = &buf
+		cmd.Stderr = os.Stderr
+
+		if err := cmd.Run(); err != nil {
+			return errors.New("failed to dump schema: " + err.Error())
+		}
+		return os.WriteFile(file, buf.Bytes(), os.FileMode(0644))
+	}
+}
 
-	db, err := mgrt.Open(typ, dsn)
+// defaultLockTTL is how long the lock is held for by run before it expires,
+// if no -lock-ttl is given.
+const defaultLockTTL = 10 * time.Minute
+
+// runOptions is how run performs the revisions, as given via its flags. The
+// database to perform the revisions against is opened via openDB, and set on
+// the configured migrator.
+type runOptions struct {
+	typ      string
+	dsn      string
+	dbname   string
+	category string
+	to       string
+	verbose  bool
+	migrator mgrt.Migrator
+}
+
+func performRevisions(cmd *Command, argv0 string, opts runOptions, revs []*mgrt.Revision) {
+	db, err := openDB(opts.typ, opts.dsn, opts.dbname)
 
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%s %s: %s\n", cmd.Argv0, argv0, err)
-		os.Exit(1)
+		os.Exit(ExitError)
 	}
 
 	defer db.Close()
 
-	if err := mgrt.PerformRevisions(db, revs...); err != nil {
-		if _, ok := err.(mgrt.Errors); ok {
-			if verbose {
+	m := opts.migrator
+	m.DB = db
+
+	perform := m.PerformRevisions
+
+	if opts.category != "" {
+		perform = func(revs ...*mgrt.Revision) error {
+			return m.PerformRevisionsCategory(opts.category, revs...)
+		}
+	}
+
+	if opts.to != "" {
+		perform = func(revs ...*mgrt.Revision) error {
+			return m.PerformRevisionsTo(opts.to, revs...)
+		}
+	}
+
+	if err := perform(revs...); err != nil {
+		if mgrt.IsAllPerformed(err) {
+			if opts.verbose || cmd.Verbosity >= Verbose {
 				fmt.Fprintf(os.Stderr, "%s", err)
 			}
+
+			if errors.Is(err, mgrt.ErrNoPending) {
+				cmd.Println("database is up to date")
+			}
 			return
 		}
 
+		if errors.Is(err, mgrt.ErrLocked) {
+			fmt.Fprintf(os.Stderr, "%s %s: another migration is in progress: %s\n", cmd.Argv0, argv0, err)
+			os.Exit(ExitError)
+		}
+
 		fmt.Fprintf(os.Stderr, "%s %s: %s\n", cmd.Argv0, argv0, err)
-		os.Exit(1)
+		os.Exit(ExitError)
 	}
 }
@@ -4,20 +4,27 @@ import (
 	"flag"
 	"fmt"
 	"os"
-	"strings"
-	"time"
 
 	"github.com/andrewpillar/mgrt/v3"
 )
 
 var ShowCmd = &Command{
-	Usage: "show [revision]",
+	Usage: "show [-raw] [-color mode] [revision]",
 	Short: "show the given revision",
-	Long:  `Show will show the SQL that was run in the given revision. If no revision is
+	Long: `Show will show the SQL that was run in the given revision. If no revision is
 specified, then the latest revision will be shown, if any. The database to connect to is
 specified via the -type and -dsn flags, or via the -db flag if a database connection has
 been configured via the "mgrt db" command.
 
+The -raw flag will print the revision exactly as it was recorded when it was
+performed, in the same format as a revision file. This can be compared against
+the local revision, which may have changed since.
+
+The -color flag specifies when the revision is colorized, it will be one of
+auto, always, or never. By default this is auto, which colorizes the revision
+only if it is displayed in a terminal, and the NO_COLOR environment variable is
+not set. The SQL of the revision is dimmed. This has no effect with -raw.
+
 The -type flag specifies the type of database to connect to, it will be one of,
 
     mysql
@@ -25,7 +32,8 @@ The -type flag specifies the type of database to connect to, it will be one of,
     sqlite3
 
 The -dsn flag specifies the data source name for the database. This will vary
-depending on the type of database you're connecting to.
+depending on the type of database you're connecting to. Environment variables
+referenced in the dsn, such as ${DB_PASSWORD}, will be expanded.
 
 mysql and postgresql both allow for the URI connection string, such as,
 
@@ -49,41 +57,26 @@ func showCmd(cmd *Command, args []string) {
 		typ    string
 		dsn    string
 		dbname string
+		color  string
+		raw    bool
 	)
 
 	fs := flag.NewFlagSet(cmd.Argv0+" "+argv0, flag.ExitOnError)
 	fs.StringVar(&typ, "type", "", "the database type one of postgresql, sqlite3")
 	fs.StringVar(&dsn, "dsn", "", "the dsn for the database to run the revisions against")
 	fs.StringVar(&dbname, "db", "", "the database to connect to")
+	fs.BoolVar(&raw, "raw", false, "print the revision as it was recorded")
+	fs.StringVar(&color, "color", "auto", "when to colorize the revision, one of auto, always, never")
 	fs.Parse(args[1:])
 
-	if dbname != "" {
-		it, err := getdbitem(dbname)
-
-		if err != nil {
-			if os.IsNotExist(err) {
-				fmt.Fprintf(os.Stderr, "%s %s: database %s does not exist\n", cmd.Argv0, argv0, dbname)
-				os.Exit(1)
-			}
-			fmt.Fprintf(os.Stderr, "%s %s: %s\n", cmd.Argv0, argv0, err)
-			os.Exit(1)
-		}
-
-		typ = it.Type
-		dsn = it.DSN
-	}
-
-	if typ == "" {
-		fmt.Fprintf(os.Stderr, "%s %s: database not specified\n", cmd.Argv0, argv0)
-		os.Exit(1)
-	}
+	c, err := newColors(color, os.Stdout)
 
-	if dsn == "" {
-		fmt.Fprintf(os.Stderr, "%s %s: database not specified\n", cmd.Argv0, argv0)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s %s: %s\n", cmd.Argv0, argv0, err)
 		os.Exit(1)
 	}
 
-	db, err := mgrt.Open(typ, dsn)
+	db, err := openDBReadOnly(typ, dsn, dbname)
 
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%s %s: %s\n", cmd.Argv0, argv0, err)
@@ -92,6 +85,13 @@ func showCmd(cmd *Command, args []string) {
 
 	defer db.Close()
 
+	// The connection has already been checked, so if the mgrt_revisions table
+	// cannot be queried, then no revisions have been performed yet.
+	if err := checkRevisionsTable(db); err != nil {
+		fmt.Fprintf(os.Stderr, "%s %s: no revisions have been performed: %s\n", cmd.Argv0, argv0, err)
+		os.Exit(1)
+	}
+
 	args = fs.Args()
 
 	var rev *mgrt.Revision
@@ -112,25 +112,18 @@ func showCmd(cmd *Command, args []string) {
 			fmt.Fprintf(os.Stderr, "%s %s: failed to show revision: %s\n", cmd.Argv0, argv0, err)
 			os.Exit(1)
 		}
+
+		if len(revs) == 0 {
+			fmt.Fprintf(os.Stderr, "%s %s: no revisions have been performed\n", cmd.Argv0, argv0)
+			os.Exit(1)
+		}
 		rev = revs[0]
 	}
 
-	fmt.Println("revision", rev.ID)
-	fmt.Println("Author:    ", rev.Author)
-	fmt.Println("Performed: ", rev.PerformedAt.Format(time.ANSIC))
-	fmt.Println()
-
-	lines := strings.Split(rev.Comment, "\n")
-
-	for _, line := range lines {
-		fmt.Println("   ", line)
+	if raw {
+		cmd.Println(rev.String())
+		return
 	}
-	fmt.Println()
 
-	lines = strings.Split(rev.SQL, "\n")
-
-	for _, line := range lines {
-		fmt.Println("   ", line)
-	}
-	fmt.Println()
+	cmd.Printf("%s", formatRevision(rev, c, true))
 }
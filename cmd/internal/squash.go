@@ -0,0 +1,259 @@
+package internal
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/andrewpillar/mgrt/v3"
+)
+
+var SquashCmd = &Command{
+	Usage: "squash [-c category] [-superseded dir] [-force] <from> <to>",
+	Short: "squash a range of revisions into one",
+	Long: `Squash will collapse the revisions from <from> up to and including <to> into a
+single revision. The SQL of each revision is concatenated in ascending order,
+and the comment of the new revision lists the revisions that were squashed.
+
+The squashed revision takes the ID of <to>, so databases that have already had
+the original revisions performed against them will not perform it again. The
+squashed revision is written before the original revisions in the range are
+removed, since they are superseded by the squashed revision.
+
+Since the squashed revision has the ID of <to>, a database that has performed
+some but not all of the revisions in the range would perform the ones it has
+already performed again. Before squashing, squash will check the given
+database, and will refuse to squash if only part of the range has been
+performed in it. Nothing is written to the database. A database that has
+performed <to> will report the squashed revision as changed when verified, and
+sync will not overwrite it without -force. The database to check is specified
+via the -type and -dsn flags, or via the -db flag if a database connection has
+been configured via the "mgrt db" command.
+
+The -force flag will squash the revisions without checking the database.
+
+The -c flag specifies the category of the revisions to squash.
+
+The -superseded flag specifies a directory to move the original revisions to,
+rather than removing them. This should be outside of the revisions directory,
+otherwise they would still be performed.
+
+The -type flag specifies the type of database to connect to, it will be one of,
+
+    mysql
+    postgresql
+    sqlite3
+
+The -dsn flag specifies the data source name for the database. This will vary
+depending on the type of database you're connecting to. Environment variables
+referenced in the dsn, such as ${DB_PASSWORD}, will be expanded.`,
+	Run: squashCmd,
+}
+
+func squashCmd(cmd *Command, args []string) {
+	argv0 := args[0]
+
+	var (
+		typ        string
+		dsn        string
+		dbname     string
+		category   string
+		superseded string
+		force      bool
+	)
+
+	fs := flag.NewFlagSet(cmd.Argv0+" "+argv0, flag.ExitOnError)
+	fs.StringVar(&category, "c", "", "the category of the revisions to squash")
+	fs.StringVar(&superseded, "superseded", "", "the directory to move the squashed revisions to")
+	fs.StringVar(&typ, "type", "", "the database type one of postgresql, sqlite3")
+	fs.StringVar(&dsn, "dsn", "", "the dsn for the database to check the revisions against")
+	fs.StringVar(&dbname, "db", "", "the database to connect to")
+	fs.BoolVar(&force, "force", false, "squash the revisions without checking the database")
+	fs.Parse(args[1:])
+
+	args = fs.Args()
+
+	if len(args) != 2 {
+		fmt.Fprintf(os.Stderr, "usage: %s %s [-c category] [-superseded dir] [-force] <from> <to>\n", cmd.Argv0, argv0)
+		os.Exit(1)
+	}
+
+	from, to := args[0], args[1]
+
+	if from > to {
+		from, to = to, from
+	}
+
+	dir := revisionsDir
+
+	if category != "" {
+		dir = filepath.Join(revisionsDir, category)
+	}
+
+	ents, err := os.ReadDir(dir)
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s %s: %s\n", cmd.Argv0, argv0, err)
+		os.Exit(1)
+	}
+
+	var (
+		revs     []*mgrt.Revision
+		squashed []*mgrt.Revision
+		paths    []string
+	)
+
+	for _, ent := range ents {
+		if ent.IsDir() {
+			continue
+		}
+
+		path := filepath.Join(dir, ent.Name())
+
+		rev, err := mgrt.OpenRevision(path)
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s %s: failed to open revision: %s\n", cmd.Argv0, argv0, err)
+			os.Exit(1)
+		}
+
+		revs = append(revs, rev)
+
+		if rev.ID >= from && rev.ID <= to {
+			squashed = append(squashed, rev)
+			paths = append(paths, path)
+		}
+	}
+
+	if category != "" {
+		from = category + "/" + from
+		to = category + "/" + to
+	}
+
+	rev, err := mgrt.Squash(revs, from, to)
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s %s: failed to squash revisions: %s\n", cmd.Argv0, argv0, err)
+		os.Exit(1)
+	}
+
+	if !force {
+		db, err := openDBReadOnly(typ, dsn, dbname)
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s %s: %s\n", cmd.Argv0, argv0, err)
+			os.Exit(1)
+		}
+
+		performed, err := performedRevisions(db, squashed)
+		db.Close()
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s %s: %s\n", cmd.Argv0, argv0, err)
+			os.Exit(1)
+		}
+
+		if len(performed) > 0 && len(performed) < len(squashed) {
+			fmt.Fprintf(os.Stderr, "%s %s: refusing to squash, only part of the range has been performed, use -force to squash anyway\n", cmd.Argv0, argv0)
+
+			for _, rev := range performed {
+				fmt.Fprintf(os.Stderr, "    %s\n", rev.Slug())
+			}
+			os.Exit(1)
+		}
+	}
+
+	target := filepath.Join(dir, rev.ID+".sql")
+
+	tmp, err := writeSquash(dir, rev)
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s %s: failed to create revision: %s\n", cmd.Argv0, argv0, err)
+		os.Exit(1)
+	}
+
+	// The originals are only moved or removed once the squashed revision has
+	// been written, so they are not lost if writing it fails.
+	if superseded != "" {
+		if err := os.MkdirAll(superseded, os.FileMode(0755)); err != nil {
+			os.Remove(tmp)
+			fmt.Fprintf(os.Stderr, "%s %s: %s\n", cmd.Argv0, argv0, err)
+			os.Exit(1)
+		}
+
+		for _, path := range paths {
+			if err := os.Rename(path, filepath.Join(superseded, filepath.Base(path))); err != nil {
+				os.Remove(tmp)
+				fmt.Fprintf(os.Stderr, "%s %s: %s\n", cmd.Argv0, argv0, err)
+				os.Exit(1)
+			}
+		}
+	}
+
+	if err := os.Rename(tmp, target); err != nil {
+		os.Remove(tmp)
+		fmt.Fprintf(os.Stderr, "%s %s: failed to create revision: %s\n", cmd.Argv0, argv0, err)
+		os.Exit(1)
+	}
+
+	if superseded == "" {
+		for _, path := range paths {
+			if path == target {
+				continue
+			}
+
+			if err := os.Remove(path); err != nil {
+				fmt.Fprintf(os.Stderr, "%s %s: %s\n", cmd.Argv0, argv0, err)
+				os.Exit(1)
+			}
+		}
+	}
+
+	cmd.Println("revision squashed", rev.Slug())
+}
+
+// performedRevisions returns the given revisions that have been performed in
+// the given database. If the mgrt_revisions table does not exist, then none of
+// them have been performed.
+func performedRevisions(db *mgrt.DB, revs []*mgrt.Revision) ([]*mgrt.Revision, error) {
+	performed := make([]*mgrt.Revision, 0, len(revs))
+
+	if err := checkRevisionsTable(db); err != nil {
+		return performed, nil
+	}
+
+	for _, rev := range revs {
+		if err := mgrt.RevisionPerformed(db, rev); err != nil {
+			if !errors.Is(err, mgrt.ErrPerformed) {
+				return nil, err
+			}
+			performed = append(performed, rev)
+		}
+	}
+	return performed, nil
+}
+
+// writeSquash writes the given squashed revision to a temporary file in the
+// given directory, and returns the path to the file, so it can be renamed into
+// place once written.
+func writeSquash(dir string, rev *mgrt.Revision) (string, error) {
+	f, err := os.CreateTemp(dir, ".squash-*")
+
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := rev.WriteTo(f); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", err
+	}
+
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
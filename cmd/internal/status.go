@@ -0,0 +1,402 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/andrewpillar/mgrt/v3"
+)
+
+var StatusCmd = &Command{
+	Usage: "status [-format format] [-ignore-missing=false] [-all] [-concurrency n]",
+	Short: "show which local revisions have been performed",
+	Long: `Status will show each of the local revisions, and whether or not it has been
+performed in the given database. A warning is displayed for any pending revision
+that is older than the newest revision performed in the same category, since
+performing it would interleave it with changes that have already been made. A
+warning is also displayed for any revision that has been performed, but has no
+local revision, such as one performed from another branch. The database to
+connect to is specified via the -type and -dsn flags, or via the -db flag if a
+database connection has been configured via the "mgrt db" command.
+
+Status exits with 0 if all of the local revisions have been performed, with 2 if
+any are pending, and with 1 if an error occurs.
+
+The -ignore-missing flag specifies whether a revision that has been performed,
+but has no local revision, is only warned about. This is true by default, so
+such revisions do not affect how status exits. If -ignore-missing=false is
+given, then these revisions are treated as an error, and status exits with 1.
+
+The -format flag specifies how the status is displayed, it will be one of,
+
+    text
+    json
+    table
+
+by default this is text, which displays each revision on a line, prefixed with
+whether it has been performed or is pending. The json format displays an array
+of objects, each with the id, category, and title of the revision, whether it
+has been applied, and when it was performed, which is null if it has not been.
+The table format displays the revisions in aligned columns.
+
+Multiple databases can be checked at once by giving a comma separated list of
+databases to the -db flag, or via the -all flag to check every database
+configured via "mgrt db". The databases are checked concurrently, and a summary
+of each is displayed, rather than each revision. An error with one database
+does not stop the others from being checked. Status exits with 1 if an error
+occurred for any of the databases, otherwise with 2 if any have pending
+revisions.
+
+The -concurrency flag specifies how many databases to check at once, 8 by
+default.
+
+The -type flag specifies the type of database to connect to, it will be one of,
+
+    mysql
+    postgresql
+    sqlite3
+
+The -dsn flag specifies the data source name for the database. This will vary
+depending on the type of database you're connecting to. Environment variables
+referenced in the dsn, such as ${DB_PASSWORD}, will be expanded.`,
+	Run: statusCmd,
+}
+
+func statusCmd(cmd *Command, args []string) {
+	argv0 := args[0]
+
+	var (
+		typ           string
+		dsn           string
+		dbname        string
+		format        string
+		all           bool
+		ignoreMissing bool
+		n             int
+	)
+
+	fs := flag.NewFlagSet(cmd.Argv0+" "+argv0, flag.ExitOnError)
+	fs.StringVar(&typ, "type", "", "the database type one of postgresql, sqlite3")
+	fs.StringVar(&dsn, "dsn", "", "the dsn for the database to check the revisions against")
+	fs.StringVar(&dbname, "db", "", "the database to connect to")
+	fs.BoolVar(&all, "all", false, "check all of the configured databases")
+	fs.IntVar(&n, "concurrency", mgrt.DefaultConcurrency, "the number of databases to check at once")
+	fs.BoolVar(&ignoreMissing, "ignore-missing", true, "only warn about performed revisions with no local revision")
+	fs.StringVar(&format, "format", "text", "the format to display the status in, one of text, json, table")
+	fs.Parse(args[1:])
+
+	local, err := loadRevisions(revisionsDir)
+
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Fprintf(os.Stderr, "%s %s: failed to load revisions: %s\n", cmd.Argv0, argv0, err)
+		os.Exit(ExitError)
+	}
+
+	fmtStatus, ok := statusFormats[format]
+
+	if !ok {
+		fmt.Fprintf(os.Stderr, "%s %s: unknown format %s, must be one of text, json, table\n", cmd.Argv0, argv0, format)
+		os.Exit(ExitError)
+	}
+
+	if all || strings.Contains(dbname, ",") {
+		if format != "text" {
+			fmt.Fprintf(os.Stderr, "%s %s: cannot use -format with multiple databases\n", cmd.Argv0, argv0)
+			os.Exit(ExitError)
+		}
+
+		statusAll(cmd, argv0, dbname, all, n, local)
+		return
+	}
+
+	db, err := openDBReadOnly(typ, dsn, dbname)
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s %s: %s\n", cmd.Argv0, argv0, err)
+		os.Exit(ExitError)
+	}
+
+	defer db.Close()
+
+	var (
+		pending     []*mgrt.Revision
+		outOfOrder  []*mgrt.Revision
+		orphaned    []*mgrt.Revision
+		performedAt = make(map[string]time.Time)
+	)
+
+	// The connection has already been checked, so if the mgrt_revisions table
+	// cannot be queried, then no revisions have been performed yet.
+	if err := checkRevisionsTable(db); err != nil {
+		if cmd.Verbosity != Quiet {
+			fmt.Fprintf(os.Stderr, "%s %s: warning: no revisions have been performed: %s\n", cmd.Argv0, argv0, err)
+		}
+		pending = local
+	} else {
+		pending, err = mgrt.PendingRevisions(db, local)
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s %s: failed to get pending revisions: %s\n", cmd.Argv0, argv0, err)
+			os.Exit(ExitError)
+		}
+
+		outOfOrder, err = mgrt.AuditOrder(db, local)
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s %s: failed to audit revisions: %s\n", cmd.Argv0, argv0, err)
+			os.Exit(ExitError)
+		}
+
+		ids := make([]string, 0, len(local))
+
+		for _, rev := range local {
+			ids = append(ids, rev.Slug())
+		}
+
+		orphaned, err = mgrt.OrphanedRevisions(db, ids, mgrt.IgnoreMissing(ignoreMissing))
+
+		if err != nil && !errors.Is(err, mgrt.ErrMissing) {
+			fmt.Fprintf(os.Stderr, "%s %s: failed to get orphaned revisions: %s\n", cmd.Argv0, argv0, err)
+			os.Exit(ExitError)
+		}
+
+		err = mgrt.GetRevisionsFunc(db, func(rev *mgrt.Revision) error {
+			performedAt[rev.Slug()] = rev.PerformedAt
+			return nil
+		})
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s %s: failed to get revisions: %s\n", cmd.Argv0, argv0, err)
+			os.Exit(ExitError)
+		}
+	}
+
+	set := make(map[string]struct{}, len(pending))
+
+	for _, rev := range pending {
+		set[rev.Slug()] = struct{}{}
+	}
+
+	var c mgrt.Collection
+
+	for _, rev := range local {
+		c.Put(rev)
+	}
+
+	entries := make([]statusEntry, 0, c.Len())
+
+	for _, rev := range c.Slice() {
+		ent := statusEntry{
+			ID:       rev.ID,
+			Category: rev.Category,
+			Title:    rev.Title(),
+		}
+
+		if _, ok := set[rev.Slug()]; !ok {
+			ent.Applied = true
+
+			if t, ok := performedAt[rev.Slug()]; ok {
+				ent.PerformedAt = &t
+			}
+		}
+		entries = append(entries, ent)
+	}
+
+	var w io.Writer = os.Stdout
+
+	if cmd.Verbosity == Quiet {
+		w = io.Discard
+	}
+
+	if err := fmtStatus(w, entries); err != nil {
+		fmt.Fprintf(os.Stderr, "%s %s: %s\n", cmd.Argv0, argv0, err)
+		os.Exit(ExitError)
+	}
+
+	for _, rev := range outOfOrder {
+		if cmd.Verbosity == Quiet {
+			break
+		}
+		fmt.Fprintf(os.Stderr, "%s %s: warning: %s is pending but older than the newest performed revision\n", cmd.Argv0, argv0, rev.Slug())
+	}
+
+	for _, rev := range orphaned {
+		if !ignoreMissing {
+			fmt.Fprintf(os.Stderr, "%s %s: %s is performed but has no local revision, run sync to create it\n", cmd.Argv0, argv0, rev.Slug())
+			continue
+		}
+
+		if cmd.Verbosity == Quiet {
+			break
+		}
+		fmt.Fprintf(os.Stderr, "%s %s: warning: %s is performed but has no local revision, run sync to create it\n", cmd.Argv0, argv0, rev.Slug())
+	}
+
+	if !ignoreMissing && len(orphaned) > 0 {
+		os.Exit(ExitError)
+	}
+
+	if len(pending) > 0 {
+		os.Exit(ExitPending)
+	}
+}
+
+// statusAll displays a summary of the status of the local revisions against
+// each of the given comma separated databases, or against all of the
+// configured databases.
+func statusAll(cmd *Command, argv0, dbnames string, all bool, concurrency int, local []*mgrt.Revision) {
+	var items []dbItem
+
+	if all {
+		var err error
+
+		items, err = getdbitems()
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s %s: %s\n", cmd.Argv0, argv0, err)
+			os.Exit(ExitError)
+		}
+	} else {
+		for _, name := range strings.Split(dbnames, ",") {
+			if name == "" {
+				continue
+			}
+			items = append(items, dbItem{Name: name})
+		}
+	}
+
+	dbs := make([]mgrt.DBItem, 0, len(items))
+	errs := make(map[string]error)
+
+	for _, it := range items {
+		typ, dsn, err := resolveDB(it.Type, it.DSN, it.Name)
+
+		if err == nil {
+			dsn, err = mgrt.ExpandDSN(dsn)
+		}
+
+		if err != nil {
+			errs[it.Name] = err
+		}
+
+		dbs = append(dbs, mgrt.DBItem{
+			Name: it.Name,
+			Type: typ,
+			DSN:  dsn,
+		})
+	}
+
+	statuses, err := mgrt.StatusAll(dbs, local, concurrency)
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s %s: %s\n", cmd.Argv0, argv0, err)
+		os.Exit(ExitError)
+	}
+
+	code := 0
+
+	for _, st := range statuses {
+		if err, ok := errs[st.Name]; ok {
+			st.Err = err
+		}
+
+		if st.Err != nil {
+			fmt.Fprintf(os.Stderr, "%s %s: %s: %s\n", cmd.Argv0, argv0, st.Name, st.Err)
+			code = ExitError
+			continue
+		}
+
+		if len(st.Pending) > 0 {
+			if code == 0 {
+				code = ExitPending
+			}
+			cmd.Printf("%s: %d pending\n", st.Name, len(st.Pending))
+			continue
+		}
+		cmd.Printf("%s: up to date\n", st.Name)
+	}
+
+	if code != 0 {
+		os.Exit(code)
+	}
+}
+
+// statusEntry is the status of a single local revision, as displayed by
+// status.
+type statusEntry struct {
+	ID          string     `json:"id"`
+	Category    string     `json:"category"`
+	Title       string     `json:"title"`
+	Applied     bool       `json:"applied"`
+	PerformedAt *time.Time `json:"performed_at"`
+}
+
+// statusFormats are the formats the status can be displayed in via the
+// -format flag.
+var statusFormats = map[string]func(io.Writer, []statusEntry) error{
+	"text":  statusText,
+	"json":  statusJSON,
+	"table": statusTable,
+}
+
+// statusText writes each entry on a line, prefixed with whether it has been
+// performed or is pending.
+func statusText(w io.Writer, entries []statusEntry) error {
+	for _, ent := range entries {
+		state := "performed"
+
+		if !ent.Applied {
+			state = "pending  "
+		}
+
+		if _, err := fmt.Fprintf(w, "%s %s: %s\n", state, ent.slug(), ent.Title); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// statusJSON writes the entries as a JSON array. The time each entry was
+// performed is formatted via RFC3339.
+func statusJSON(w io.Writer, entries []statusEntry) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "    ")
+	return enc.Encode(entries)
+}
+
+// statusTable writes the entries in aligned columns, marking those that have
+// been applied with a check.
+func statusTable(w io.Writer, entries []statusEntry) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "REVISION\tAPPLIED\tPERFORMED AT\tTITLE")
+
+	for _, ent := range entries {
+		applied := "\u2717"
+		performed := ""
+
+		if ent.Applied {
+			applied = "\u2713"
+		}
+
+		if ent.PerformedAt != nil {
+			performed = ent.PerformedAt.Format("2006-01-02 15:04:05")
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", ent.slug(), applied, performed, ent.Title)
+	}
+	return tw.Flush()
+}
+
+func (e statusEntry) slug() string {
+	if e.Category != "" {
+		return e.Category + "/" + e.ID
+	}
+	return e.ID
+}
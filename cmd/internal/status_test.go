@@ -0,0 +1,75 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_StatusFormats(t *testing.T) {
+	performedAt := time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)
+
+	entries := []statusEntry{
+		{ID: "20060102150405", Title: "Add users table", Applied: true, PerformedAt: &performedAt},
+		{ID: "20060102150406", Category: "perms", Title: "Grant select on users", Applied: false},
+	}
+
+	tests := []struct {
+		format   string
+		expected string
+	}{
+		{
+			"text",
+			"performed 20060102150405: Add users table\n" +
+				"pending   perms/20060102150406: Grant select on users\n",
+		},
+		{
+			"table",
+			"REVISION              APPLIED  PERFORMED AT         TITLE\n" +
+				"20060102150405        ✓        2006-01-02 15:04:05  Add users table\n" +
+				"perms/20060102150406  ✗                             Grant select on users\n",
+		},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+
+		if err := statusFormats[test.format](&buf, entries); err != nil {
+			t.Fatal(err)
+		}
+
+		if buf.String() != test.expected {
+			t.Errorf("%s - unexpected output, expected=\n%s\ngot=\n%s\n", test.format, test.expected, buf.String())
+		}
+	}
+
+	var buf bytes.Buffer
+
+	if err := statusFormats["json"](&buf, entries); err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded []map[string]interface{}
+
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(decoded) != 2 {
+		t.Fatalf("unexpected entries, expected=%d, got=%d\n", 2, len(decoded))
+	}
+
+	if decoded[0]["id"] != "20060102150405" || decoded[0]["applied"] != true || decoded[0]["performed_at"] != "2006-01-02T15:04:05Z" {
+		t.Errorf("unexpected entry, got=%v\n", decoded[0])
+	}
+
+	if decoded[1]["category"] != "perms" || decoded[1]["applied"] != false || decoded[1]["performed_at"] != nil {
+		t.Errorf("unexpected entry, got=%v\n", decoded[1])
+	}
+
+	if !strings.Contains(buf.String(), `"performed_at": null`) {
+		t.Errorf("expected null performed_at, got=\n%s\n", buf.String())
+	}
+}
@@ -1,22 +1,74 @@
 package internal
 
 import (
+	"bytes"
+	"compress/gzip"
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 
 	"github.com/andrewpillar/mgrt/v3"
 )
 
+type syncState int
+
+// syncItem is a revision from the database that is to be synced to the given
+// path.
+type syncItem struct {
+	rev   *mgrt.Revision
+	path  string
+	state syncState
+}
+
+const (
+	syncCreate    syncState = iota // the local revision does not exist
+	syncUpdate                     // the local revision differs
+	syncUnchanged                  // the local revision is the same
+)
+
+// String returns the name of the state as displayed by the -dry-run flag.
+func (s syncState) String() string {
+	switch s {
+	case syncCreate:
+		return "create"
+	case syncUpdate:
+		return "update"
+	default:
+		return "unchanged"
+	}
+}
+
 var SyncCmd = &Command{
-	Usage: "sync <-type type> <-dsn dsn>",
+	Usage: "sync [-out dir|-dump file] [-gzip] [-force] [-dry-run] <-type type> <-dsn dsn>",
 	Short: "sync the performed revisions",
 	Long: `Sync will update the local revisions with what has been performed in the
-database. Doing this will overwrite any pre-existing revisions you may have
-locally. The database to connect to is specified via the -type and -dsn flags,
-or via the -db flag if a database connection has been configured via the "mgrt db"
-command.
+database. If a local revision differs from what was performed in the database,
+then sync will refuse to overwrite it, and will list the revisions that would
+change. The -force flag can be given to overwrite these revisions. The -out flag
+can be given to write the revisions to a directory other than the revisions
+directory, which allows for the revisions of a database to be exported without
+touching the local revisions. The -dump flag can be given to instead write all
+of the revisions to a single file, in the order they were performed, which can
+be performed against another database via "mgrt run -". The -gzip flag will
+gzip compress the revisions that are written. The database to connect to is
+specified via the -type and -dsn flags, or via the -db flag if a database
+connection has been configured via the "mgrt db" command.
+
+The -dry-run flag displays what sync would do to each local revision, without
+writing anything. Each revision is displayed on a line with its path, prefixed
+with create if the file does not exist, update if the file differs from the
+database, or unchanged if the file is the same, for example,
+
+    create revisions/20060102150405.sql
+    update revisions/perms/20060102150406.sql
+
+The lines are sorted by path, so the output can be compared, or searched via
+grep. Once reviewed, sync can be run again without -dry-run, and with -force if
+any files would be updated.
 
 The -type flag specifies the type of database to connect to, it will be one of,
 
@@ -25,7 +77,8 @@ The -type flag specifies the type of database to connect to, it will be one of,
     sqlite3
 
 The -dsn flag specifies the data source name for the database. This will vary
-depending on the type of database you're connecting to.
+depending on the type of database you're connecting to. Environment variables
+referenced in the dsn, such as ${DB_PASSWORD}, will be expanded.
 
 mysql and postgresql both allow for the URI connection string, such as,
 
@@ -49,84 +102,242 @@ func syncCmd(cmd *Command, args []string) {
 		typ    string
 		dsn    string
 		dbname string
+		out    string
+		dump   string
+		force  bool
+		gz     bool
+		dryRun bool
 	)
 
 	fs := flag.NewFlagSet(cmd.Argv0+" "+argv0, flag.ExitOnError)
 	fs.StringVar(&typ, "type", "", "the database type one of postgresql, sqlite3")
 	fs.StringVar(&dsn, "dsn", "", "the dsn for the database to run the revisions against")
 	fs.StringVar(&dbname, "db", "", "the database to connect to")
+	fs.StringVar(&out, "out", revisionsDir, "the directory to write the revisions to")
+	fs.StringVar(&dump, "dump", "", "the file to write all of the revisions to")
+	fs.BoolVar(&gz, "gzip", false, "gzip compress the revisions that are written")
+	fs.BoolVar(&force, "force", false, "overwrite local revisions that differ from the database")
+	fs.BoolVar(&dryRun, "dry-run", false, "display what would be written, without writing anything")
 	fs.Parse(args[1:])
 
-	if dbname != "" {
-		it, err := getdbitem(dbname)
+	if dryRun && dump != "" {
+		fmt.Fprintf(os.Stderr, "%s %s: cannot use -dry-run with -dump\n", cmd.Argv0, argv0)
+		os.Exit(1)
+	}
+
+	db, err := openDBReadOnly(typ, dsn, dbname)
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s %s: %s\n", cmd.Argv0, argv0, err)
+		os.Exit(1)
+	}
+
+	defer db.Close()
+
+	// The connection has already been checked, so if the mgrt_revisions table
+	// cannot be queried, then no revisions have been performed yet.
+	if err := checkRevisionsTable(db); err != nil {
+		if cmd.Verbosity != Quiet {
+			fmt.Fprintf(os.Stderr, "%s %s: warning: no revisions have been performed: %s\n", cmd.Argv0, argv0, err)
+		}
+		return
+	}
+
+	if dump != "" {
+		revs, err := mgrt.GetRevisionsAsc(db, -1)
 
 		if err != nil {
-			if os.IsNotExist(err) {
-				fmt.Fprintf(os.Stderr, "%s %s: database %s does not exist\n", cmd.Argv0, argv0, dbname)
-				os.Exit(1)
-			}
-			fmt.Fprintf(os.Stderr, "%s %s: %s\n", cmd.Argv0, argv0, err)
+			fmt.Fprintf(os.Stderr, "%s %s: failed to get revisions: %s\n", cmd.Argv0, argv0, err)
 			os.Exit(1)
 		}
 
-		typ = it.Type
-		dsn = it.DSN
+		if err := dumpRevisions(dump, revs, gz); err != nil {
+			fmt.Fprintf(os.Stderr, "%s %s: failed to dump revisions: %s\n", cmd.Argv0, argv0, err)
+			os.Exit(1)
+		}
+		return
 	}
 
-	if typ == "" {
-		fmt.Fprintf(os.Stderr, "%s %s: database not specified\n", cmd.Argv0, argv0)
-		os.Exit(1)
+	if !dryRun {
+		if err := os.MkdirAll(out, os.FileMode(0755)); err != nil {
+			fmt.Fprintf(os.Stderr, "%s %s: %s\n", cmd.Argv0, argv0, err)
+			os.Exit(1)
+		}
 	}
 
-	if dsn == "" {
-		fmt.Fprintf(os.Stderr, "%s %s: database not specified\n", cmd.Argv0, argv0)
+	revs, err := mgrt.GetRevisions(db, -1)
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s %s: failed to get revisions: %s\n", cmd.Argv0, argv0, err)
 		os.Exit(1)
 	}
 
-	db, err := mgrt.Open(typ, dsn)
+	items, err := planSync(out, revs, gz)
 
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "%s %s: %s\n", cmd.Argv0, argv0, err)
+		fmt.Fprintf(os.Stderr, "%s %s: failed to sync revisions: %s\n", cmd.Argv0, argv0, err)
 		os.Exit(1)
 	}
 
-	defer db.Close()
+	if dryRun {
+		var w io.Writer = os.Stdout
 
-	if err := os.MkdirAll(revisionsDir, os.FileMode(0755)); err != nil {
-		fmt.Fprintf(os.Stderr, "%s %s: %s\n", cmd.Argv0, argv0, err)
-		os.Exit(1)
+		if cmd.Verbosity == Quiet {
+			w = io.Discard
+		}
+
+		if err := writeSyncPlan(w, items); err != nil {
+			fmt.Fprintf(os.Stderr, "%s %s: %s\n", cmd.Argv0, argv0, err)
+			os.Exit(1)
+		}
+		return
 	}
 
-	revs, err := mgrt.GetRevisions(db, -1)
+	if !force {
+		changed := make([]string, 0)
 
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "%s %s: failed to get revisions: %s\n", cmd.Argv0, argv0, err)
-		os.Exit(1)
+		for _, it := range items {
+			if it.state == syncUpdate {
+				changed = append(changed, it.path)
+			}
+		}
+
+		if len(changed) > 0 {
+			fmt.Fprintf(os.Stderr, "%s %s: local revisions differ from the database, use -force to overwrite\n", cmd.Argv0, argv0)
+
+			for _, path := range changed {
+				fmt.Fprintf(os.Stderr, "    %s\n", path)
+			}
+			os.Exit(1)
+		}
 	}
 
+	for _, it := range items {
+		if it.state == syncUnchanged {
+			continue
+		}
+
+		if err := writeSyncItem(it); err != nil {
+			fmt.Fprintf(os.Stderr, "%s %s: failed to sync revisions: %s\n", cmd.Argv0, argv0, err)
+			os.Exit(1)
+		}
+
+		state := "created"
+
+		if it.state == syncUpdate {
+			state = "updated"
+		}
+		cmd.Verbosef("%s %s\n", state, it.path)
+	}
+}
+
+// planSync returns the items for syncing the given revisions to the given
+// directory. The state of each item is determined by comparing the revision
+// against the file it would be written to. If gz is true, then the items will
+// be gzip compressed files.
+func planSync(dir string, revs []*mgrt.Revision, gz bool) ([]syncItem, error) {
+	items := make([]syncItem, 0, len(revs))
+
 	for _, rev := range revs {
-		dir := filepath.Join(revisionsDir, rev.Category)
+		it := syncItem{
+			rev:   rev,
+			path:  filepath.Join(dir, rev.Category, rev.ID+revisionExt(gz)),
+			state: syncUnchanged,
+		}
 
-		err = func() error {
-			if err := os.MkdirAll(dir, os.FileMode(0755)); err != nil {
-				return err
+		b, err := readRevision(it.path)
+
+		if err != nil {
+			if !os.IsNotExist(err) {
+				return nil, err
 			}
+			it.state = syncCreate
+		}
 
-			f, err := os.OpenFile(filepath.Join(dir, rev.ID+".sql"), os.O_CREATE|os.O_TRUNC|os.O_WRONLY, os.FileMode(0644))
+		if err == nil {
+			local, err := mgrt.UnmarshalRevision(bytes.NewReader(b))
 
-			if err != nil {
-				return err
+			// A local file that cannot be unmarshalled differs from the
+			// database, so it is overwritten as well.
+			if err != nil || !local.Equal(rev) {
+				it.state = syncUpdate
 			}
+		}
+		items = append(items, it)
+	}
+	return items, nil
+}
 
-			defer f.Close()
+// writeSyncPlan writes each of the given items on a line, prefixed with its
+// state. The items are written in the order of their paths.
+func writeSyncPlan(w io.Writer, items []syncItem) error {
+	sorted := make([]syncItem, len(items))
+	copy(sorted, items)
 
-			f.WriteString(rev.String())
-			return nil
-		}()
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].path < sorted[j].path
+	})
 
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "%s %s: failed to sync revisions: %s\n", cmd.Argv0, argv0, err)
-			os.Exit(1)
+	for _, it := range sorted {
+		if _, err := fmt.Fprintf(w, "%s %s\n", it.state, it.path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dumpRevisions writes the given revisions to the file at the given path, each
+// separated by a blank line. If gz is true, then the file is gzip compressed.
+func dumpRevisions(path string, revs []*mgrt.Revision, gz bool) error {
+	var buf bytes.Buffer
+
+	for i, rev := range revs {
+		if i > 0 {
+			buf.WriteString("\n\n")
 		}
+
+		if _, err := rev.WriteTo(&buf); err != nil {
+			return err
+		}
+	}
+
+	if len(revs) > 0 {
+		buf.WriteString("\n")
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, os.FileMode(0644))
+
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	if !gz {
+		_, err = buf.WriteTo(f)
+		return err
+	}
+
+	zw := gzip.NewWriter(f)
+
+	if _, err := buf.WriteTo(zw); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+func writeSyncItem(it syncItem) error {
+	if err := os.MkdirAll(filepath.Dir(it.path), os.FileMode(0755)); err != nil {
+		return err
 	}
+
+	f, err := os.OpenFile(it.path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, os.FileMode(0644))
+
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	return writeRevision(f, it.rev, strings.HasSuffix(it.path, ".gz"))
 }
@@ -0,0 +1,110 @@
+package internal
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/andrewpillar/mgrt/v3"
+)
+
+func Test_DumpRevisions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mgrt-dump-*")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	revs := []*mgrt.Revision{
+		{ID: "20060102150405", Author: "Andrew", Comment: "Add users table", SQL: "CREATE TABLE users ( id INT NOT NULL UNIQUE );"},
+		{ID: "20060102150406", Category: "perms", Author: "Andrew", Comment: "Grant users", SQL: "GRANT SELECT ON users TO app;"},
+	}
+
+	for _, gz := range []bool{false, true} {
+		path := filepath.Join(dir, "dump"+revisionExt(gz))
+
+		if err := dumpRevisions(path, revs, gz); err != nil {
+			t.Fatal(err)
+		}
+
+		b, err := readRevision(path)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		dumped, err := mgrt.UnmarshalRevisions(bytes.NewReader(b))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(dumped) != len(revs) {
+			t.Fatalf("unexpected revision count, expected=%d, got=%d\n", len(revs), len(dumped))
+		}
+
+		for i, rev := range dumped {
+			if rev.Slug() != revs[i].Slug() || rev.SQL != revs[i].SQL || rev.Comment != revs[i].Comment {
+				t.Errorf("dumped[%d] - unexpected revision, expected=%+v, got=%+v\n", i, *revs[i], *rev)
+			}
+		}
+	}
+}
+
+func Test_SyncDryRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mgrt-sync-*")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	revs := []*mgrt.Revision{
+		{ID: "20060102150407", Author: "Andrew", Comment: "Add posts table", SQL: "CREATE TABLE posts ( id INT );"},
+		{ID: "20060102150406", Category: "perms", Author: "Andrew", Comment: "Grant users", SQL: "GRANT SELECT ON users TO app;"},
+		{ID: "20060102150405", Author: "Andrew", Comment: "Add users table", SQL: "CREATE TABLE users ( id INT );"},
+	}
+
+	if err := os.MkdirAll(filepath.Join(dir, "perms"), os.FileMode(0755)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Formatting that is lost when a revision is unmarshalled, such as
+	// trailing whitespace, should not cause an update.
+	if err := os.WriteFile(filepath.Join(dir, "20060102150405.sql"), []byte(revs[2].String()+"\n\n"), os.FileMode(0644)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "perms", "20060102150406.sql"), []byte("SELECT 1;"), os.FileMode(0644)); err != nil {
+		t.Fatal(err)
+	}
+
+	items, err := planSync(dir, revs, false)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+
+	if err := writeSyncPlan(&buf, items); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "unchanged " + filepath.Join(dir, "20060102150405.sql") + "\n" +
+		"create " + filepath.Join(dir, "20060102150407.sql") + "\n" +
+		"update " + filepath.Join(dir, "perms", "20060102150406.sql") + "\n"
+
+	if s := buf.String(); s != expected {
+		t.Fatalf("unexpected plan, expected=\n%s\ngot=\n%s\n", expected, s)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "20060102150407.sql")); !os.IsNotExist(err) {
+		t.Fatalf("expected revision to not be written, got=%v\n", err)
+	}
+}
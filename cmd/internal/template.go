@@ -0,0 +1,98 @@
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// templateVars are the variables given to a template via the -var flag, in the
+// form of key=value.
+type templateVars map[string]string
+
+// templates are the built-in templates for the SQL of a new revision.
+var templates = map[string]string{
+	"create-table": `CREATE TABLE {{.Table}} (
+	id INT NOT NULL UNIQUE
+);`,
+	"add-column": `ALTER TABLE {{.Table}} ADD COLUMN {{.Column}} {{.Type}};`,
+	"add-index":  `CREATE INDEX {{.Table}}_{{.Column}}_idx ON {{.Table}} ({{.Column}});`,
+}
+
+func (v templateVars) String() string {
+	pairs := make([]string, 0, len(v))
+
+	for key, val := range v {
+		pairs = append(pairs, key+"="+val)
+	}
+
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (v templateVars) Set(s string) error {
+	i := strings.Index(s, "=")
+
+	if i <= 0 {
+		return errors.New("variable must be in the form of key=value")
+	}
+
+	v[s[:i]] = s[i+1:]
+	return nil
+}
+
+// templateNames returns the sorted names of the built-in templates.
+func templateNames() []string {
+	names := make([]string, 0, len(templates))
+
+	for name := range templates {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// execTemplate executes the template of the given name with the given
+// variables. If a directory is given, then the template is first looked for in
+// that directory as the file name.sql, which allows for the built-in templates
+// to be overridden. Referring to a variable that was not given is an error.
+func execTemplate(dir, name string, vars templateVars) (string, error) {
+	text, ok := templates[name]
+
+	if dir != "" {
+		b, err := os.ReadFile(filepath.Join(dir, name+".sql"))
+
+		if err != nil {
+			if !os.IsNotExist(err) {
+				return "", err
+			}
+		}
+
+		if err == nil {
+			text = string(b)
+			ok = true
+		}
+	}
+
+	if !ok {
+		return "", errors.New("unknown template " + name)
+	}
+
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+
+	if err := tmpl.Execute(&buf, map[string]string(vars)); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
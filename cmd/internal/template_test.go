@@ -0,0 +1,65 @@
+package internal
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_ExecTemplate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mgrt-templates-*")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "add-index.sql"), []byte("CREATE UNIQUE INDEX ON {{.Table}} ({{.Column}});\n"), os.FileMode(0644)); err != nil {
+		t.Fatal(err)
+	}
+
+	vars := make(templateVars)
+
+	for _, s := range []string{"Table=users", "Column=email", "Type=VARCHAR(255)"} {
+		if err := vars.Set(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		dir      string
+		name     string
+		expected string
+	}{
+		{"", "add-column", "ALTER TABLE users ADD COLUMN email VARCHAR(255);"},
+		{"", "add-index", "CREATE INDEX users_email_idx ON users (email);"},
+		{dir, "add-index", "CREATE UNIQUE INDEX ON users (email);"},
+		{dir, "add-column", "ALTER TABLE users ADD COLUMN email VARCHAR(255);"},
+	}
+
+	for i, test := range tests {
+		sql, err := execTemplate(test.dir, test.name, vars)
+
+		if err != nil {
+			t.Fatalf("tests[%d] - %s\n", i, err)
+		}
+
+		if sql != test.expected {
+			t.Errorf("tests[%d] - unexpected sql, expected=%q, got=%q\n", i, test.expected, sql)
+		}
+	}
+
+	if _, err := execTemplate("", "drop-table", vars); err == nil {
+		t.Errorf("expected error for unknown template")
+	}
+
+	if _, err := execTemplate("", "create-table", templateVars{}); err == nil {
+		t.Errorf("expected error for missing variable")
+	}
+
+	if err := vars.Set("Table"); err == nil {
+		t.Errorf("expected error for variable without value")
+	}
+}
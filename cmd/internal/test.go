@@ -0,0 +1,139 @@
+package internal
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/andrewpillar/mgrt/v3"
+)
+
+var TestCmd = &Command{
+	Usage: "test [-type type] [-dsn dsn] [-with-history] <revision>",
+	Short: "test the given revision against a throwaway database",
+	Long: `Test will perform the given revision against a throwaway database, to check
+that it can be performed, such as before committing it. This will catch syntax
+errors in the revision, without touching any real database. The revision is not
+recorded, and it is performed within a transaction that is rolled back, unless
+the revision is not performed within a transaction. If the revision fails, then
+the error from the database is displayed, and test exits with 1.
+
+By default, the revision is tested against an in-memory SQLite database, which
+is discarded afterwards. Revisions that use SQL specific to another database can
+be tested against a throwaway database of that type via the -type and -dsn
+flags. This should never be a database whose data you care about.
+
+The -with-history flag will perform each of the local revisions before the given
+revision first, for revisions that depend on the schema created by earlier
+revisions.
+
+The -type flag specifies the type of database to connect to, it will be one of,
+
+    mysql
+    postgresql
+    sqlite3
+
+The -dsn flag specifies the data source name for the database. Environment
+variables referenced in the dsn, such as ${DB_PASSWORD}, will be expanded.
+
+The flags can be given either before or after the revision, for example,
+
+    $ mgrt test 20060102150405 -with-history`,
+	Run: testCmd,
+}
+
+func testCmd(cmd *Command, args []string) {
+	argv0 := args[0]
+
+	var (
+		typ     string
+		dsn     string
+		history bool
+	)
+
+	fs := flag.NewFlagSet(cmd.Argv0+" "+argv0, flag.ExitOnError)
+	fs.StringVar(&typ, "type", "", "the database type one of mysql, postgresql, sqlite3")
+	fs.StringVar(&dsn, "dsn", "", "the dsn for the throwaway database")
+	fs.BoolVar(&history, "with-history", false, "perform the revisions before the given revision first")
+	fs.Parse(args[1:])
+
+	if fs.NArg() < 1 {
+		fmt.Fprintf(os.Stderr, "usage: %s %s\n", cmd.Argv0, cmd.Usage)
+		os.Exit(ExitError)
+	}
+
+	id := fs.Arg(0)
+
+	// Allow for the flags to be given after the revision.
+	fs.Parse(fs.Args()[1:])
+
+	if fs.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "usage: %s %s\n", cmd.Argv0, cmd.Usage)
+		os.Exit(ExitError)
+	}
+
+	if dsn == "" {
+		if typ != "" && typ != "sqlite3" {
+			fmt.Fprintf(os.Stderr, "%s %s: -dsn must be given for %s\n", cmd.Argv0, argv0, typ)
+			os.Exit(ExitError)
+		}
+
+		typ = "sqlite3"
+		dsn = ":memory:"
+	}
+
+	repo := mgrt.Repo{Dir: revisionsDir}
+
+	rev, err := repo.Find(id)
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s %s: %s\n", cmd.Argv0, argv0, err)
+		os.Exit(ExitError)
+	}
+
+	// Each connection to an in-memory SQLite database has its own database, so
+	// a single connection is used for the history and the revision to share it.
+	db, err := openDB(typ, dsn, "", mgrt.WithSingleConn())
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s %s: %s\n", cmd.Argv0, argv0, err)
+		os.Exit(ExitError)
+	}
+
+	defer db.Close()
+
+	if history {
+		local, err := repo.Load()
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s %s: failed to load revisions: %s\n", cmd.Argv0, argv0, err)
+			os.Exit(ExitError)
+		}
+
+		earlier := make([]*mgrt.Revision, 0, len(local))
+
+		for _, r := range local {
+			if r.ID < rev.ID {
+				earlier = append(earlier, r)
+			}
+		}
+
+		if len(earlier) > 0 {
+			m := mgrt.Migrator{DB: db}
+
+			if err := m.PerformRevisions(earlier...); err != nil {
+				fmt.Fprintf(os.Stderr, "%s %s: failed to perform history: %s\n", cmd.Argv0, argv0, err)
+				os.Exit(ExitError)
+			}
+		}
+	}
+
+	if err := mgrt.TestRevision(db, rev); err != nil {
+		fmt.Fprintf(os.Stderr, "%s %s: revision failed: %s\n", cmd.Argv0, argv0, err)
+		os.Exit(ExitError)
+	}
+
+	if cmd.Verbosity != Quiet {
+		fmt.Printf("revision %s ok\n", rev.Slug())
+	}
+}
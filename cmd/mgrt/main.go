@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"os"
@@ -17,30 +18,61 @@ func run(args []string) error {
 
 Usage:
 
-    mgrt [-version] <command> [arguments]
+    mgrt [-version] [-quiet|-verbose] <command> [arguments]
 `,
 	}
 
 	cmds.Add("add", internal.AddCmd)
+	cmds.Add("amend", internal.AmendCmd)
 	cmds.Add("cat", internal.CatCmd)
+	cmds.Add("check", internal.CheckCmd)
+	cmds.Add("create", internal.CreateCmd)
 	cmds.Add("db", internal.DBCmd(cmds.Argv0))
+	cmds.Add("diff", internal.DiffCmd)
+	cmds.Add("doctor", internal.DoctorCmd)
+	cmds.Add("forget", internal.ForgetCmd)
+	cmds.Add("import", internal.ImportCmd)
 	cmds.Add("log", internal.LogCmd)
 	cmds.Add("ls", internal.LsCmd)
+	cmds.Add("plan", internal.PlanCmd)
+	cmds.Add("rehash", internal.RehashCmd)
+	cmds.Add("rm", internal.RmCmd)
 	cmds.Add("run", internal.RunCmd)
 	cmds.Add("show", internal.ShowCmd)
+	cmds.Add("squash", internal.SquashCmd)
+	cmds.Add("status", internal.StatusCmd)
 	cmds.Add("sync", internal.SyncCmd)
+	cmds.Add("test", internal.TestCmd)
 	cmds.Add("help", internal.HelpCmd(cmds))
 
-	var version bool
+	var (
+		version bool
+		quiet   bool
+		verbose bool
+	)
 
 	fs := flag.NewFlagSet(args[0], flag.ExitOnError)
 	fs.BoolVar(&version, "version", false, "display version information and exit")
+	fs.BoolVar(&quiet, "quiet", false, "display nothing other than errors")
+	fs.BoolVar(&verbose, "verbose", false, "display each statement performed, and how long it took")
 	fs.Parse(args[1:])
 
 	if version {
 		fmt.Println(Build)
 		return nil
 	}
+
+	if quiet && verbose {
+		return errors.New("cannot use -quiet with -verbose")
+	}
+
+	if quiet {
+		cmds.Verbosity = internal.Quiet
+	}
+
+	if verbose {
+		cmds.Verbosity = internal.Verbose
+	}
 	return cmds.Parse(fs.Args())
 }
 
@@ -0,0 +1,42 @@
+// +build mysql
+
+package mgrt
+
+import (
+	"os"
+	"testing"
+)
+
+// Test_EnsureTableMysql requires the MGRT_MYSQL_DSN environment variable to be
+// set to the DSN of a database that can be written to.
+func Test_EnsureTableMysql(t *testing.T) {
+	dsn := os.Getenv("MGRT_MYSQL_DSN")
+
+	if dsn == "" {
+		t.Skip("MGRT_MYSQL_DSN not set")
+	}
+
+	db, err := Open("mysql", dsn)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	if _, err := db.Exec("DROP TABLE mgrt_revisions"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := EnsureTable(db); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := EnsureTable(db); err != nil {
+		t.Fatalf("unexpected error on repeated EnsureTable %q\n", err)
+	}
+
+	if _, err := GetRevisions(db, -1); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,138 @@
+// +build postgresql
+
+package mgrt
+
+import (
+	"os"
+	"testing"
+)
+
+// Test_EnsureTablePostgresql requires the MGRT_POSTGRESQL_DSN environment variable to be
+// set to the DSN of a database that can be written to.
+func Test_EnsureTablePostgresql(t *testing.T) {
+	dsn := os.Getenv("MGRT_POSTGRESQL_DSN")
+
+	if dsn == "" {
+		t.Skip("MGRT_POSTGRESQL_DSN not set")
+	}
+
+	db, err := Open("postgresql", dsn)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	if _, err := db.Exec("DROP TABLE mgrt_revisions"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := EnsureTable(db); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := EnsureTable(db); err != nil {
+		t.Fatalf("unexpected error on repeated EnsureTable %q\n", err)
+	}
+
+	if _, err := GetRevisions(db, -1); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Test_WithSchemaPostgresql requires the MGRT_POSTGRESQL_DSN environment
+// variable to be set to the DSN of a database that schemas can be created in.
+func Test_WithSchemaPostgresql(t *testing.T) {
+	dsn := os.Getenv("MGRT_POSTGRESQL_DSN")
+
+	if dsn == "" {
+		t.Skip("MGRT_POSTGRESQL_DSN not set")
+	}
+
+	rev := &Revision{
+		ID:     "20060102150405",
+		Author: "Andrew",
+		SQL:    "CREATE TABLE users ( id INT NOT NULL UNIQUE );",
+	}
+
+	for _, schema := range []string{"mgrt_tenant_1", "mgrt_tenant_2"} {
+		db, err := Open("postgresql", dsn, WithSchema(schema))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer db.Close()
+		defer db.DB.Exec("DROP SCHEMA " + schema + " CASCADE")
+
+		if err := PerformRevisions(db, rev); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := RevisionPerformed(db, rev); err != ErrPerformed {
+			t.Fatalf("unexpected error, expected=%q, got=%q\n", ErrPerformed, err)
+		}
+
+		var n int
+
+		if err := db.QueryRow("SELECT COUNT(*) FROM " + schema + ".users").Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// Test_PerformRevisionsPostgresql requires the MGRT_POSTGRESQL_DSN environment
+// variable to be set to the DSN of a database that can be written to. This
+// performs revisions via the pgx driver, and checks that they are recorded.
+func Test_PerformRevisionsPostgresql(t *testing.T) {
+	dsn := os.Getenv("MGRT_POSTGRESQL_DSN")
+
+	if dsn == "" {
+		t.Skip("MGRT_POSTGRESQL_DSN not set")
+	}
+
+	db, err := Open("postgresql", dsn)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	if db.Type != "pgx" {
+		t.Fatalf("unexpected driver, expected=%q, got=%q\n", "pgx", db.Type)
+	}
+
+	defer db.Exec("DROP TABLE mgrt_test_users")
+	defer db.Exec("DELETE FROM mgrt_revisions WHERE id LIKE 'mgrt_test/%'")
+
+	revs := []*Revision{
+		{ID: "20060102150405", Category: "mgrt_test", Author: "Andrew", SQL: "CREATE TABLE mgrt_test_users ( id INT NOT NULL UNIQUE );"},
+		{ID: "20060102150406", Category: "mgrt_test", Author: "Andrew", SQL: "ALTER TABLE mgrt_test_users ADD COLUMN username VARCHAR NOT NULL;"},
+	}
+
+	if err := PerformRevisions(db, revs...); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, rev := range revs {
+		performed, err := GetRevision(db, rev.Slug())
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if performed.SQL != rev.SQL {
+			t.Errorf("unexpected revision sql, expected=%q, got=%q\n", rev.SQL, performed.SQL)
+		}
+
+		if performed.Hash != rev.genHash() {
+			t.Errorf("unexpected revision hash, expected=%q, got=%q\n", rev.genHash(), performed.Hash)
+		}
+	}
+
+	if err := PerformRevisions(db, revs...); !IsAllPerformed(err) {
+		t.Fatalf("expected all revisions to be performed, got=%q\n", err)
+	}
+}
@@ -3,33 +3,115 @@
 package mgrt
 
 import (
-	"database/sql"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
 	"strings"
 
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/mattn/go-sqlite3"
 )
 
-var sqlite3Init = `CREATE TABLE mgrt_revisions (
+var (
+	sqlite3Init = `CREATE TABLE IF NOT EXISTS mgrt_revisions (
 	id           VARCHAR NOT NULL,
 	author       VARCHAR NOT NULL,
 	comment      TEXT NOT NULL,
 	sql          TEXT NOT NULL,
-	performed_at INT NOT NULL
+	performed_at INT NOT NULL,
+	hash         VARCHAR NULL,
+	performed_by VARCHAR NULL,
+	duration_ms  INT NULL,
+	version      VARCHAR NULL,
+	sql_encoding VARCHAR NULL
 );`
 
+	sqlite3ColumnsQuery = "SELECT name FROM pragma_table_info('mgrt_revisions')"
+
+	sqlite3Columns = []column{
+		{"hash", "VARCHAR NULL"},
+		{"performed_by", "VARCHAR NULL"},
+		{"duration_ms", "INT NULL"},
+		{"version", "VARCHAR NULL"},
+		{"sql_encoding", "VARCHAR NULL"},
+	}
+)
+
 func init() {
 	Register("sqlite3", &DB{
 		Type:         "sqlite3",
-		Init:         initSqlite3,
+		InitExec:     initSqlite3,
 		Parameterize: func(s string) string { return s },
+		DSN:          dsnSqlite3,
+		ErrorCode:    errorCodeSqlite3,
 	})
 }
 
-func initSqlite3(db *sql.DB) error {
-	if _, err := db.Exec(sqlite3Init); err != nil {
+func initSqlite3(e Execer) error {
+	if _, err := e.ExecContext(context.Background(), sqlite3Init); err != nil {
 		if !strings.Contains(err.Error(), "already exists") {
 			return err
 		}
 	}
-	return nil
+
+	// SQLite has no ADD COLUMN IF NOT EXISTS, and reports a column that
+	// already exists with the generic SQLITE_ERROR, so the message is checked.
+	return addColumns(e, sqlite3ColumnsQuery, "ADD COLUMN", sqlite3Columns, func(err error) bool {
+		return strings.Contains(err.Error(), "duplicate column")
+	})
+}
+
+// errorCodeSqlite3 returns the extended result code of the given SQLite error.
+// SQLite has no SQLSTATE.
+func errorCodeSqlite3(err error) (string, int) {
+	var serr sqlite3.Error
+
+	if errors.As(err, &serr) {
+		return "", int(serr.ExtendedCode)
+	}
+	return "", 0
+}
+
+// dsnSqlite3 expands a leading ~ in the path of the given dsn to the home
+// directory, and resolves the path if it is relative. The directory of the
+// database is created if it does not exist, unless the database is opened as
+// read-only via mode=ro. In-memory databases are returned as is.
+func dsnSqlite3(dsn string) (string, error) {
+	if dsn == ":memory:" || strings.HasPrefix(dsn, "file::memory:") || strings.Contains(dsn, "mode=memory") {
+		return dsn, nil
+	}
+
+	var prefix, query string
+
+	if strings.HasPrefix(dsn, "file:") {
+		prefix = "file:"
+		dsn = dsn[len(prefix):]
+	}
+
+	if i := strings.Index(dsn, "?"); i >= 0 {
+		query = dsn[i:]
+		dsn = dsn[:i]
+	}
+
+	if dsn == "~" || strings.HasPrefix(dsn, "~/") {
+		home, err := os.UserHomeDir()
+
+		if err != nil {
+			return "", err
+		}
+		dsn = filepath.Join(home, dsn[1:])
+	}
+
+	path, err := filepath.Abs(dsn)
+
+	if err != nil {
+		return "", err
+	}
+
+	if !strings.Contains(query, "mode=ro") {
+		if err := os.MkdirAll(filepath.Dir(path), os.FileMode(0755)); err != nil {
+			return "", err
+		}
+	}
+	return prefix + path + query, nil
 }
@@ -0,0 +1,485 @@
+// +build sqlite3
+
+package mgrt
+
+import (
+	"context"
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_EnsureTableSqlite3(t *testing.T) {
+	tmp, err := ioutil.TempFile("", "mgrt-db-*")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.Remove(tmp.Name())
+
+	db, err := OpenLazy("sqlite3", tmp.Name())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	rev := NewRevision("Andrew", "Add users table")
+	rev.ID = "20060102150405"
+	rev.SQL = "CREATE TABLE users ( id INT NOT NULL UNIQUE );"
+
+	if err := PerformRevisions(db, rev); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := GetRevision(db, rev.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	// The table is only ensured once for each *DB, so it is not created again
+	// once it has been ensured.
+	if _, err := db.Exec("DROP TABLE mgrt_revisions"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := EnsureTable(db); err != nil {
+		t.Fatalf("unexpected error on repeated EnsureTable %q\n", err)
+	}
+
+	if _, err := GetRevision(db, rev.ID); err == nil {
+		t.Fatalf("expected mgrt_revisions table to not be created again\n")
+	}
+}
+
+func Test_EnsureTableAddsColumnsSqlite3(t *testing.T) {
+	tmp, err := ioutil.TempFile("", "mgrt-db-*")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.Remove(tmp.Name())
+
+	db, err := OpenLazy("sqlite3", tmp.Name())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	q := `CREATE TABLE mgrt_revisions (
+	id           VARCHAR NOT NULL,
+	author       VARCHAR NOT NULL,
+	comment      TEXT NOT NULL,
+	sql          TEXT NOT NULL,
+	performed_at INT NOT NULL
+);
+INSERT INTO mgrt_revisions VALUES ('20060102150405', 'Andrew', '', 'SELECT 1;', 0);`
+
+	if _, err := db.Exec(q); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := EnsureTable(db); err != nil {
+		t.Fatal(err)
+	}
+
+	rev, err := GetRevision(db, "20060102150405")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rev.Hash != "" {
+		t.Fatalf("unexpected revision hash, expected=%q, got=%q\n", "", rev.Hash)
+	}
+
+	if rev.PerformedBy != "" {
+		t.Fatalf("unexpected revision performed by, expected=%q, got=%q\n", "", rev.PerformedBy)
+	}
+
+	if rev.Duration != 0 {
+		t.Fatalf("unexpected revision duration, expected=%s, got=%s\n", time.Duration(0), rev.Duration)
+	}
+}
+
+// alterRecorder is an Execer that records the ALTER statements it is given
+// before executing them against the underlying Execer.
+type alterRecorder struct {
+	Execer
+
+	alters []string
+}
+
+func (e *alterRecorder) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	if strings.HasPrefix(query, "ALTER") {
+		e.alters = append(e.alters, query)
+	}
+	return e.Execer.ExecContext(ctx, query, args...)
+}
+
+func Test_EnsureTableNoAlterSqlite3(t *testing.T) {
+	tmp, err := ioutil.TempFile("", "mgrt-db-*")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.Remove(tmp.Name())
+
+	db, err := OpenLazy("sqlite3", tmp.Name())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	if err := EnsureTable(db); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := &alterRecorder{Execer: db.DB}
+
+	recdb := db.With(rec)
+	recdb.table = &tableState{}
+
+	if err := EnsureTable(recdb); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rec.alters) != 0 {
+		t.Fatalf("unexpected alter statements, expected=%d, got=%d\n%s\n", 0, len(rec.alters), strings.Join(rec.alters, "\n"))
+	}
+}
+
+func Test_OpenWithRetrySqlite3(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mgrt-db-*")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	start := time.Now()
+
+	if _, err := OpenWithRetry("sqlite3", filepath.Join(dir, "nonexistent", "db")+"?mode=ro", 3, time.Millisecond); err == nil {
+		t.Fatal("expected error for unreachable database")
+	}
+
+	if d := time.Since(start); d < 3*time.Millisecond {
+		t.Fatalf("expected retries to back off, took %s\n", d)
+	}
+
+	db, err := OpenWithRetry("sqlite3", filepath.Join(dir, "db"), 3, time.Millisecond)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+}
+
+func Test_OpenPingSqlite3(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mgrt-db-*")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	dsn := filepath.Join(dir, "nonexistent", "db") + "?mode=ro"
+
+	_, err = Open("sqlite3", dsn)
+
+	if err == nil {
+		t.Fatal("expected error for unreachable database")
+	}
+
+	if !strings.Contains(err.Error(), "sqlite3") {
+		t.Fatalf("expected error to contain database type, got=%q\n", err)
+	}
+
+	db, err := OpenLazy("sqlite3", dsn)
+
+	if err != nil {
+		t.Fatalf("unexpected error from OpenLazy %q\n", err)
+	}
+	db.Close()
+}
+
+func Test_OpenSingleConnSqlite3(t *testing.T) {
+	tmp, err := ioutil.TempFile("", "mgrt-db-*")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.Remove(tmp.Name())
+
+	db, err := Open("sqlite3", tmp.Name(), WithSingleConn())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	if n := db.Stats().MaxOpenConnections; n != 1 {
+		t.Fatalf("unexpected max open connections, expected=%d, got=%d\n", 1, n)
+	}
+
+	m := Migrator{
+		DB:      db,
+		LockTTL: time.Minute,
+		Timeout: 10 * time.Second,
+	}
+
+	revs := []*Revision{
+		{ID: "20060102150405", Author: "Andrew", SQL: "CREATE TABLE users ( id INT NOT NULL UNIQUE );"},
+		{ID: "20060102150406", Author: "Andrew", SQL: "CREATE TABLE posts ( id INT NOT NULL UNIQUE );", NoTransaction: true},
+	}
+
+	if err := m.PerformRevisions(revs...); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := BackfillHashes(db); err != nil {
+		t.Fatal(err)
+	}
+
+	db2, err := Open("sqlite3", tmp.Name(), WithMaxOpenConns(2), WithMaxIdleConns(1), WithConnMaxLifetime(time.Minute))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db2.Close()
+
+	if n := db2.Stats().MaxOpenConnections; n != 2 {
+		t.Fatalf("unexpected max open connections, expected=%d, got=%d\n", 2, n)
+	}
+}
+
+func Test_OpenCreatesDirSqlite3(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mgrt-db-*")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	setenv := func(key, val string) {
+		prev, ok := os.LookupEnv(key)
+
+		os.Setenv(key, val)
+
+		t.Cleanup(func() {
+			if ok {
+				os.Setenv(key, prev)
+				return
+			}
+			os.Unsetenv(key)
+		})
+	}
+
+	setenv("HOME", dir)
+
+	tests := []struct {
+		dsn  string
+		path string
+	}{
+		{filepath.Join(dir, "data", "app.db"), filepath.Join(dir, "data", "app.db")},
+		{"~/home/app.db?_busy_timeout=5000", filepath.Join(dir, "home", "app.db")},
+		{"file:" + filepath.Join(dir, "uri", "app.db") + "?cache=shared", filepath.Join(dir, "uri", "app.db")},
+	}
+
+	for i, test := range tests {
+		db, err := Open("sqlite3", test.dsn)
+
+		if err != nil {
+			t.Fatalf("tests[%d] - %s\n", i, err)
+		}
+		db.Close()
+
+		if _, err := os.Stat(test.path); err != nil {
+			t.Errorf("tests[%d] - expected database to be created, got=%q\n", i, err)
+		}
+	}
+
+	for _, dsn := range []string{":memory:", "file::memory:?cache=shared"} {
+		db, err := Open("sqlite3", dsn)
+
+		if err != nil {
+			t.Fatalf("unexpected error for %s %q\n", dsn, err)
+		}
+		db.Close()
+	}
+}
+
+func Test_EnsureTableWithSqlite3(t *testing.T) {
+	tmp, err := ioutil.TempFile("", "mgrt-db-*")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.Remove(tmp.Name())
+
+	db, err := OpenLazy("sqlite3", tmp.Name())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	tx, err := db.Begin()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rev := &Revision{ID: "20060102150405", Author: "Andrew", SQL: "CREATE TABLE users ( id INT NOT NULL UNIQUE );"}
+
+	if err := PerformRevisions(db.With(tx), rev); err != nil {
+		tx.Rollback()
+		t.Fatal(err)
+	}
+
+	if err := tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The table was created within the transaction, so it was rolled back too.
+	if _, err := db.Exec("SELECT * FROM mgrt_revisions"); err == nil {
+		t.Fatalf("expected mgrt_revisions table to be rolled back\n")
+	}
+
+	if err := PerformRevisions(db, rev); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_OpenReadOnlyOldTableSqlite3(t *testing.T) {
+	tmp, err := ioutil.TempFile("", "mgrt-db-*")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.Remove(tmp.Name())
+
+	rw, err := OpenLazy("sqlite3", tmp.Name())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer rw.Close()
+
+	q := `CREATE TABLE mgrt_revisions (
+	id           VARCHAR NOT NULL,
+	author       VARCHAR NOT NULL,
+	comment      TEXT NOT NULL,
+	sql          TEXT NOT NULL,
+	performed_at INT NOT NULL
+);
+INSERT INTO mgrt_revisions VALUES ('20060102150405', 'Andrew', '', 'SELECT 1;', 0);`
+
+	if _, err := rw.Exec(q); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := OpenReadOnly("sqlite3", tmp.Name())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	revs, err := GetRevisions(db, -1)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(revs) != 1 || revs[0].SQL != "SELECT 1;" {
+		t.Fatalf("unexpected revisions %v\n", revs)
+	}
+
+	if _, err := GetRevision(db, "20060102150405"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The table is read as is, the missing columns are not added.
+	if _, err := rw.Exec("SELECT hash FROM mgrt_revisions"); err == nil {
+		t.Fatalf("expected mgrt_revisions table to not be altered\n")
+	}
+}
+
+func Test_OpenReadOnlyNonexistentSqlite3(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mgrt-db-*")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	dsns := []string{
+		filepath.Join(dir, "db"),
+		filepath.Join(dir, "db") + "?mode=rwc",
+		"file:" + filepath.Join(dir, "db") + "?_journal=WAL",
+		filepath.Join(dir, "nonexistent", "db"),
+	}
+
+	for i, dsn := range dsns {
+		if _, err := OpenReadOnly("sqlite3", dsn); err == nil {
+			t.Errorf("dsns[%d] - expected error for nonexistent database\n", i)
+		}
+	}
+
+	ents, err := ioutil.ReadDir(dir)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ents) != 0 {
+		t.Fatalf("unexpected files created, expected=%d, got=%d\n", 0, len(ents))
+	}
+}
+
+func Test_ReadOnlyDSNSqlite3(t *testing.T) {
+	tests := []struct {
+		dsn      string
+		expected string
+	}{
+		{"/var/lib/acme.db", "file:/var/lib/acme.db?mode=ro"},
+		{"/var/lib/acme.db?mode=rwc&_journal=WAL", "file:/var/lib/acme.db?_journal=WAL&mode=ro"},
+		{"file:acme.db?mode=ro", "file:acme.db?mode=ro"},
+		{":memory:", ":memory:"},
+		{"file:acme?mode=memory", "file:acme?mode=memory"},
+	}
+
+	for i, test := range tests {
+		if dsn := readOnlyDSN("sqlite3", test.dsn); dsn != test.expected {
+			t.Errorf("tests[%d] - unexpected dsn, expected=%q, got=%q\n", i, test.expected, dsn)
+		}
+	}
+
+	if dsn := readOnlyDSN("postgresql", "host=localhost"); dsn != "host=localhost" {
+		t.Errorf("unexpected dsn, expected=%q, got=%q\n", "host=localhost", dsn)
+	}
+}
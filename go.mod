@@ -3,7 +3,8 @@ module github.com/andrewpillar/mgrt/v3
 go 1.16
 
 require (
-	github.com/go-sql-driver/mysql v1.6.0 // indirect
-	github.com/jackc/pgx/v4 v4.11.0 // indirect
-	github.com/mattn/go-sqlite3 v1.14.7 // indirect
+	github.com/go-sql-driver/mysql v1.6.0
+	github.com/jackc/pgconn v1.8.1
+	github.com/jackc/pgx/v4 v4.11.0
+	github.com/mattn/go-sqlite3 v1.14.7
 )
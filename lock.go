@@ -0,0 +1,167 @@
+package mgrt
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// lockInit creates the mgrt_lock table. This only uses types that are common
+// to each of the supported databases, so the same table can be created for
+// all of them.
+var lockInit = `CREATE TABLE IF NOT EXISTS mgrt_lock (
+	id         INT NOT NULL UNIQUE,
+	owner      VARCHAR(255) NOT NULL,
+	expires_at BIGINT NOT NULL
+);`
+
+// ErrLocked is returned whenever the lock is held by another owner.
+var ErrLocked = errors.New("revisions locked")
+
+// LockError represents the lock being held by another owner.
+type LockError struct {
+	Owner     string    // Owner is who holds the lock.
+	ExpiresAt time.Time // ExpiresAt is when the lock held by the owner expires.
+}
+
+// AcquireLock acquires the lock for performing revisions against the given
+// database, so that only one process performs revisions at a time. The lock is
+// a row in the mgrt_lock table that is claimed via a conditional update, so
+// this works for databases without advisory locks, such as SQLite. Only one
+// owner can claim the lock, if two race to claim it, then only one of the
+// updates will succeed.
+//
+// The lock will expire after the given ttl, after which it can be claimed by
+// another owner. This ensures that a lock held by a process that died is not
+// held forever, so the ttl should be longer than the revisions are expected to
+// take to perform. If the lock is held, then a *LockError wrapping ErrLocked is
+// returned.
+//
+// The returned function releases the lock. This does nothing if the lock has
+// since expired and been claimed by another owner.
+func AcquireLock(db *DB, owner string, ttl time.Duration) (func() error, error) {
+	if err := ensureLockTable(db); err != nil {
+		return nil, err
+	}
+
+	t := now()
+	expiresAt := t.Add(ttl).UnixNano()
+
+	q := db.Parameterize("UPDATE mgrt_lock SET owner = ?, expires_at = ? WHERE (id = 1) AND (owner = '' OR expires_at < ?)")
+
+	res, err := db.Exec(q, owner, expiresAt, t.UnixNano())
+
+	if err != nil {
+		return nil, err
+	}
+
+	n, err := res.RowsAffected()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if n == 0 {
+		var (
+			holder string
+			expiry int64
+		)
+
+		q = "SELECT owner, expires_at FROM mgrt_lock WHERE (id = 1)"
+
+		if err := db.QueryRow(q).Scan(&holder, &expiry); err != nil {
+			return nil, err
+		}
+
+		return nil, &LockError{
+			Owner:     holder,
+			ExpiresAt: time.Unix(0, expiry),
+		}
+	}
+
+	release := func() error {
+		q := db.Parameterize("UPDATE mgrt_lock SET owner = '', expires_at = 0 WHERE (id = 1) AND (owner = ? AND expires_at = ?)")
+
+		_, err := db.Exec(q, owner, expiresAt)
+		return err
+	}
+	return release, nil
+}
+
+// lockPollInterval is how often the lock is polled when waiting for it to be
+// released.
+var lockPollInterval = time.Second
+
+// acquireLock acquires the lock via AcquireLock with the Migrator's LockTTL. If
+// the lock is held, then it is polled until it is acquired, or until the
+// Migrator's LockTimeout has passed.
+func (m *Migrator) acquireLock() (func() error, error) {
+	deadline := now().Add(m.LockTimeout)
+
+	for {
+		release, err := AcquireLock(m.DB, m.performedBy(), m.LockTTL)
+
+		if err == nil {
+			return release, nil
+		}
+
+		if !errors.Is(err, ErrLocked) {
+			return nil, err
+		}
+
+		left := deadline.Sub(now())
+
+		if left <= 0 {
+			return nil, err
+		}
+
+		wait := lockPollInterval
+
+		if left < wait {
+			wait = left
+		}
+
+		m.logger().Printf("waiting for lock: %s", err)
+		time.Sleep(wait)
+	}
+}
+
+// ensureLockTable creates the mgrt_lock table with its single row, if it does
+// not already exist. Inserting the row may fail if another process inserted it
+// first, so this is only an error if the row still does not exist.
+func ensureLockTable(db *DB) error {
+	if _, err := db.Exec(lockInit); err != nil {
+		if !strings.Contains(err.Error(), "already exists") {
+			return err
+		}
+	}
+
+	q := "SELECT id FROM mgrt_lock WHERE (id = 1)"
+
+	var id int64
+
+	err := db.QueryRow(q).Scan(&id)
+
+	if err == nil {
+		return nil
+	}
+
+	if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	if _, err := db.Exec("INSERT INTO mgrt_lock (id, owner, expires_at) VALUES (1, '', 0)"); err != nil {
+		if err2 := db.QueryRow(q).Scan(&id); err2 != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *LockError) Error() string {
+	return ErrLocked.Error() + ": held by " + e.Owner + " until " + e.ExpiresAt.Format(time.RFC3339)
+}
+
+// Unwrap returns ErrLocked.
+func (e *LockError) Unwrap() error { return ErrLocked }
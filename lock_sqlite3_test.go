@@ -0,0 +1,226 @@
+// +build sqlite3
+
+package mgrt
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+func Test_AcquireLock(t *testing.T) {
+	tmp, err := ioutil.TempFile("", "mgrt-db-*")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.Remove(tmp.Name())
+
+	dbs := make([]*DB, 0, 2)
+
+	for i := 0; i < 2; i++ {
+		db, err := Open("sqlite3", tmp.Name()+"?_busy_timeout=5000")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer db.Close()
+
+		dbs = append(dbs, db)
+	}
+
+	var wg sync.WaitGroup
+
+	releases := make([]func() error, len(dbs))
+	errs := make([]error, len(dbs))
+
+	for i, db := range dbs {
+		wg.Add(1)
+
+		go func(i int, db *DB) {
+			defer wg.Done()
+			releases[i], errs[i] = AcquireLock(db, "owner", time.Minute)
+		}(i, db)
+	}
+
+	wg.Wait()
+
+	held := -1
+
+	for i, err := range errs {
+		if err == nil {
+			if held >= 0 {
+				t.Fatalf("lock acquired by both dbs[%d] and dbs[%d]\n", held, i)
+			}
+			held = i
+			continue
+		}
+
+		if !errors.Is(err, ErrLocked) {
+			t.Fatalf("dbs[%d] - unexpected error, expected=%q, got=%q\n", i, ErrLocked, err)
+		}
+	}
+
+	if held < 0 {
+		t.Fatalf("lock not acquired, errors=%v\n", errs)
+	}
+
+	other := dbs[(held+1)%len(dbs)]
+
+	if err := releases[held](); err != nil {
+		t.Fatal(err)
+	}
+
+	release, err := AcquireLock(other, "other", time.Minute)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Releasing a lock that has since been claimed by another owner does
+	// nothing.
+	if err := releases[held](); err != nil {
+		t.Fatal(err)
+	}
+
+	var lerr *LockError
+
+	if _, err := AcquireLock(dbs[held], "owner", time.Minute); !errors.As(err, &lerr) || lerr.Owner != "other" {
+		t.Fatalf("unexpected error, expected lock held by %q, got=%q\n", "other", err)
+	}
+
+	if err := release(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_AcquireLockExpired(t *testing.T) {
+	tmp, err := ioutil.TempFile("", "mgrt-db-*")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.Remove(tmp.Name())
+
+	db, err := Open("sqlite3", tmp.Name())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	if _, err := AcquireLock(db, "dead", time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+
+	release, err := AcquireLock(db, "alive", time.Minute)
+
+	if err != nil {
+		t.Fatalf("expected stale lock to be claimed, got=%q\n", err)
+	}
+
+	if err := release(); err != nil {
+		t.Fatal(err)
+	}
+
+	m := Migrator{
+		DB:          db,
+		PerformedBy: "migrator",
+		LockTTL:     time.Minute,
+	}
+
+	release, err = AcquireLock(db, "other", time.Minute)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rev := &Revision{ID: "20060102150405", Author: "Andrew", SQL: "CREATE TABLE users ( id INT NOT NULL UNIQUE );"}
+
+	if err := m.PerformRevisions(rev); !errors.Is(err, ErrLocked) {
+		t.Fatalf("unexpected error, expected=%q, got=%q\n", ErrLocked, err)
+	}
+
+	if err := release(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.PerformRevisions(rev); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := AcquireLock(db, "other", time.Minute); err != nil {
+		t.Fatalf("expected lock to be released after performing, got=%q\n", err)
+	}
+}
+
+func Test_MigratorLockTimeout(t *testing.T) {
+	lockPollInterval = 10 * time.Millisecond
+	t.Cleanup(func() { lockPollInterval = time.Second })
+
+	tmp, err := ioutil.TempFile("", "mgrt-db-*")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.Remove(tmp.Name())
+
+	db, err := Open("sqlite3", tmp.Name()+"?_busy_timeout=5000")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	release, err := AcquireLock(db, "holder", time.Minute)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rev := &Revision{ID: "20060102150405", Author: "Andrew", SQL: "CREATE TABLE users ( id INT NOT NULL UNIQUE );"}
+
+	m := Migrator{
+		DB:          db,
+		PerformedBy: "waiter",
+		LockTTL:     time.Minute,
+	}
+
+	if err := m.PerformRevisions(rev); !errors.Is(err, ErrLocked) {
+		t.Fatalf("unexpected error, expected=%q, got=%q\n", ErrLocked, err)
+	}
+
+	m.LockTimeout = 50 * time.Millisecond
+
+	start := time.Now()
+
+	if err := m.PerformRevisions(rev); !errors.Is(err, ErrLocked) {
+		t.Fatalf("unexpected error, expected=%q, got=%q\n", ErrLocked, err)
+	}
+
+	if d := time.Since(start); d < m.LockTimeout {
+		t.Fatalf("expected to wait for the lock for %s, waited=%s\n", m.LockTimeout, d)
+	}
+
+	m.LockTimeout = 5 * time.Second
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		release()
+	}()
+
+	if err := m.PerformRevisions(rev); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,7 @@
+// Package mgrttest provides helpers for testing revisions against an in-memory
+// SQLite database, without the need for a real database to be running. The
+// helpers are only built with the sqlite3 build tag, so that SQLite is not
+// pulled into builds that do not need it,
+//
+//	go test -tags sqlite3 ./...
+package mgrttest
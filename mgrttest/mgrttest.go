@@ -0,0 +1,75 @@
+// +build sqlite3
+
+package mgrttest
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/andrewpillar/mgrt/v3"
+)
+
+// NewMemDB returns a new in-memory SQLite database with the mgrt_revisions
+// table already created. The database is closed once the given test, and its
+// subtests, have completed. If the database cannot be opened, then the test is
+// failed immediately.
+//
+// The database is limited to a single connection, since each connection to an
+// in-memory SQLite database would otherwise be a different database. This
+// means that a query made whilst the rows of another query are still open
+// will block, so rows should be closed before the next query is made.
+func NewMemDB(t testing.TB) *mgrt.DB {
+	t.Helper()
+
+	db, err := mgrt.Open("sqlite3", ":memory:", mgrt.WithSingleConn())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		db.Close()
+	})
+
+	if err := mgrt.EnsureTable(db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// Seed records the given revisions as performed in the given database,
+// without executing their SQL. This is useful for testing what happens when
+// revisions are run against a database that has already had some revisions
+// performed. The PerformedAt, PerformedBy, Duration, and Version of each
+// revision are recorded if set, otherwise PerformedAt will be the current time.
+// If any of the revisions cannot be recorded, then the test is failed
+// immediately.
+func Seed(t testing.TB, db *mgrt.DB, revs ...*mgrt.Revision) {
+	t.Helper()
+
+	q := db.Parameterize("INSERT INTO mgrt_revisions (id, author, comment, sql, performed_at, performed_by, duration_ms, version) VALUES (?, ?, ?, ?, ?, ?, ?, ?)")
+
+	for _, rev := range revs {
+		performedAt := rev.PerformedAt
+
+		if performedAt.IsZero() {
+			performedAt = time.Now()
+		}
+
+		version := sql.NullString{
+			String: rev.Version,
+			Valid:  rev.Version != "",
+		}
+
+		if _, err := db.Exec(q, rev.Slug(), rev.Author, rev.Comment, rev.SQL, performedAt.Unix(), rev.PerformedBy, rev.Duration.Milliseconds(), version); err != nil {
+			t.Fatalf("failed to seed revision %s: %s", rev.Slug(), err)
+		}
+	}
+
+	// Each revision was recorded without a hash, so they are hashed the same
+	// way they would be had they been performed.
+	if _, err := mgrt.BackfillHashes(db); err != nil {
+		t.Fatal(err)
+	}
+}
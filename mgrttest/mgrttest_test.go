@@ -0,0 +1,84 @@
+// +build sqlite3
+
+package mgrttest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/andrewpillar/mgrt/v3"
+)
+
+func Test_NewMemDB(t *testing.T) {
+	db := NewMemDB(t)
+
+	revs, err := mgrt.GetRevisions(db, -1)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(revs) != 0 {
+		t.Fatalf("unexpected revisions, expected=%d, got=%d\n", 0, len(revs))
+	}
+
+	// Each database is separate from the others.
+	Seed(t, NewMemDB(t), &mgrt.Revision{ID: "20060102150405", Author: "Andrew", SQL: "SELECT 1;"})
+
+	if revs, _ := mgrt.GetRevisions(db, -1); len(revs) != 0 {
+		t.Fatalf("unexpected revisions, expected=%d, got=%d\n", 0, len(revs))
+	}
+}
+
+func Test_Seed(t *testing.T) {
+	db := NewMemDB(t)
+
+	performedAt := time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)
+
+	seeded := &mgrt.Revision{
+		ID:          "20060102150405",
+		Author:      "Andrew",
+		Comment:     "Add users",
+		SQL:         "CREATE TABLE users ( id INT NOT NULL UNIQUE );",
+		PerformedAt: performedAt,
+		PerformedBy: "andrew@host",
+		Duration:    time.Second,
+	}
+
+	Seed(t, db, seeded)
+
+	rev, err := mgrt.GetRevision(db, seeded.ID)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !rev.PerformedAt.Equal(performedAt) || rev.PerformedBy != seeded.PerformedBy || rev.Duration != seeded.Duration {
+		t.Errorf("unexpected revision, expected=%+v, got=%+v\n", *seeded, *rev)
+	}
+
+	if err := mgrt.VerifyRevisions(db, seeded); err != nil {
+		t.Errorf("unexpected error verifying seeded revision: %s\n", err)
+	}
+
+	pending := &mgrt.Revision{
+		ID:     "20060102150406",
+		Author: "Andrew",
+		SQL:    "CREATE TABLE posts ( id INT NOT NULL UNIQUE );",
+	}
+
+	err = mgrt.PerformRevisions(db, seeded, pending)
+
+	if !mgrt.IsAllPerformed(err) {
+		t.Fatalf("expected seeded revision to be performed, got=%v\n", err)
+	}
+
+	if _, err := db.Exec("SELECT id FROM posts"); err != nil {
+		t.Errorf("expected pending revision to be performed: %s\n", err)
+	}
+
+	// The SQL of the seeded revision was never executed.
+	if _, err := db.Exec("SELECT id FROM users"); err == nil {
+		t.Errorf("expected seeded revision to not be executed")
+	}
+}
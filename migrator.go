@@ -0,0 +1,620 @@
+package mgrt
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"os/user"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Logger is the interface used by a Migrator for logging the revisions it
+// performs. This is satisfied by *log.Logger from the stdlib.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// Migrator performs revisions against a database. The zero value of each
+// field, other than DB, is a valid default.
+type Migrator struct {
+	// DB is the database to perform revisions against.
+	DB *DB
+
+	// Logger is used to log each revision that is performed, skipped, or that
+	// fails, along with how long it took. If nil, then nothing is logged.
+	Logger Logger
+
+	// PerformedBy is recorded against each revision that is performed. If
+	// empty, then this will be the current user and hostname in the form of
+	// user@hostname.
+	PerformedBy string
+
+	// Timeout is how long the SQL of each revision is given to execute. If
+	// exceeded, then the statement is cancelled, and a *RevisionError wrapping
+	// ErrTimeout is returned. If zero, then there is no timeout. How the
+	// statement is cancelled depends on the driver. PostgreSQL will cancel the
+	// query on the server, MySQL will close the connection, though the query
+	// may still run to completion on the server, and SQLite will interrupt the
+	// query.
+	Timeout time.Duration
+
+	// SplitStatements splits the SQL of each revision into its individual
+	// statements, which are then executed one after the other. This is for
+	// drivers that will not execute multiple statements at once. Semicolons
+	// within strings, comments, and dollar quoted strings are not treated as
+	// separators, following the dialect of the database's Type, however this
+	// is not a full SQL parser, so should only be used when necessary.
+	SplitStatements bool
+
+	// LockTTL is how long the lock is held for when performing a batch of
+	// revisions. If non-zero, then the lock is acquired via AcquireLock with
+	// PerformedBy as its owner before the revisions are performed, and is
+	// released afterwards. If the lock is held by another owner, then a
+	// *LockError is returned and nothing is performed.
+	LockTTL time.Duration
+
+	// LockTimeout is how long to wait for the lock if it is held by another
+	// owner when LockTTL is set. The lock is polled until it is acquired, or
+	// until the timeout passes, in which case the *LockError is returned. If
+	// zero, then the *LockError is returned immediately.
+	LockTimeout time.Duration
+
+	// OnProgress is called after each revision in a batch is performed, or
+	// skipped, with the number of revisions done so far, and the total number
+	// of revisions in the batch. If nil, then nothing is called.
+	OnProgress func(done, total int, rev *Revision)
+
+	// LogStatements logs each statement of a revision via the Logger as it is
+	// executed, along with how long it took.
+	LogStatements bool
+
+	// Strict checks the hash of each revision that has already been performed
+	// against the hash that was recorded when it was performed. If they
+	// differ, then a *RevisionError wrapping ErrChanged is returned instead of
+	// ErrPerformed, so a revision that was changed after it was performed is
+	// not silently skipped. Revisions performed without a hash being recorded
+	// are not checked.
+	Strict bool
+
+	// AfterBatch is called once a batch of revisions has been performed
+	// successfully, for example to dump the schema of the database to a file.
+	// This is not called if any revision in the batch fails, though revisions
+	// that were already performed do not count as a failure. If this returns an
+	// error, then that is returned from the batch. If nil, then nothing is
+	// called.
+	AfterBatch func(db *sql.DB) error
+
+	// Vars are the variables the SQL of each revision is rendered with via
+	// text/template before it is performed, for example {{.Schema}}. The
+	// rendered SQL is what is executed, and what is recorded. Referencing a
+	// variable that is not set is an error. If nil, then the SQL is performed
+	// as is.
+	//
+	// The variables are substituted into the SQL verbatim, without any quoting
+	// or escaping, so this is open to SQL injection. These should only be used
+	// for values you control, such as the names of schemas, and never for
+	// input from users.
+	Vars map[string]string
+
+	// NoBootstrap disables bootstrapping. When a batch of revisions is
+	// performed against a database in which no revisions have been performed,
+	// such as a new database, then the revisions are bootstrapped. They are
+	// not checked to see if they have already been performed, and they are all
+	// performed within a single transaction, so if any of them fail, then none
+	// of them are performed. This is much faster for a large number of
+	// revisions. Bootstrapping is only done for SQLite and PostgreSQL, and only
+	// if none of the revisions need to be performed outside of a transaction.
+	NoBootstrap bool
+
+	// NormalizeSQL normalizes the SQL of each revision via NormalizeSQL before
+	// its hash is compared against the hash that was recorded when it was
+	// performed, via Strict or Verify. This means that a revision that has
+	// only been reformatted, such as by changing its indentation or line
+	// endings, is not treated as changed. The normalization is lexical, not
+	// semantic, so whitespace within string literals is normalized too, and
+	// any other change to the SQL is treated as a change. If false, then the
+	// SQL is compared exactly.
+	NormalizeSQL bool
+
+	// MaxSkew is how far into the future the time of a revision's ID can be
+	// when it is performed, to allow for clocks that are slightly out. A
+	// revision with an ID further in the future than this, such as one created
+	// on a machine with the wrong time, would sort after every other revision,
+	// so a *RevisionError wrapping ErrFuture is returned instead of performing
+	// it. When performing a batch of revisions, nothing is performed if any of
+	// them are too far in the future. If zero, then this is not checked.
+	MaxSkew time.Duration
+
+	// CompressSQL gzip compresses the SQL of each revision before it is
+	// recorded in the mgrt_revisions table, which reduces the size of the
+	// table for revisions with a lot of SQL, such as those that load data. The
+	// encoding is recorded alongside the SQL, so it is decompressed when read
+	// back via GetRevision or GetRevisions, and revisions recorded without
+	// compression can still be read. The hash of a revision is always of its
+	// uncompressed SQL.
+	CompressSQL bool
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Printf(string, ...interface{}) {}
+
+// performedBy returns the user@hostname of the current process. Either part
+// is omitted if it cannot be determined.
+func performedBy() string {
+	var name string
+
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+
+	host, err := os.Hostname()
+
+	if err != nil || host == "" {
+		return name
+	}
+
+	if name == "" {
+		return host
+	}
+	return name + "@" + host
+}
+
+func (m *Migrator) performedBy() string {
+	if m.PerformedBy == "" {
+		return performedBy()
+	}
+	return m.PerformedBy
+}
+
+// recordedSQL returns the SQL of the given revision as it should be recorded,
+// along with its encoding, which is only valid if the SQL was compressed.
+func (m *Migrator) recordedSQL(r *Revision) (string, sql.NullString, error) {
+	if !m.CompressSQL {
+		return r.SQL, sql.NullString{}, nil
+	}
+
+	s, encoding, err := encodeSQL(r.SQL)
+
+	if err != nil {
+		return "", sql.NullString{}, err
+	}
+	return s, sql.NullString{String: encoding, Valid: true}, nil
+}
+
+func (m *Migrator) logger() Logger {
+	if m.Logger == nil {
+		return nopLogger{}
+	}
+	return m.Logger
+}
+
+// PerformRevisions will perform the given revisions against the Migrator's
+// database. The mgrt_revisions table will be created via EnsureTable if it
+// does not already exist. The given revisions will be sorted into ascending
+// order first before they are performed. If any of the given revisions have
+// already been performed then the Errors type will be returned containing
+// *RevisionError for each revision that was already performed. If all of them
+// had already been performed, then the returned Errors will also contain
+// ErrNoPending, so it will match ErrNoPending via errors.Is. If any of the
+// given revisions are invalid, as reported by Validate, or have a duplicate ID,
+// then nothing is performed.
+func (m *Migrator) PerformRevisions(revs ...*Revision) error {
+	return m.performRevisions("", false, revs)
+}
+
+// EnsureRevisions is like PerformRevisions, only revisions that have already
+// been performed are silently skipped, rather than reported. This will return
+// nil once all of the given revisions have been performed, whether by this
+// call or a previous one. This is useful when the same revisions are run
+// repeatedly against the same database, for example in CI.
+func (m *Migrator) EnsureRevisions(revs ...*Revision) error {
+	return m.performRevisions("", true, revs)
+}
+
+// PerformRevisionsCategory is like PerformRevisions, only the revisions that
+// are not in the given category are not performed. An empty category is the
+// default category, so only revisions without a category would be performed.
+func (m *Migrator) PerformRevisionsCategory(category string, revs ...*Revision) error {
+	return m.performRevisions("", false, filterCategory(category, revs))
+}
+
+// PerformRevisionsTo is like PerformRevisions, only it stops once the revision
+// with the given target ID has been performed, any revisions after the target
+// are not performed. The target ID should include the category of the revision
+// if it has one. If the target is not in the given revisions, then a
+// *RevisionError wrapping ErrNotFound is returned, and nothing is performed.
+func (m *Migrator) PerformRevisionsTo(target string, revs ...*Revision) error {
+	if target == "" {
+		return &RevisionError{Err: ErrNotFound}
+	}
+	return m.performRevisions(target, false, revs)
+}
+
+// filterCategory returns the revisions that are in the given category.
+func filterCategory(category string, revs []*Revision) []*Revision {
+	filtered := make([]*Revision, 0, len(revs))
+
+	for _, rev := range revs {
+		if rev.Category == category {
+			filtered = append(filtered, rev)
+		}
+	}
+	return filtered
+}
+
+// performRevisions performs the given revisions up to and including the given
+// target, if any. If ensure is true then revisions that have already been
+// performed are not reported.
+func (m *Migrator) performRevisions(target string, ensure bool, revs0 []*Revision) error {
+	invalid := make(Errors, 0)
+
+	for _, rev := range revs0 {
+		if err := rev.Validate(); err != nil {
+			invalid = append(invalid, err)
+		}
+	}
+
+	if err := invalid.err(); err != nil {
+		return err
+	}
+
+	c := Collection{
+		MaxSkew: m.MaxSkew,
+	}
+
+	for _, rev := range revs0 {
+		if err := c.Put(rev); err != nil {
+			return err
+		}
+	}
+
+	revs := c.Slice()
+
+	if target != "" {
+		end := -1
+
+		for i, rev := range revs {
+			if rev.Slug() == target {
+				end = i
+				break
+			}
+		}
+
+		if end < 0 {
+			return &RevisionError{
+				ID:  target,
+				Err: ErrNotFound,
+			}
+		}
+		revs = revs[:end+1]
+	}
+
+	if err := EnsureTable(m.DB); err != nil {
+		return err
+	}
+
+	if m.LockTTL > 0 {
+		release, err := m.acquireLock()
+
+		if err != nil {
+			return err
+		}
+		defer release()
+	}
+
+	bootstrap, err := m.canBootstrap(revs)
+
+	if err != nil {
+		return err
+	}
+
+	errs := Errors(make([]error, 0, len(revs)))
+
+	if bootstrap {
+		if err := m.bootstrap(revs); err != nil {
+			return err
+		}
+	} else {
+		for i, rev := range revs {
+			if err := m.Perform(rev); err != nil {
+				if !errors.Is(err, ErrPerformed) {
+					return err
+				}
+
+				if !ensure {
+					errs = append(errs, err)
+				}
+			}
+
+			if m.OnProgress != nil {
+				m.OnProgress(i+1, len(revs), rev)
+			}
+		}
+	}
+
+	if m.AfterBatch != nil {
+		if err := m.AfterBatch(m.DB.DB); err != nil {
+			return err
+		}
+	}
+
+	if len(errs) > 0 && len(errs) == len(revs) {
+		errs = append(errs, ErrNoPending)
+	}
+	return errs.err()
+}
+
+// Perform will perform the given Revision against the Migrator's database. If
+// the Revision is emtpy, then nothing happens. If the Revision has already
+// been performed, then ErrPerformed is returned. The SQL of the Revision is
+// loaded first via EnsureLoaded, and rendered with the Migrator's Vars if any
+// are set. If the Revision fails, then a *RevisionError is returned with the
+// SQLState and Code of the underlying error, if the driver exposes them.
+func (m *Migrator) Perform(r *Revision) error {
+	log := m.logger()
+
+	if err := checkSkew(r, m.MaxSkew); err != nil {
+		log.Printf("revision %s failed: %s", r.Slug(), err)
+		return err
+	}
+
+	r, err := m.prepare(r)
+
+	if err != nil {
+		log.Printf("revision %s failed: %s", r.Slug(), err)
+		return wrapRevisionError(m.DB, r, err)
+	}
+
+	if r.SQL == "" {
+		log.Printf("revision %s skipped: empty", r.Slug())
+		return nil
+	}
+
+	start := time.Now()
+
+	if err := m.perform(r); err != nil {
+		if errors.Is(err, ErrPerformed) {
+			if m.Strict {
+				if err := m.verify(r); err != nil {
+					log.Printf("revision %s failed: %s", r.Slug(), err)
+					return err
+				}
+			}
+
+			log.Printf("revision %s skipped: already performed", r.Slug())
+			return err
+		}
+
+		log.Printf("revision %s failed after %s: %s", r.Slug(), time.Since(start), err)
+		return err
+	}
+
+	log.Printf("revision %s performed in %s", r.Slug(), time.Since(start))
+	return nil
+}
+
+// prepare loads the SQL of the given Revision via EnsureLoaded, and renders it
+// with the Migrator's Vars if any are set. The returned Revision is the one to
+// perform.
+func (m *Migrator) prepare(r *Revision) (*Revision, error) {
+	if err := r.EnsureLoaded(); err != nil {
+		return r, err
+	}
+
+	if m.Vars != nil {
+		rendered, err := m.render(r)
+
+		if err != nil {
+			return r, err
+		}
+		r = rendered
+	}
+	return r, nil
+}
+
+// context returns the context for performing a single Revision, which is
+// cancelled once the Migrator's Timeout has passed, if any.
+func (m *Migrator) context() (context.Context, context.CancelFunc) {
+	if m.Timeout > 0 {
+		return context.WithTimeout(context.Background(), m.Timeout)
+	}
+	return context.WithCancel(context.Background())
+}
+
+// execute executes the SQL of the given Revision via the given Execer. If
+// SplitStatements is set, then each statement is executed in turn.
+func (m *Migrator) execute(ctx context.Context, e Execer, r *Revision) error {
+	stmts := []string{r.SQL}
+
+	if m.SplitStatements {
+		stmts = splitStatements(m.DB.Type, r.SQL)
+	}
+
+	for _, stmt := range stmts {
+		start := time.Now()
+
+		_, err := e.ExecContext(ctx, stmt)
+
+		if m.LogStatements {
+			m.logger().Printf("revision %s statement executed in %s:\n%s", r.Slug(), time.Since(start), stmt)
+		}
+
+		if err != nil {
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				err = ErrTimeout
+			}
+			return wrapRevisionError(m.DB, r, err)
+		}
+	}
+	return nil
+}
+
+// render returns a copy of the given Revision with its SQL rendered via
+// text/template against the Migrator's Vars.
+func (m *Migrator) render(r *Revision) (*Revision, error) {
+	tmpl, err := template.New(r.Slug()).Option("missingkey=error").Parse(r.SQL)
+
+	if err != nil {
+		return nil, &RevisionError{
+			ID:  r.Slug(),
+			Err: err,
+		}
+	}
+
+	var buf strings.Builder
+
+	if err := tmpl.Execute(&buf, m.Vars); err != nil {
+		return nil, &RevisionError{
+			ID:  r.Slug(),
+			Err: err,
+		}
+	}
+
+	rendered := *r
+	rendered.SQL = buf.String()
+
+	return &rendered, nil
+}
+
+// Verify checks the given revisions against the revisions that have been
+// performed in the database. If the hash of a given revision differs from the
+// hash that was recorded when it was performed, then the Errors type will be
+// returned containing a *RevisionError wrapping ErrChanged for each revision
+// that has changed. Revisions that have not been performed, or that were
+// performed without a hash being recorded, are skipped.
+func (m *Migrator) Verify(revs ...*Revision) error {
+	errs := Errors(make([]error, 0, len(revs)))
+
+	for _, rev := range revs {
+		if err := m.verify(rev); err != nil {
+			if errors.Is(err, ErrNotFound) {
+				continue
+			}
+
+			if !errors.Is(err, ErrChanged) {
+				return err
+			}
+			errs = append(errs, err)
+		}
+	}
+	return errs.err()
+}
+
+// verify checks the hash of the given Revision against the hash that was
+// recorded when it was performed. If they differ, then a *RevisionError
+// wrapping ErrChanged is returned. If NormalizeSQL is set, then the revision
+// is only treated as changed if it also differs from the revision that was
+// performed once both have been normalized.
+func (m *Migrator) verify(r *Revision) error {
+	performed, err := GetRevision(m.DB, r.Slug())
+
+	if err != nil {
+		return err
+	}
+
+	if performed.Hash == "" || performed.Hash == r.genHash() {
+		return nil
+	}
+
+	if m.NormalizeSQL && performed.normalizedHash() == r.normalizedHash() {
+		return nil
+	}
+
+	return &RevisionError{
+		ID:  r.Slug(),
+		Err: ErrChanged,
+	}
+}
+
+// perform performs the given Revision within a transaction, so the Revision is
+// only recorded as performed if all of its SQL was executed. If the database
+// was given an Execer via With, then that is used instead, and it is up to the
+// caller to commit it. Note that some databases, such as MySQL, implicitly
+// commit the transaction for statements that change the schema.
+//
+// If the Revision has NoTransaction set, then it is performed directly against
+// the database. If any of its statements fail, then those before it will not
+// be undone, and the Revision will not be recorded as performed.
+//
+// If the Revision has NoRecord set, then it is neither checked to see if it has
+// been performed, nor recorded as performed, so it is performed every time.
+func (m *Migrator) perform(r *Revision) error {
+	db := m.DB
+
+	if !r.NoRecord {
+		if err := RevisionPerformed(db, r); err != nil {
+			return wrapRevisionError(m.DB, r, err)
+		}
+	}
+
+	ctx, cancel := m.context()
+	defer cancel()
+
+	var (
+		e  Execer = db.execer
+		tx *sql.Tx
+	)
+
+	if e == nil && r.NoTransaction {
+		e = db.DB
+	}
+
+	if e == nil {
+		var err error
+
+		tx, err = db.BeginTx(ctx, nil)
+
+		if err != nil {
+			return wrapRevisionError(m.DB, r, err)
+		}
+
+		defer tx.Rollback()
+
+		e = tx
+	}
+
+	start := time.Now()
+
+	if err := m.execute(ctx, e, r); err != nil {
+		return err
+	}
+
+	duration := time.Since(start)
+
+	if r.NoRecord {
+		if tx != nil {
+			if err := tx.Commit(); err != nil {
+				return wrapRevisionError(m.DB, r, err)
+			}
+		}
+		return nil
+	}
+
+	q := db.Parameterize("INSERT INTO mgrt_revisions (id, author, comment, sql, performed_at, hash, performed_by, duration_ms, version, sql_encoding) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
+
+	version := sql.NullString{
+		String: r.Version,
+		Valid:  r.Version != "",
+	}
+
+	recorded, encoding, err := m.recordedSQL(r)
+
+	if err != nil {
+		return wrapRevisionError(m.DB, r, err)
+	}
+
+	if _, err := e.ExecContext(ctx, q, r.Slug(), r.Author, r.Comment, recorded, now().Unix(), r.genHash(), m.performedBy(), duration.Milliseconds(), version, encoding); err != nil {
+		return wrapRevisionError(m.DB, r, err)
+	}
+
+	if tx != nil {
+		if err := tx.Commit(); err != nil {
+			return wrapRevisionError(m.DB, r, err)
+		}
+	}
+	return nil
+}
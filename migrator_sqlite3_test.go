@@ -0,0 +1,1059 @@
+// +build sqlite3
+
+package mgrt
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+func Test_MigratorLogger(t *testing.T) {
+	tmp, err := ioutil.TempFile("", "mgrt-db-*")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.Remove(tmp.Name())
+
+	db, err := Open("sqlite3", tmp.Name())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	var buf bytes.Buffer
+
+	m := Migrator{
+		DB:     db,
+		Logger: log.New(&buf, "", 0),
+	}
+
+	revs := []*Revision{
+		{ID: "20060102150405", Author: "Andrew", SQL: "CREATE TABLE users ( id INT NOT NULL UNIQUE );"},
+		{ID: "20060102150406", Author: "Andrew", SQL: "ALTER TABLE nonexistent ADD COLUMN username VARCHAR NOT NULL;"},
+	}
+
+	if err := m.Perform(revs[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	m.Perform(revs[0])
+
+	if err := m.Perform(revs[1]); err == nil {
+		t.Fatal("expected error for revision against nonexistent table")
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+
+	prefixes := []string{
+		"revision 20060102150405 performed in ",
+		"revision 20060102150405 skipped: already performed",
+		"revision 20060102150406 failed after ",
+	}
+
+	if len(lines) != len(prefixes) {
+		t.Fatalf("unexpected log lines, expected=%d, got=%d\n%s", len(prefixes), len(lines), buf.String())
+	}
+
+	for i, prefix := range prefixes {
+		if !strings.HasPrefix(lines[i], prefix) {
+			t.Errorf("lines[%d] - expected prefix=%q, got=%q\n", i, prefix, lines[i])
+		}
+	}
+}
+
+func Test_MigratorPerformedBy(t *testing.T) {
+	tmp, err := ioutil.TempFile("", "mgrt-db-*")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.Remove(tmp.Name())
+
+	db, err := Open("sqlite3", tmp.Name())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	m := Migrator{
+		DB:          db,
+		PerformedBy: "deploy@ci",
+	}
+
+	revs := []*Revision{
+		{ID: "20060102150405", Author: "Andrew", SQL: "CREATE TABLE users ( id INT NOT NULL UNIQUE );"},
+		{ID: "20060102150406", Author: "Andrew", SQL: "CREATE TABLE posts ( id INT NOT NULL UNIQUE );"},
+	}
+
+	if err := m.Perform(revs[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := PerformRevisions(db, revs[1]); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		id       string
+		expected string
+	}{
+		{"20060102150405", "deploy@ci"},
+		{"20060102150406", performedBy()},
+	}
+
+	for i, test := range tests {
+		rev, err := GetRevision(db, test.id)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if rev.PerformedBy != test.expected {
+			t.Errorf("tests[%d] - unexpected performed by, expected=%q, got=%q\n", i, test.expected, rev.PerformedBy)
+		}
+	}
+}
+
+func Test_MigratorTimeout(t *testing.T) {
+	tmp, err := ioutil.TempFile("", "mgrt-db-*")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.Remove(tmp.Name())
+
+	db, err := Open("sqlite3", tmp.Name())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	m := Migrator{
+		DB:      db,
+		Timeout: 50 * time.Millisecond,
+	}
+
+	rev := &Revision{
+		ID:     "20060102150405",
+		Author: "Andrew",
+		SQL: `CREATE TABLE numbers AS
+WITH RECURSIVE n(x) AS (SELECT 1 UNION ALL SELECT x + 1 FROM n WHERE x < 1000000000)
+SELECT x FROM n;`,
+	}
+
+	err = m.Perform(rev)
+
+	if !errors.Is(err, ErrTimeout) {
+		t.Fatalf("unexpected error, expected=%q, got=%q\n", ErrTimeout, err)
+	}
+
+	var rerr *RevisionError
+
+	if !errors.As(err, &rerr) || rerr.ID != rev.ID {
+		t.Fatalf("expected *RevisionError for revision %s, got=%q\n", rev.ID, err)
+	}
+
+	if _, err := GetRevision(db, rev.ID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("unexpected error, expected=%q, got=%q\n", ErrNotFound, err)
+	}
+}
+
+func Test_MigratorSplitStatements(t *testing.T) {
+	tmp, err := ioutil.TempFile("", "mgrt-db-*")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.Remove(tmp.Name())
+
+	db, err := Open("sqlite3", tmp.Name())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	m := Migrator{
+		DB:              db,
+		SplitStatements: true,
+	}
+
+	revs := []*Revision{
+		{ID: "20060102150405", Author: "Andrew", SQL: "CREATE TABLE users ( id INT );\nINSERT INTO users VALUES (1);"},
+		{ID: "20060102150406", Author: "Andrew", SQL: "CREATE TABLE posts ( id INT );\nINSERT INTO nonexistent VALUES (1);"},
+	}
+
+	if err := m.Perform(revs[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.Perform(revs[1]); err == nil {
+		t.Fatal("expected error for insert into nonexistent table")
+	}
+
+	if _, err := db.Exec("SELECT * FROM posts"); err == nil {
+		t.Fatal("expected failed revision to be rolled back")
+	}
+
+	if _, err := GetRevision(db, revs[1].ID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("unexpected error, expected=%q, got=%q\n", ErrNotFound, err)
+	}
+}
+
+func Test_MigratorWith(t *testing.T) {
+	tmp, err := ioutil.TempFile("", "mgrt-db-*")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.Remove(tmp.Name())
+
+	db, err := Open("sqlite3", tmp.Name())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	revs := []*Revision{
+		{ID: "20060102150405", Author: "Andrew", SQL: "CREATE TABLE users ( id INT NOT NULL UNIQUE );"},
+		{ID: "20060102150406", Author: "Andrew", SQL: "CREATE TABLE posts ( id INT NOT NULL UNIQUE );"},
+	}
+
+	tx, err := db.Begin()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	txdb := db.With(tx)
+
+	for _, rev := range revs {
+		if err := rev.Perform(txdb); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := GetRevision(txdb, revs[1].ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, rev := range revs {
+		if _, err := GetRevision(db, rev.ID); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("unexpected error, expected=%q, got=%q\n", ErrNotFound, err)
+		}
+	}
+
+	if _, err := db.Exec("SELECT * FROM users"); err == nil {
+		t.Fatal("expected users table to be rolled back")
+	}
+}
+
+func Test_MigratorNoTransaction(t *testing.T) {
+	tmp, err := ioutil.TempFile("", "mgrt-db-*")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.Remove(tmp.Name())
+
+	db, err := Open("sqlite3", tmp.Name())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	m := Migrator{DB: db}
+
+	// VACUUM cannot be run within a transaction in SQLite.
+	rev := &Revision{ID: "20060102150405", Author: "Andrew", SQL: "VACUUM;"}
+
+	if err := m.Perform(rev); err == nil {
+		t.Fatal("expected error for VACUUM within a transaction")
+	}
+
+	rev.NoTransaction = true
+
+	if err := m.Perform(rev); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := GetRevision(db, rev.ID); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_MigratorOnProgress(t *testing.T) {
+	tmp, err := ioutil.TempFile("", "mgrt-db-*")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.Remove(tmp.Name())
+
+	db, err := Open("sqlite3", tmp.Name())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	revs := []*Revision{
+		{ID: "20060102150406", Author: "Andrew", SQL: "CREATE TABLE posts ( id INT NOT NULL UNIQUE );"},
+		{ID: "20060102150405", Author: "Andrew", SQL: "CREATE TABLE users ( id INT NOT NULL UNIQUE );"},
+		{ID: "20060102150407", Author: "Andrew", SQL: "CREATE TABLE tags ( id INT NOT NULL UNIQUE );"},
+	}
+
+	if err := PerformRevisions(db, revs[1]); err != nil {
+		t.Fatal(err)
+	}
+
+	progress := make([]string, 0, len(revs))
+
+	m := Migrator{
+		DB: db,
+		OnProgress: func(done, total int, rev *Revision) {
+			progress = append(progress, fmt.Sprintf("%d/%d %s", done, total, rev.ID))
+		},
+	}
+
+	if err := m.PerformRevisions(revs...); !IsAllPerformed(err) {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"1/3 20060102150405",
+		"2/3 20060102150406",
+		"3/3 20060102150407",
+	}
+
+	if len(progress) != len(expected) {
+		t.Fatalf("unexpected progress, expected=%q, got=%q\n", expected, progress)
+	}
+
+	for i := range expected {
+		if progress[i] != expected[i] {
+			t.Errorf("progress[%d] - expected=%q, got=%q\n", i, expected[i], progress[i])
+		}
+	}
+}
+
+func Test_MigratorValidate(t *testing.T) {
+	tmp, err := ioutil.TempFile("", "mgrt-db-*")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.Remove(tmp.Name())
+
+	db, err := Open("sqlite3", tmp.Name())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	revs := []*Revision{
+		{ID: "20060102150405", Author: "Andrew", SQL: "CREATE TABLE users ( id INT NOT NULL UNIQUE );"},
+		{ID: "20060102150406", SQL: "CREATE TABLE posts ( id INT NOT NULL UNIQUE );"},
+		{ID: "20060102150407", Author: "Andrew", SQL: "  "},
+	}
+
+	err = PerformRevisions(db, revs...)
+
+	errs, ok := err.(Errors)
+
+	if !ok || len(errs) != 2 {
+		t.Fatalf("unexpected error, expected 2 errors, got=%q\n", err)
+	}
+
+	for i, substr := range []string{"author", "sql"} {
+		if !strings.Contains(errs[i].Error(), substr) {
+			t.Errorf("errs[%d] - expected error to name %s, got=%q\n", i, substr, errs[i])
+		}
+	}
+
+	if err := RevisionPerformed(db, revs[0]); err != nil {
+		t.Fatalf("expected no revisions to be performed, got=%q\n", err)
+	}
+}
+
+func Test_MigratorNoRecord(t *testing.T) {
+	tmp, err := ioutil.TempFile("", "mgrt-db-*")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.Remove(tmp.Name())
+
+	db, err := Open("sqlite3", tmp.Name())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	if _, err := db.Exec("CREATE TABLE refreshes ( id INT );"); err != nil {
+		t.Fatal(err)
+	}
+
+	revs := []*Revision{
+		{ID: "20060102150405", Author: "Andrew", SQL: "CREATE TABLE users ( id INT NOT NULL UNIQUE );"},
+		{ID: "20060102150406", Author: "Andrew", SQL: "INSERT INTO refreshes VALUES (1);", NoRecord: true},
+	}
+
+	m := Migrator{DB: db}
+
+	for i := 0; i < 2; i++ {
+		if err := m.PerformRevisions(revs...); err != nil && !IsAllPerformed(err) {
+			t.Fatalf("run[%d] - unexpected error %q\n", i, err)
+		}
+
+		if err := m.Perform(revs[1]); err != nil {
+			t.Fatalf("run[%d] - unexpected error %q\n", i, err)
+		}
+	}
+
+	var n int
+
+	if err := db.QueryRow("SELECT COUNT(*) FROM refreshes").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 4 {
+		t.Fatalf("unexpected number of refreshes, expected=4, got=%d\n", n)
+	}
+
+	if err := RevisionPerformed(db, revs[1]); err != nil {
+		t.Fatalf("expected revision to not be recorded, got=%q\n", err)
+	}
+
+	if err := RevisionPerformed(db, revs[0]); !errors.Is(err, ErrPerformed) {
+		t.Fatalf("unexpected error, expected=%q, got=%q\n", ErrPerformed, err)
+	}
+}
+
+func Test_MigratorCompressSQL(t *testing.T) {
+	tmp, err := ioutil.TempFile("", "mgrt-db-*")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.Remove(tmp.Name())
+
+	db, err := Open("sqlite3", tmp.Name())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	var buf bytes.Buffer
+
+	buf.WriteString("CREATE TABLE users ( id INT NOT NULL UNIQUE );\n")
+
+	for i := 0; i < 500; i++ {
+		fmt.Fprintf(&buf, "INSERT INTO users VALUES (%d);\n", i)
+	}
+
+	plain := &Revision{ID: "20060102150405", Author: "Andrew", SQL: "CREATE TABLE posts ( id INT );"}
+	large := &Revision{ID: "20060102150406", Author: "Andrew", SQL: buf.String()}
+
+	m := Migrator{DB: db}
+
+	if err := m.Perform(plain); err != nil {
+		t.Fatal(err)
+	}
+
+	m.CompressSQL = true
+
+	if err := m.Perform(large); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		recorded string
+		encoding string
+	)
+
+	if err := db.QueryRow("SELECT sql, sql_encoding FROM mgrt_revisions WHERE id = ?", large.ID).Scan(&recorded, &encoding); err != nil {
+		t.Fatal(err)
+	}
+
+	if encoding != sqlEncodingGzip {
+		t.Fatalf("unexpected sql encoding, expected=%q, got=%q\n", sqlEncodingGzip, encoding)
+	}
+
+	if len(recorded) >= len(large.SQL) {
+		t.Fatalf("expected recorded sql to be compressed, original=%d, recorded=%d\n", len(large.SQL), len(recorded))
+	}
+
+	rev, err := GetRevision(db, large.ID)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rev.SQL != large.SQL {
+		t.Fatalf("unexpected sql, expected=%q, got=%q\n", large.SQL, rev.SQL)
+	}
+
+	revs, err := GetRevisions(db, -1)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		plain.ID: plain.SQL,
+		large.ID: large.SQL,
+	}
+
+	for _, rev := range revs {
+		if rev.SQL != expected[rev.ID] {
+			t.Fatalf("unexpected sql for %s, expected=%q, got=%q\n", rev.ID, expected[rev.ID], rev.SQL)
+		}
+	}
+
+	if err := m.Verify(plain, large); err != nil {
+		t.Fatalf("unexpected error %q\n", err)
+	}
+}
+
+func Test_MigratorErrorCode(t *testing.T) {
+	tmp, err := ioutil.TempFile("", "mgrt-db-*")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.Remove(tmp.Name())
+
+	db, err := Open("sqlite3", tmp.Name())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	m := Migrator{DB: db}
+
+	create := &Revision{ID: "20060102150405", Author: "Andrew", SQL: "CREATE TABLE users ( id INT NOT NULL UNIQUE ); INSERT INTO users VALUES (1);"}
+
+	if err := m.Perform(create); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		rev  *Revision
+		code int
+	}{
+		{&Revision{ID: "20060102150406", Author: "Andrew", SQL: "CREAT TABLE posts ( id INT );"}, int(sqlite3.ErrError)},
+		{&Revision{ID: "20060102150407", Author: "Andrew", SQL: "INSERT INTO users VALUES (1);"}, int(sqlite3.ErrConstraintUnique)},
+	}
+
+	for i, test := range tests {
+		err := m.Perform(test.rev)
+
+		var rerr *RevisionError
+
+		if !errors.As(err, &rerr) {
+			t.Fatalf("tests[%d] - unexpected error, expected=%T, got=%T\n", i, rerr, err)
+		}
+
+		if rerr.ID != test.rev.Slug() {
+			t.Errorf("tests[%d] - unexpected id, expected=%q, got=%q\n", i, test.rev.Slug(), rerr.ID)
+		}
+
+		if rerr.Code != test.code {
+			t.Errorf("tests[%d] - unexpected code, expected=%d, got=%d\n", i, test.code, rerr.Code)
+		}
+
+		var serr sqlite3.Error
+
+		if !errors.As(err, &serr) {
+			t.Errorf("tests[%d] - expected error to wrap %T\n", i, serr)
+		}
+	}
+}
+
+func Test_MigratorMaxSkew(t *testing.T) {
+	tmp, err := ioutil.TempFile("", "mgrt-db-*")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.Remove(tmp.Name())
+
+	db, err := Open("sqlite3", tmp.Name())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	revs := []*Revision{
+		{ID: "20060102150405", Author: "Andrew", SQL: "CREATE TABLE users ( id INT NOT NULL UNIQUE );"},
+		{ID: time.Now().AddDate(1, 0, 0).Format(revisionIdFormat), Author: "Andrew", SQL: "CREATE TABLE posts ( id INT NOT NULL UNIQUE );"},
+	}
+
+	m := Migrator{
+		DB:      db,
+		MaxSkew: time.Hour,
+	}
+
+	if err := m.PerformRevisions(revs...); !errors.Is(err, ErrFuture) {
+		t.Fatalf("unexpected error, expected=%q, got=%q\n", ErrFuture, err)
+	}
+
+	if err := RevisionPerformed(db, revs[0]); err != nil {
+		t.Fatalf("expected no revisions to be performed, got=%q\n", err)
+	}
+
+	if err := m.Perform(revs[1]); !errors.Is(err, ErrFuture) {
+		t.Fatalf("unexpected error, expected=%q, got=%q\n", ErrFuture, err)
+	}
+
+	m.MaxSkew = 0
+
+	if err := m.PerformRevisions(revs...); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_MigratorAfterBatch(t *testing.T) {
+	tmp, err := ioutil.TempFile("", "mgrt-db-*")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.Remove(tmp.Name())
+
+	db, err := Open("sqlite3", tmp.Name())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	var tables []string
+
+	m := Migrator{
+		DB: db,
+		AfterBatch: func(db *sql.DB) error {
+			tables = tables[:0]
+
+			rows, err := db.Query("SELECT name FROM sqlite_master WHERE type = 'table' AND name LIKE 'mgrt_test_%' ORDER BY name")
+
+			if err != nil {
+				return err
+			}
+
+			defer rows.Close()
+
+			for rows.Next() {
+				var name string
+
+				if err := rows.Scan(&name); err != nil {
+					return err
+				}
+				tables = append(tables, name)
+			}
+			return rows.Err()
+		},
+	}
+
+	revs := []*Revision{
+		{ID: "20060102150405", Author: "Andrew", SQL: "CREATE TABLE mgrt_test_users ( id INT NOT NULL UNIQUE );"},
+		{ID: "20060102150406", Author: "Andrew", SQL: "CREATE TABLE mgrt_test_posts ( id INT NOT NULL UNIQUE );"},
+	}
+
+	if err := m.PerformRevisions(revs...); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := []string{"mgrt_test_posts", "mgrt_test_users"}; strings.Join(tables, ",") != strings.Join(expected, ",") {
+		t.Fatalf("unexpected tables, expected=%q, got=%q\n", expected, tables)
+	}
+
+	tables = nil
+
+	failed := []*Revision{
+		{ID: "20060102150407", Author: "Andrew", SQL: "CREATE TABLE mgrt_test_tags ( id INT NOT NULL UNIQUE );"},
+		{ID: "20060102150408", Author: "Andrew", SQL: "CREATE TABLE mgrt_test_users ( id INT NOT NULL UNIQUE );"},
+	}
+
+	if err := m.PerformRevisions(failed...); err == nil {
+		t.Fatal("expected error for revision that fails")
+	}
+
+	if tables != nil {
+		t.Errorf("expected AfterBatch not to be called for a failed batch, got tables=%q\n", tables)
+	}
+
+	if err := m.PerformRevisions(revs...); !IsAllPerformed(err) {
+		t.Fatal(err)
+	}
+
+	if len(tables) != 3 {
+		t.Errorf("expected AfterBatch to be called for already performed batch, got tables=%q\n", tables)
+	}
+
+	hookErr := errors.New("dump failed")
+
+	m.AfterBatch = func(*sql.DB) error { return hookErr }
+
+	if err := m.PerformRevisions(revs...); !errors.Is(err, hookErr) {
+		t.Errorf("unexpected error, expected=%q, got=%q\n", hookErr, err)
+	}
+}
+
+func Test_MigratorStrict(t *testing.T) {
+	tmp, err := ioutil.TempFile("", "mgrt-db-*")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.Remove(tmp.Name())
+
+	db, err := Open("sqlite3", tmp.Name())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	revs := []*Revision{
+		{ID: "20060102150405", Author: "Andrew", SQL: "CREATE TABLE users ( id INT NOT NULL UNIQUE );"},
+		{ID: "20060102150406", Author: "Andrew", SQL: "CREATE TABLE posts ( id INT NOT NULL UNIQUE );"},
+	}
+
+	m := Migrator{
+		DB:     db,
+		Strict: true,
+	}
+
+	if err := m.PerformRevisions(revs...); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.PerformRevisions(revs...); !IsAllPerformed(err) {
+		t.Fatalf("expected unchanged revisions to be reported as performed, got=%v\n", err)
+	}
+
+	changed := &Revision{
+		ID:     revs[1].ID,
+		Author: revs[1].Author,
+		SQL:    "CREATE TABLE posts ( id INT NOT NULL );",
+	}
+
+	if err := m.PerformRevisions(revs[0], changed); !errors.Is(err, ErrChanged) {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", ErrChanged, err)
+	}
+
+	m.Strict = false
+
+	if err := m.PerformRevisions(revs[0], changed); !IsAllPerformed(err) {
+		t.Fatalf("expected changed revision to be reported as performed without strict, got=%v\n", err)
+	}
+
+	if _, err := db.Exec("UPDATE mgrt_revisions SET hash = NULL"); err != nil {
+		t.Fatal(err)
+	}
+
+	m.Strict = true
+
+	if err := m.PerformRevisions(revs[0], changed); !IsAllPerformed(err) {
+		t.Fatalf("expected revision without a hash to not be checked, got=%v\n", err)
+	}
+}
+
+func Test_MigratorVars(t *testing.T) {
+	tmp, err := ioutil.TempFile("", "mgrt-db-*")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.Remove(tmp.Name())
+
+	db, err := Open("sqlite3", tmp.Name())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	rev := &Revision{ID: "20060102150405", Author: "Andrew", SQL: "CREATE TABLE {{.Prefix}}_users ( id INT NOT NULL UNIQUE );"}
+
+	missing := &Revision{ID: "20060102150406", Author: "Andrew", SQL: "CREATE TABLE {{.Table}} ( id INT NOT NULL UNIQUE );"}
+
+	vars := map[string]string{
+		"Prefix": "acme",
+	}
+
+	if err := PerformRevisionsWithVars(db, vars, rev); err != nil {
+		t.Fatal(err)
+	}
+
+	if rev.SQL != "CREATE TABLE {{.Prefix}}_users ( id INT NOT NULL UNIQUE );" {
+		t.Fatalf("expected revision sql to be unchanged, got=%q\n", rev.SQL)
+	}
+
+	performed, err := GetRevision(db, rev.ID)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "CREATE TABLE acme_users ( id INT NOT NULL UNIQUE );"
+
+	if performed.SQL != expected {
+		t.Fatalf("unexpected sql, expected=%q, got=%q\n", expected, performed.SQL)
+	}
+
+	if _, err := db.Exec("INSERT INTO acme_users (id) VALUES (1)"); err != nil {
+		t.Fatal(err)
+	}
+
+	err = PerformRevisionsWithVars(db, vars, missing)
+
+	if err == nil || !strings.Contains(err.Error(), "Table") {
+		t.Fatalf("expected error for undefined variable, got=%v\n", err)
+	}
+
+	if _, err := GetRevision(db, missing.ID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected revision to not be performed, got=%v\n", err)
+	}
+}
+
+// benchRevisions returns n revisions that each create a table.
+func benchRevisions(n int) []*Revision {
+	revs := make([]*Revision, 0, n)
+
+	t := time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)
+
+	for i := 0; i < n; i++ {
+		revs = append(revs, &Revision{
+			ID:     t.Add(time.Duration(i) * time.Second).Format(revisionIdFormat),
+			Author: "Andrew",
+			SQL:    fmt.Sprintf("CREATE TABLE t%d ( id INT NOT NULL UNIQUE );", i),
+		})
+	}
+	return revs
+}
+
+func Test_MigratorBootstrap(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mgrt-bootstrap-*")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	revs := benchRevisions(250)
+
+	db, err := Open("sqlite3", filepath.Join(dir, "bootstrap.db"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	m := Migrator{DB: db}
+
+	bootstrap, err := m.canBootstrap(revs)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bootstrap {
+		t.Fatal("expected empty database to be bootstrapped")
+	}
+
+	done := 0
+
+	m.OnProgress = func(n, total int, rev *Revision) {
+		done = n
+	}
+
+	if err := m.PerformRevisions(revs...); err != nil {
+		t.Fatal(err)
+	}
+
+	if done != len(revs) {
+		t.Fatalf("unexpected progress, expected=%d, got=%d\n", len(revs), done)
+	}
+
+	stats, err := RevisionStats(db)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stats.Total != int64(len(revs)) {
+		t.Fatalf("unexpected total, expected=%d, got=%d\n", len(revs), stats.Total)
+	}
+
+	err = m.PerformRevisions(revs...)
+
+	if !errors.Is(err, ErrNoPending) {
+		t.Fatalf("expected revisions to be performed, got=%v\n", err)
+	}
+
+	// The error should still be the Errors for each revision that was
+	// performed, for callers that check for ErrPerformed.
+	if errs, ok := err.(Errors); !ok || len(errs) != len(revs)+1 {
+		t.Fatalf("unexpected error, expected Errors for %d revisions, got=%T\n", len(revs), err)
+	}
+
+	if !errors.Is(err, ErrPerformed) || !IsAllPerformed(err) {
+		t.Fatalf("expected all revisions to be performed, got=%v\n", err)
+	}
+
+	if err := m.PerformRevisions(append(revs, benchRevisions(len(revs)+1)[len(revs)])...); errors.Is(err, ErrNoPending) {
+		t.Fatalf("unexpected error, expected pending revision to be performed, got=%v\n", err)
+	}
+
+	failing := append(benchRevisions(3), &Revision{
+		ID:     "20070102150405",
+		Author: "Andrew",
+		SQL:    "CREATE TABLE t0 ( id INT NOT NULL UNIQUE );",
+	})
+
+	for _, noBootstrap := range []bool{false, true} {
+		db, err := Open("sqlite3", filepath.Join(dir, fmt.Sprintf("failing-%v.db", noBootstrap)))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer db.Close()
+
+		m := Migrator{
+			DB:          db,
+			NoBootstrap: noBootstrap,
+		}
+
+		if err := m.PerformRevisions(failing...); err == nil {
+			t.Fatal("expected revision to fail")
+		}
+
+		stats, err := RevisionStats(db)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := int64(0)
+
+		if noBootstrap {
+			expected = 3
+		}
+
+		if stats.Total != expected {
+			t.Fatalf("NoBootstrap=%v - unexpected total, expected=%d, got=%d\n", noBootstrap, expected, stats.Total)
+		}
+	}
+}
+
+// Benchmark_PerformRevisions compares bootstrapping an empty database against
+// performing each revision in turn, as is done with NoBootstrap.
+func Benchmark_PerformRevisions(b *testing.B) {
+	for _, n := range []int{1000, 5000} {
+		revs := benchRevisions(n)
+
+		for _, noBootstrap := range []bool{false, true} {
+			name := "bootstrap"
+
+			if noBootstrap {
+				name = "no-bootstrap"
+			}
+
+			b.Run(fmt.Sprintf("%s/%d", name, n), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					b.StopTimer()
+
+					dir, err := ioutil.TempDir("", "mgrt-bench-*")
+
+					if err != nil {
+						b.Fatal(err)
+					}
+
+					db, err := Open("sqlite3", filepath.Join(dir, "bench.db"))
+
+					if err != nil {
+						b.Fatal(err)
+					}
+
+					m := Migrator{
+						DB:          db,
+						NoBootstrap: noBootstrap,
+					}
+
+					b.StartTimer()
+
+					if err := m.PerformRevisions(revs...); err != nil {
+						b.Fatal(err)
+					}
+
+					b.StopTimer()
+
+					db.Close()
+					os.RemoveAll(dir)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package mgrt
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Preflight checks that revisions can be performed against the given database
+// before any of them are, so a new environment fails early rather than part of
+// the way through a batch. See PreflightFunc for the checks that are made.
+func Preflight(db *DB) error {
+	return PreflightFunc(db, nil)
+}
+
+// PreflightFunc is like Preflight, only the given function is called with a
+// description of each check as it is made, along with the error from the check
+// if it failed. The checks are made in the following order, stopping at the
+// first that fails,
+//
+//   - the database can be connected to
+//   - the user can create and drop tables, by creating and dropping a uniquely
+//     named table within a transaction that is rolled back
+//   - the mgrt_revisions table can be read, or if it does not exist yet, can
+//     be created via EnsureTable within a transaction that is rolled back
+//
+// MySQL implicitly commits changes to the schema, so for MySQL the tables that
+// are created are dropped again. The error from the failed check is returned,
+// along with what needs to be done to fix it.
+func PreflightFunc(db *DB, fn func(check string, err error)) error {
+	if fn == nil {
+		fn = func(string, error) {}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), pingTimeout)
+	err := db.PingContext(ctx)
+	cancel()
+
+	if err != nil {
+		err = fmt.Errorf("cannot connect to the database, check that it is running and the dsn is correct: %w", err)
+	}
+
+	fn("database can be connected to", err)
+
+	if err != nil {
+		return err
+	}
+
+	if err := preflightSchema(db); err != nil {
+		err = fmt.Errorf("cannot create tables, grant the user privileges to change the schema: %w", err)
+		fn("user can create and drop tables", err)
+		return err
+	}
+
+	fn("user can create and drop tables", nil)
+
+	var n int64
+
+	if err := db.QueryRow("SELECT COUNT(*) FROM mgrt_revisions").Scan(&n); err != nil {
+		if !isNoTable(err) {
+			err = fmt.Errorf("cannot read the mgrt_revisions table, grant the user privileges to read and write it: %w", err)
+			fn("mgrt_revisions table can be read", err)
+			return err
+		}
+
+		if err := preflightTable(db); err != nil {
+			err = fmt.Errorf("cannot create the mgrt_revisions table, grant the user privileges to create it: %w", err)
+			fn("mgrt_revisions table can be created", err)
+			return err
+		}
+
+		fn("mgrt_revisions table can be created", nil)
+		return nil
+	}
+
+	fn("mgrt_revisions table can be read", nil)
+	return nil
+}
+
+// preflightSchema creates and drops a uniquely named table within a
+// transaction that is rolled back, so a table left behind by an earlier check
+// does not get in the way.
+func preflightSchema(db *DB) error {
+	tx, err := db.Begin()
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	table := fmt.Sprintf("mgrt_preflight_%d", time.Now().UnixNano())
+
+	if _, err := tx.Exec("CREATE TABLE " + table + " ( id INT )"); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("DROP TABLE " + table); err != nil {
+		return err
+	}
+	return nil
+}
+
+// preflightTable creates the mgrt_revisions table via EnsureTable within a
+// transaction that is rolled back. This is only done when the table does not
+// exist, so for MySQL, the table is dropped again afterwards. A *DB without an
+// InitExec function cannot create the table within a transaction, so for that
+// only the check that tables can be created is made.
+func preflightTable(db *DB) error {
+	if db.InitExec == nil {
+		return nil
+	}
+
+	tx, err := db.Begin()
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	txdb := db.With(tx)
+	txdb.table = &tableState{}
+
+	if err := EnsureTable(txdb); err != nil {
+		return err
+	}
+
+	if db.Type == "mysql" {
+		if _, err := tx.Exec("DROP TABLE mgrt_revisions"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isNoTable reports whether the given error is from querying a table that does
+// not exist. The message is checked, since each database reports this
+// differently.
+func isNoTable(err error) bool {
+	msg := strings.ToLower(err.Error())
+
+	return strings.Contains(msg, "no such table") ||
+		strings.Contains(msg, "does not exist") ||
+		strings.Contains(msg, "doesn't exist")
+}
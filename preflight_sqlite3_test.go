@@ -0,0 +1,97 @@
+// +build sqlite3
+
+package mgrt
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func Test_Preflight(t *testing.T) {
+	tmp, err := ioutil.TempFile("", "mgrt-db-*")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.Remove(tmp.Name())
+
+	db, err := OpenLazy("sqlite3", tmp.Name())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	// A table left behind by an older version of the check should not get in
+	// the way.
+	if _, err := db.Exec("CREATE TABLE mgrt_preflight ( id INT )"); err != nil {
+		t.Fatal(err)
+	}
+
+	checks := make([]string, 0)
+
+	record := func(check string, err error) {
+		if err != nil {
+			t.Errorf("unexpected error for check %q: %q\n", check, err)
+		}
+		checks = append(checks, check)
+	}
+
+	if err := PreflightFunc(db, record); err != nil {
+		t.Fatal(err)
+	}
+
+	if last := checks[len(checks)-1]; last != "mgrt_revisions table can be created" {
+		t.Fatalf("unexpected check, expected=%q, got=%q\n", "mgrt_revisions table can be created", last)
+	}
+
+	if _, err := db.Exec("SELECT * FROM mgrt_revisions"); err == nil {
+		t.Fatal("expected mgrt_revisions table to be rolled back")
+	}
+
+	if err := EnsureTable(db); err != nil {
+		t.Fatal(err)
+	}
+
+	checks = checks[:0]
+
+	if err := PreflightFunc(db, record); err != nil {
+		t.Fatal(err)
+	}
+
+	if last := checks[len(checks)-1]; last != "mgrt_revisions table can be read" {
+		t.Fatalf("unexpected check, expected=%q, got=%q\n", "mgrt_revisions table can be read", last)
+	}
+
+	var n int
+
+	if err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE name LIKE 'mgrt_preflight_%'").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 0 {
+		t.Fatalf("expected preflight tables to be dropped, found %d\n", n)
+	}
+
+	ro, err := OpenReadOnly("sqlite3", "file:"+tmp.Name()+"?mode=ro")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer ro.Close()
+
+	err = Preflight(ro)
+
+	if err == nil {
+		t.Fatal("expected error for read-only database")
+	}
+
+	if !strings.Contains(err.Error(), "cannot create tables") {
+		t.Errorf("unexpected error, expected=%q, got=%q\n", "cannot create tables", err)
+	}
+}
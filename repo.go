@@ -0,0 +1,237 @@
+package mgrt
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultRevisionsDir is the directory that revision files are kept in by
+// default, relative to the current directory.
+const DefaultRevisionsDir = "revisions"
+
+// Repo is a directory of revision files. Each revision is kept in a file named
+// after its ID, within a sub-directory for its category if it has one, for
+// example revisions/perms/20060102150405.sql. Multiple Repos can be used at
+// once, for working with independent sets of revisions in the same process.
+type Repo struct {
+	// Dir is the directory the revision files are in. If empty, then
+	// DefaultRevisionsDir is used.
+	Dir string
+}
+
+func (r *Repo) dir() string {
+	if r.Dir == "" {
+		return DefaultRevisionsDir
+	}
+	return r.Dir
+}
+
+// Path returns the path to the file for the revision with the given ID. The
+// ID should be prefixed with the category of the revision if it has one, as
+// returned by Slug. If there is no such file, but there is a gzip compressed
+// one, then the path to that is returned.
+func (r *Repo) Path(id string) string {
+	path := filepath.Join(r.dir(), id+".sql")
+
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		if _, err := os.Stat(path + ".gz"); err == nil {
+			return path + ".gz"
+		}
+	}
+	return path
+}
+
+// resolve returns the path to the file for the revision with the given ID, as
+// returned by Path. If there is no such file, and the ID is not prefixed with
+// a category, then the categories are searched for the revision. If there is
+// no file for the revision, then a *RevisionError wrapping ErrNotFound is
+// returned.
+func (r *Repo) resolve(id string) (string, error) {
+	path := r.Path(id)
+
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		return path, err
+	}
+
+	notFound := &RevisionError{
+		ID:   id,
+		Path: path,
+		Err:  ErrNotFound,
+	}
+
+	if strings.Contains(id, "/") {
+		return "", notFound
+	}
+
+	paths := make([]string, 0, 1)
+
+	err := filepath.Walk(r.dir(), func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if name := info.Name(); !info.IsDir() && (name == id+".sql" || name == id+".sql.gz") {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", notFound
+		}
+		return "", err
+	}
+
+	switch len(paths) {
+	case 0:
+		return "", notFound
+	case 1:
+		return paths[0], nil
+	default:
+		return "", &RevisionError{
+			ID:  id,
+			Err: errors.New("revision in multiple categories, prefix it with its category"),
+		}
+	}
+}
+
+// Find opens the revision with the given ID via OpenRevision. The ID is
+// resolved like Remove. If there is no file for the revision, then a
+// *RevisionError wrapping ErrNotFound is returned.
+func (r *Repo) Find(id string) (*Revision, error) {
+	path, err := r.resolve(id)
+
+	if err != nil {
+		return nil, err
+	}
+	return OpenRevision(path)
+}
+
+// Remove removes the file for the revision with the given ID. The ID should be
+// prefixed with the category of the revision if it has one, as returned by
+// Slug, otherwise the categories are searched for the revision. Gzip
+// compressed files are removed too. If there is no file for the revision, then
+// a *RevisionError wrapping ErrNotFound is returned.
+func (r *Repo) Remove(id string) error {
+	path, err := r.resolve(id)
+
+	if err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// RemoveRevision removes the file for the revision with the given ID from
+// DefaultRevisionsDir, via the Remove method of a Repo. This does not check
+// whether the revision has been performed in any database.
+func RemoveRevision(id string) error {
+	var r Repo
+	return r.Remove(id)
+}
+
+// Walk calls the given function for each revision file in the Repo, including
+// those in categories. The revisions are opened via OpenRevisionLazy, so only
+// their headers are read. If the function returns an error, then the walk
+// stops and that error is returned.
+func (r *Repo) Walk(fn func(*Revision) error) error {
+	return filepath.Walk(r.dir(), func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			return nil
+		}
+
+		rev, err := OpenRevisionLazy(path)
+
+		if err != nil {
+			return err
+		}
+		return fn(rev)
+	})
+}
+
+// Load returns all of the revisions in the Repo, as opened via Walk.
+func (r *Repo) Load() ([]*Revision, error) {
+	revs := make([]*Revision, 0)
+
+	err := r.Walk(func(rev *Revision) error {
+		revs = append(revs, rev)
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return revs, nil
+}
+
+// Add writes the given Revision to a new file in the Repo, creating the
+// directory for its category if it does not exist, and returns the path to
+// the file. An existing file is never overwritten, instead the error from
+// opening the file is returned.
+func (r *Repo) Add(rev *Revision) (string, error) {
+	dir := filepath.Join(r.dir(), rev.Category)
+
+	if err := os.MkdirAll(dir, os.FileMode(0755)); err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(dir, rev.ID+".sql")
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, os.FileMode(0644))
+
+	if err != nil {
+		return "", err
+	}
+
+	_, err = rev.WriteTo(f)
+	f.Close()
+
+	if err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// LoadDirs loads the revisions from each of the given directories into a single
+// Collection, so revisions kept in separate directories, such as for the core
+// schema and for seed data, are sorted by their IDs across all of them. Each
+// directory is walked via the Walk method of a Repo.
+//
+// A revision with the same ID, and category, as one in another directory does
+// not stop the others from being loaded. Instead, the returned Errors will
+// contain a *RevisionError wrapping ErrDuplicate for each, with the Path of the
+// duplicate file, and the Collection will contain the first of the revisions.
+func LoadDirs(dirs ...string) (*Collection, error) {
+	var c Collection
+
+	errs := make(Errors, 0)
+
+	for _, dir := range dirs {
+		repo := Repo{Dir: dir}
+
+		err := repo.Walk(func(rev *Revision) error {
+			if err := c.Put(rev); err != nil {
+				var rerr *RevisionError
+
+				if !errors.As(err, &rerr) {
+					return err
+				}
+
+				rerr.Path = rev.path
+				errs = append(errs, rerr)
+			}
+			return nil
+		})
+
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &c, errs.err()
+}
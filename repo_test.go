@@ -0,0 +1,251 @@
+package mgrt
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_Repo(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mgrt-repo-*")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	repos := []*Repo{
+		{Dir: filepath.Join(dir, "billing")},
+		{Dir: filepath.Join(dir, "accounts")},
+	}
+
+	revs := []*Revision{
+		{ID: "20060102150405", Author: "Andrew", Comment: "Add invoices table", SQL: "CREATE TABLE invoices ( id INT );"},
+		{ID: "20060102150405", Category: "perms", Author: "Andrew", Comment: "Grant users", SQL: "GRANT SELECT ON users TO app;"},
+	}
+
+	for i, repo := range repos {
+		path, err := repo.Add(revs[i])
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expected := repo.Path(revs[i].Slug()); path != expected {
+			t.Fatalf("repos[%d] - unexpected path, expected=%q, got=%q\n", i, expected, path)
+		}
+
+		if _, err := repo.Add(revs[i]); !os.IsExist(err) {
+			t.Fatalf("repos[%d] - expected existing revision to not be overwritten, got=%v\n", i, err)
+		}
+	}
+
+	for i, repo := range repos {
+		loaded, err := repo.Load()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(loaded) != 1 {
+			t.Fatalf("repos[%d] - unexpected revisions, expected=1, got=%d\n", i, len(loaded))
+		}
+
+		if loaded[0].Slug() != revs[i].Slug() {
+			t.Fatalf("repos[%d] - unexpected revision, expected=%q, got=%q\n", i, revs[i].Slug(), loaded[0].Slug())
+		}
+
+		rev, err := repo.Find(revs[i].Slug())
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !rev.Equal(revs[i]) {
+			t.Fatalf("repos[%d] - unexpected revision, expected=%v, got=%v\n", i, revs[i], rev)
+		}
+	}
+
+	if _, err := repos[0].Find(revs[1].Slug()); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("unexpected error, expected=%q, got=%q\n", ErrNotFound, err)
+	}
+
+	var repo Repo
+
+	if path := repo.Path("20060102150405"); path != filepath.Join(DefaultRevisionsDir, "20060102150405.sql") {
+		t.Fatalf("unexpected default path %q\n", path)
+	}
+}
+
+func Test_LoadDirs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mgrt-dirs-*")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	dirs := map[string][]*Revision{
+		"core": {
+			{ID: "20060102150405", Author: "Andrew", SQL: "CREATE TABLE users ( id INT );"},
+			{ID: "20060102150408", Author: "Andrew", SQL: "CREATE TABLE posts ( id INT );"},
+		},
+		"tenant": {
+			{ID: "20060102150406", Author: "Andrew", SQL: "CREATE TABLE tenants ( id INT );"},
+			{ID: "20060102150405", Category: "perms", Author: "Andrew", SQL: "GRANT SELECT ON users TO app;"},
+		},
+		"seed": {
+			{ID: "20060102150407", Author: "Andrew", SQL: "INSERT INTO users VALUES (1);"},
+		},
+	}
+
+	paths := make([]string, 0, len(dirs))
+
+	for name, revs := range dirs {
+		repo := Repo{Dir: filepath.Join(dir, name)}
+
+		for _, rev := range revs {
+			if _, err := repo.Add(rev); err != nil {
+				t.Fatal(err)
+			}
+		}
+		paths = append(paths, repo.Dir)
+	}
+
+	c, err := LoadDirs(paths...)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"20060102150405", "perms/20060102150405", "20060102150406", "20060102150407", "20060102150408"}
+
+	revs := c.Slice()
+
+	if len(revs) != len(expected) {
+		t.Fatalf("unexpected revisions, expected=%d, got=%d\n", len(expected), len(revs))
+	}
+
+	for i, rev := range revs {
+		// Revisions with the same ID are in the order they were put in, which
+		// depends on the order of the directories.
+		if rev.ID == "20060102150405" {
+			continue
+		}
+
+		if rev.Slug() != expected[i] {
+			t.Errorf("revs[%d] - unexpected revision, expected=%q, got=%q\n", i, expected[i], rev.Slug())
+		}
+	}
+
+	dup := Repo{Dir: filepath.Join(dir, "dup")}
+
+	path, err := dup.Add(&Revision{ID: "20060102150406", Author: "Andrew", SQL: "SELECT 1;"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err = LoadDirs(append(paths, dup.Dir)...)
+
+	errs, ok := err.(Errors)
+
+	if !ok || len(errs) != 1 || !errors.Is(errs[0], ErrDuplicate) {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", ErrDuplicate, err)
+	}
+
+	if rerr := errs[0].(*RevisionError); rerr.Path != path {
+		t.Fatalf("unexpected error path, expected=%q, got=%q\n", path, rerr.Path)
+	}
+
+	if c.Len() != len(expected) {
+		t.Fatalf("unexpected collection length, expected=%d, got=%d\n", len(expected), c.Len())
+	}
+}
+
+func Test_RemoveRevision(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mgrt-rm-*")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	files := []string{
+		"20060102150405.sql",
+		"20060102150406.sql.gz",
+		filepath.Join("perms", "20060102150407.sql"),
+		filepath.Join("perms", "20060102150408.sql"),
+		filepath.Join("seed", "20060102150408.sql"),
+		filepath.Join("seed", "20060102150409.sql"),
+	}
+
+	for _, name := range files {
+		path := filepath.Join(dir, DefaultRevisionsDir, name)
+
+		if err := os.MkdirAll(filepath.Dir(path), os.FileMode(0755)); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(path, []byte("SELECT 1;"), os.FileMode(0644)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	wd, err := os.Getwd()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.Chdir(wd)
+
+	tests := []struct {
+		id      string
+		removed string
+	}{
+		{"20060102150405", "20060102150405.sql"},
+		{"20060102150406", "20060102150406.sql.gz"},
+		{"20060102150407", filepath.Join("perms", "20060102150407.sql")},
+		{"seed/20060102150409", filepath.Join("seed", "20060102150409.sql")},
+	}
+
+	for i, test := range tests {
+		if err := RemoveRevision(test.id); err != nil {
+			t.Fatalf("tests[%d] - %s\n", i, err)
+		}
+
+		if _, err := os.Stat(filepath.Join(DefaultRevisionsDir, test.removed)); !os.IsNotExist(err) {
+			t.Fatalf("tests[%d] - expected %s to be removed, got=%v\n", i, test.removed, err)
+		}
+	}
+
+	if err := RemoveRevision("20060102150405"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("unexpected error, expected=%q, got=%q\n", ErrNotFound, err)
+	}
+
+	if err := RemoveRevision("seed/20060102150407"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("unexpected error, expected=%q, got=%q\n", ErrNotFound, err)
+	}
+
+	// The revision is in more than one category, so which to remove is
+	// ambiguous.
+	if err := RemoveRevision("20060102150408"); err == nil || errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected error for revision in multiple categories, got=%v\n", err)
+	}
+
+	for _, name := range []string{"perms", "seed"} {
+		if _, err := os.Stat(filepath.Join(DefaultRevisionsDir, name, "20060102150408.sql")); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -5,12 +5,23 @@ package mgrt
 import (
 	"bufio"
 	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"regexp"
 	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
 // node is a node in the binary tree of a Collection. This stores the val used
@@ -23,7 +34,8 @@ type node struct {
 	right *node
 }
 
-// Errors is a collection of errors that occurred.
+// Errors is a collection of errors that occurred. Each error can be inspected
+// by ranging over the Errors.
 type Errors []error
 
 // Revision is the type that represents what SQL code has been executed against
@@ -36,28 +48,139 @@ type Revision struct {
 	Comment     string    // Comment provides a short description for the Revision.
 	SQL         string    // SQL is the code that will be executed when the Revision is performed.
 	PerformedAt time.Time // PerformedAt is when the Revision was executed.
+
+	// Hash is the SHA256 hash of the Revision's author and SQL that was
+	// recorded when the Revision was performed. This will be empty if the
+	// Revision was performed before hashes were recorded.
+	Hash string
+
+	// PerformedBy is who performed the Revision, this will be empty if the
+	// Revision was performed before this was recorded.
+	PerformedBy string
+
+	// Duration is how long the SQL of the Revision took to execute when it was
+	// performed, to the millisecond. This will be zero if the Revision was
+	// performed before this was recorded.
+	Duration time.Duration
+
+	// Version is the release version the Revision shipped in, such as v2.3.0.
+	// This is set via the optional "Version:" header, and is empty if not
+	// given.
+	Version string
+
+	// NoTransaction is whether the Revision should be performed outside of a
+	// transaction. This is set via the "Transaction: no" header, and is for
+	// statements that cannot be run in a transaction, such as CREATE INDEX
+	// CONCURRENTLY in PostgreSQL.
+	NoTransaction bool
+
+	// NoRecord is whether the Revision should be performed without being
+	// recorded in the database. This is set via the "Record: no" header, and is
+	// for idempotent maintenance that should be performed every time, such as
+	// REFRESH MATERIALIZED VIEW. Since it is never recorded, it is never
+	// treated as performed, so it is performed again each time it is given.
+	// This should never be set for a Revision that changes the schema.
+	NoRecord bool
+
+	// path is the file the SQL of the Revision is loaded from, if it was
+	// opened via OpenRevisionLazy and has not yet been loaded.
+	path string
+}
+
+// Stats is a summary of the revisions that have been performed against a
+// database. The times will be zero if no revisions have been performed.
+type Stats struct {
+	Total            int64     // Total is the number of revisions performed.
+	FirstPerformedAt time.Time // FirstPerformedAt is when the first revision was performed.
+	LastPerformedAt  time.Time // LastPerformedAt is when the last revision was performed.
+
+	// LastID is the ID of the last revision that was performed, including its
+	// category.
+	LastID string
+}
+
+// revisionJSON is the JSON representation of a Revision.
+type revisionJSON struct {
+	ID            string `json:"id"`
+	Category      string `json:"category,omitempty"`
+	Author        string `json:"author"`
+	Comment       string `json:"comment"`
+	SQL           string `json:"sql"`
+	PerformedAt   string `json:"performed_at,omitempty"`
+	Hash          string `json:"hash,omitempty"`
+	PerformedBy   string `json:"performed_by,omitempty"`
+	DurationMs    int64  `json:"duration_ms,omitempty"`
+	Version       string `json:"version,omitempty"`
+	NoTransaction bool   `json:"no_transaction,omitempty"`
+	NoRecord      bool   `json:"no_record,omitempty"`
 }
 
 // RevisionError represents an error that occurred with a revision.
 type RevisionError struct {
-	ID  string // ID is the ID of the revisions that errored.
-	Err error  // Err is the underlying error itself.
+	ID   string // ID is the ID of the revisions that errored.
+	Path string // Path is the file the revision was read from, if any.
+	Err  error  // Err is the underlying error itself.
+
+	// SQLState is the SQLSTATE reported by the database for Err, such as
+	// 42601 for a syntax error in PostgreSQL, if the driver exposes it.
+	SQLState string
+
+	// Code is the driver specific error number reported by the database for
+	// Err, such as 1060 for a duplicate column in MySQL, or the extended
+	// result code in SQLite, if the driver exposes it.
+	Code int
 }
 
 // Collection stores revisions in a binary tree. This ensures that when they are
 // retrieved, they will be retrieved in ascending order from when they were
 // initially added.
 type Collection struct {
+	// MaxSkew is how far into the future the time of a Revision's ID can be
+	// when it is put in the Collection, to allow for clocks that are slightly
+	// out. If exceeded, then a *RevisionError wrapping ErrFuture is returned.
+	// If zero, then the time of the ID is not checked.
+	MaxSkew time.Duration
+
 	len  int
 	root *node
 }
 
+// The format of the comment block header of a revision. These are shared by
+// UnmarshalRevision and WriteTo, so what is written can always be read back.
+const (
+	headerOpen  = "/*"
+	headerClose = "*/"
+
+	headerRevision    = "Revision"
+	headerAuthor      = "Author"
+	headerVersion     = "Version"
+	headerTransaction = "Transaction"
+	headerRecord      = "Record"
+
+	// headerWidth is the width that each header key, along with its colon, is
+	// padded to when written.
+	headerWidth = 9
+)
+
 var (
 	revisionIdFormat = "20060102150405"
 
+	// now returns the current time. This is used for the IDs of new revisions,
+	// and for recording when revisions are performed, and is replaced in tests
+	// so these are deterministic.
+	now = time.Now
+
+	// gzipMagic is the header that every gzip compressed file begins with.
+	gzipMagic = []byte{0x1f, 0x8b}
+
+	// revisionHeaderPattern matches the start of a revision's comment block
+	// header.
+	revisionHeaderPattern = regexp.MustCompile(regexp.QuoteMeta(headerOpen) + `\s*(` + headerRevision + `|` + headerAuthor + `):`)
+
 	// ErrInvalid is returned whenever an invalid Revision ID is encountered. A
 	// Revision ID is considered invalid when the time layout 20060102150405
-	// cannot be used for parse the ID.
+	// cannot be used for parse the ID. This will typically be wrapped in a
+	// *RevisionError that identifies the offending revision.
 	ErrInvalid = errors.New("revision id invalid")
 
 	// ErrPerformed is returned whenever a Revision has already been performed.
@@ -65,6 +188,32 @@ var (
 	ErrPerformed = errors.New("revision performed")
 
 	ErrNotFound = errors.New("revision not found")
+
+	// ErrChanged is returned whenever the hash of a Revision differs from the
+	// hash that was recorded when it was performed.
+	ErrChanged = errors.New("revision changed")
+
+	// ErrDuplicate is returned whenever a Revision is put in a Collection that
+	// already has a Revision with the same ID in the same category.
+	ErrDuplicate = errors.New("duplicate revision")
+
+	// ErrTimeout is returned whenever a Revision takes longer to perform than
+	// the Timeout of the Migrator performing it.
+	ErrTimeout = errors.New("revision timed out")
+
+	// ErrMissing is returned whenever a Revision has been performed against a
+	// database, but there is no local Revision for it.
+	ErrMissing = errors.New("revision missing")
+
+	// ErrFuture is returned whenever the ID of a Revision is further in the
+	// future than the allowed skew, such as when it was created on a machine
+	// with the wrong time.
+	ErrFuture = errors.New("revision in the future")
+
+	// ErrNoPending is contained in the Errors returned when performing a batch
+	// of revisions that had all already been performed, meaning there was
+	// nothing to do.
+	ErrNoPending = errors.New("no pending revisions")
 )
 
 func insertNode(n **node, val int64, r *Revision) {
@@ -83,10 +232,28 @@ func insertNode(n **node, val int64, r *Revision) {
 	insertNode(&(*n).right, val, r)
 }
 
+// findNode returns the Revision in the tree with the given val, and slug. Nodes
+// with the same val are always inserted to the right, so these are all on the
+// path that is descended.
+func findNode(n *node, val int64, slug string) (*Revision, bool) {
+	for n != nil {
+		if val == n.val && n.rev.Slug() == slug {
+			return n.rev, true
+		}
+
+		if val < n.val {
+			n = n.left
+			continue
+		}
+		n = n.right
+	}
+	return nil, false
+}
+
 // NewRevision creates a new Revision with the given author, and comment.
 func NewRevision(author, comment string) *Revision {
 	return &Revision{
-		ID:      time.Now().Format(revisionIdFormat),
+		ID:      now().Format(revisionIdFormat),
 		Author:  author,
 		Comment: comment,
 	}
@@ -103,22 +270,25 @@ func NewRevisionCategory(category, author, comment string) *Revision {
 // RevisionPerformed checks to see if the given Revision has been performed
 // against the given database.
 func RevisionPerformed(db *DB, rev *Revision) error {
-	var count int64
+	var performed bool
 
 	if _, err := time.Parse(revisionIdFormat, rev.ID); err != nil {
-		return ErrInvalid
+		return &RevisionError{
+			ID:  rev.Slug(),
+			Err: ErrInvalid,
+		}
 	}
 
-	q := db.Parameterize("SELECT COUNT(id) FROM mgrt_revisions WHERE (id = ?)")
+	q := db.Parameterize("SELECT EXISTS(SELECT 1 FROM mgrt_revisions WHERE (id = ?))")
 
-	if err := db.QueryRow(q, rev.Slug()).Scan(&count); err != nil {
+	if err := db.QueryRow(q, rev.Slug()).Scan(&performed); err != nil {
 		return &RevisionError{
 			ID:  rev.Slug(),
 			Err: err,
 		}
 	}
 
-	if count > 0 {
+	if performed {
 		return &RevisionError{
 			ID:  rev.Slug(),
 			Err: ErrPerformed,
@@ -129,389 +299,1680 @@ func RevisionPerformed(db *DB, rev *Revision) error {
 
 // GetRevision get's the Revision with the given ID.
 func GetRevision(db *DB, id string) (*Revision, error) {
-	var (
-		rev Revision
-		sec int64
-	)
+	cols, err := selectRevisionColumns(db)
 
-	q := "SELECT id, author, comment, sql, performed_at FROM mgrt_revisions WHERE (id = ?)"
+	if err != nil {
+		return nil, err
+	}
 
-	row := db.QueryRow(db.Parameterize(q), id)
+	q := "SELECT " + cols + " FROM mgrt_revisions WHERE (id = ?)"
 
-	var categoryid string
+	rev, err := scanRevision(db.QueryRow(db.Parameterize(q), id))
 
-	if err := row.Scan(&categoryid, &rev.Author, &rev.Comment, &rev.SQL, &sec); err != nil {
+	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, &RevisionError{
-				ID:  categoryid,
+				ID:  id,
 				Err: ErrNotFound,
 			}
 		}
 		return nil, err
 	}
-
-	parts := strings.Split(categoryid, "/")
-
-	end := len(parts) - 1
-
-	rev.ID = parts[end]
-	rev.Category = strings.Join(parts[:end], "/")
-
-	rev.PerformedAt = time.Unix(sec, 0)
-	return &rev, nil
+	return rev, nil
 }
 
 // GetRevisions returns a list of all the revisions that have been performed
 // against the given database. If n is <= 0 then all of the revisions will be
 // retrieved, otherwise, only the given amount will be retrieved. The returned
-// revisions will be ordered by their performance date descending.
+// revisions will be ordered by their performance date descending, then by their
+// ID for revisions performed at the same time.
 func GetRevisions(db *DB, n int) ([]*Revision, error) {
-	count := int64(n)
+	return getRevisions(db, n, "performed_at DESC, id DESC", "")
+}
 
-	if n <= 0 {
-		q0 := "SELECT COUNT(id) FROM mgrt_revisions"
+// GetRevisionsAsc is like GetRevisions, only the returned revisions will be
+// ordered by their performance date ascending. If n > 0 then only the first n
+// revisions to have been performed will be retrieved.
+func GetRevisionsAsc(db *DB, n int) ([]*Revision, error) {
+	return getRevisions(db, n, "performed_at ASC, id ASC", "")
+}
 
-		if err := db.QueryRow(q0).Scan(&count); err != nil {
-			return nil, err
-		}
-	}
+// GetRevisionsByAuthor is like GetRevisions, only the returned revisions will
+// be those authored by the given author. The author must match exactly, so
+// should include the email address, if any, for example
+// "Andrew Pillar <me@andrewpillar.com>".
+func GetRevisionsByAuthor(db *DB, author string, n int) ([]*Revision, error) {
+	return getRevisions(db, n, "performed_at DESC, id DESC", "author = ?", author)
+}
+
+// GetRevisionsByVersion is like GetRevisions, only the returned revisions will
+// be those with the given version, as set via the "Version:" header, for
+// example "v2.3.0". The version must match exactly.
+func GetRevisionsByVersion(db *DB, version string, n int) ([]*Revision, error) {
+	return getRevisions(db, n, "performed_at DESC, id DESC", "version = ?", version)
+}
 
-	revs := make([]*Revision, 0, int(count))
+// GetRevisionsFunc calls the given function for each revision that has been
+// performed against the given database, ordered like GetRevisions. The
+// revisions are read from the database one at a time, so only the current
+// revision is held in memory. If the function returns an error, then no more
+// revisions are read, and that error is returned. The function should not use
+// the database, since the connection is in use until all revisions are read.
+func GetRevisionsFunc(db *DB, fn func(*Revision) error) error {
+	return getRevisionsFunc(db, 0, "performed_at DESC, id DESC", "", fn)
+}
 
-	q := "SELECT id, author, comment, sql, performed_at FROM mgrt_revisions ORDER BY id DESC LIMIT ?"
+// getRevisions returns the revisions ordered by the given ORDER BY clause. If
+// where is not empty, then it is used as the WHERE clause of the query, with
+// the given args.
+func getRevisions(db *DB, n int, order, where string, args ...interface{}) ([]*Revision, error) {
+	revs := make([]*Revision, 0)
 
-	rows, err := db.Query(db.Parameterize(q), count)
+	err := getRevisionsFunc(db, n, order, where, func(rev *Revision) error {
+		revs = append(revs, rev)
+		return nil
+	}, args...)
 
 	if err != nil {
 		return nil, err
 	}
+	return revs, nil
+}
+
+// getRevisionsFunc calls the given function for each revision, ordered by the
+// given ORDER BY clause. If n > 0, then only the first n revisions are read.
+// If where is not empty, then it is used as the WHERE clause of the query,
+// with the given args.
+func getRevisionsFunc(db *DB, n int, order, where string, fn func(*Revision) error, args ...interface{}) error {
+	if where != "" {
+		where = " WHERE " + where
+	}
+
+	cols, err := selectRevisionColumns(db)
+
+	if err != nil {
+		return err
+	}
+
+	q := "SELECT " + cols + " FROM mgrt_revisions" + where + " ORDER BY " + order
+
+	if n > 0 {
+		q += " LIMIT ?"
+		args = append(args, n)
+	}
+
+	rows, err := db.Query(db.Parameterize(q), args...)
+
+	if err != nil {
+		return err
+	}
 
 	defer rows.Close()
 
 	for rows.Next() {
-		var (
-			rev        Revision
-			sec        int64
-			categoryid string
-		)
-
-		err = rows.Scan(&categoryid, &rev.Author, &rev.Comment, &rev.SQL, &sec)
+		rev, err := scanRevision(rows)
 
 		if err != nil {
-			return nil, err
+			return err
 		}
 
-		parts := strings.Split(categoryid, "/")
+		if err := fn(rev); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
 
-		end := len(parts) - 1
+// revisionColumns are the columns of the mgrt_revisions table that are
+// selected for scanning via scanRevision, in the order they are scanned.
+const revisionColumns = "id, author, comment, sql, performed_at, hash, performed_by, duration_ms, version, sql_encoding"
+
+// selectRevisionColumns returns the columns to select for scanning via
+// scanRevision. If the mgrt_revisions table has not been ensured for the given
+// *DB, such as one opened via OpenReadOnly, then it may have been created by an
+// older version of mgrt, so NULL is selected in place of each of the
+// revisionColumns that it does not have.
+func selectRevisionColumns(db *DB) (string, error) {
+	if db.table.isEnsured() {
+		return revisionColumns, nil
+	}
 
-		rev.ID = parts[end]
-		rev.Category = strings.Join(parts[:end], "/")
+	rows, err := db.Query("SELECT * FROM mgrt_revisions WHERE 1 = 0")
 
-		rev.PerformedAt = time.Unix(sec, 0)
-		revs = append(revs, &rev)
+	if err != nil {
+		return "", err
 	}
 
-	if err := rows.Err(); err != nil {
-		return nil, err
+	names, err := rows.Columns()
+	rows.Close()
+
+	if err != nil {
+		return "", err
 	}
-	return revs, nil
-}
 
-// PerformRevisions will perform the given revisions against the given database.
-// The given revisions will be sorted into ascending order first before they
-// are performed. If any of the given revisions have already been performed then
-// the Errors type will be returned containing *RevisionError for each revision
-// that was already performed.
-func PerformRevisions(db *DB, revs0 ...*Revision) error {
-	var c Collection
+	set := make(map[string]struct{}, len(names))
 
-	for _, rev := range revs0 {
-		c.Put(rev)
+	for _, name := range names {
+		set[strings.ToLower(name)] = struct{}{}
 	}
 
-	errs := Errors(make([]error, 0, len(revs0)))
-	revs := c.Slice()
+	cols := strings.Split(revisionColumns, ", ")
 
-	for _, rev := range revs {
-		if err := rev.Perform(db); err != nil {
-			if errors.Is(err, ErrPerformed) {
-				errs = append(errs, err)
-				continue
-			}
-			return err
+	for i, col := range cols {
+		if _, ok := set[col]; !ok {
+			cols[i] = "NULL AS " + col
 		}
 	}
-	return errs.err()
+	return strings.Join(cols, ", "), nil
 }
 
-// OpenRevision opens the revision at the given path.
-func OpenRevision(path string) (*Revision, error) {
-	f, err := os.Open(path)
+// scanRevision scans a performed Revision from the given row, which should
+// have been selected with revisionColumns. The ID is split into the ID and
+// category of the Revision, and the columns that may be NULL for revisions
+// performed before they were recorded are left as the zero value. If the SQL
+// was compressed when it was recorded, then it is decompressed.
+func scanRevision(row interface{ Scan(...interface{}) error }) (*Revision, error) {
+	var (
+		rev         Revision
+		sec         int64
+		categoryid  string
+		hash        sql.NullString
+		performedBy sql.NullString
+		durationMs  sql.NullInt64
+		version     sql.NullString
+		encoding    sql.NullString
+	)
 
-	if err != nil {
+	if err := row.Scan(&categoryid, &rev.Author, &rev.Comment, &rev.SQL, &sec, &hash, &performedBy, &durationMs, &version, &encoding); err != nil {
 		return nil, err
 	}
 
-	defer f.Close()
+	s, err := decodeSQL(rev.SQL, encoding.String)
 
-	return UnmarshalRevision(f)
-}
+	if err != nil {
+		return nil, &RevisionError{
+			ID:  categoryid,
+			Err: err,
+		}
+	}
+	rev.SQL = s
 
-// UnmarshalRevision will unmarshal a Revision from the given io.Reader. This
-// will expect to see a comment block header that contains the metadata about
-// the Revision itself. This will check to see if the given Revision ID is
-// valid. A Revision id is considered valid when it can be parsed into a
-// valid time via time.Parse using the layout of 20060102150405.
-func UnmarshalRevision(r io.Reader) (*Revision, error) {
-	br := bufio.NewReader(r)
+	parts := strings.Split(categoryid, "/")
 
-	rev := &Revision{}
+	end := len(parts) - 1
 
-	var (
-		buf     []rune = make([]rune, 0)
-		r0      rune
-		inBlock bool
-	)
+	rev.ID = parts[end]
+	rev.Category = strings.Join(parts[:end], "/")
 
-	for {
-		r, _, err := br.ReadRune()
+	rev.PerformedAt = time.Unix(sec, 0)
+	rev.Hash = hash.String
+	rev.PerformedBy = performedBy.String
+	rev.Duration = time.Duration(durationMs.Int64) * time.Millisecond
+	rev.Version = version.String
+	return &rev, nil
+}
 
-		if err != nil {
-			if err != io.EOF {
-				return nil, err
-			}
-			rev.SQL = strings.TrimSpace(string(buf))
-			break
-		}
+// sqlEncodingGzip is the encoding of SQL that was gzip compressed when it was
+// recorded. The compressed SQL is base64 encoded, since the sql column is text.
+const sqlEncodingGzip = "gzip"
 
-		if r == '*' {
-			if r0 == '/' {
-				inBlock = true
-				continue
-			}
-		}
+// encodeSQL gzip compresses the given SQL for recording, and returns it along
+// with its encoding.
+func encodeSQL(s string) (string, string, error) {
+	var buf bytes.Buffer
 
-		if r == '/' {
-			if r0 == '*' {
-				rev.Comment = strings.TrimSpace(string(buf))
-				buf = buf[0:0]
-				inBlock = false
-				continue
-			}
-		}
+	zw := gzip.NewWriter(&buf)
 
-		if inBlock {
-			if r == '\n' {
-				if r0 == '\n' {
-					if rev.ID == "" && rev.Author == "" {
-						buf = buf[0:0]
-					}
-					goto cont
-				}
-
-				pos := -1
-
-				for i, r := range buf {
-					if r == ':' {
-						pos = i
-						break
-					}
-				}
-
-				if pos < 0 {
-					goto cont
-				}
-
-				if string(buf[pos-6:pos]) == "Author" {
-					rev.Author = strings.TrimSpace(string(buf[pos+1:]))
-					buf = buf[0:0]
-					continue
-				}
-
-				if string(buf[pos-8:pos]) == "Revision" {
-					rev.ID = strings.TrimSpace(string(buf[pos+1:]))
-					buf = buf[0:0]
-					continue
-				}
-			}
-		}
+	if _, err := io.WriteString(zw, s); err != nil {
+		return "", "", err
+	}
 
-		if r == '*' {
-			peek, _, err := br.ReadRune()
+	if err := zw.Close(); err != nil {
+		return "", "", err
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), sqlEncodingGzip, nil
+}
 
-			if err != nil {
-				if err != io.EOF {
-					return nil, err
-				}
-				continue
-			}
+// decodeSQL returns the given recorded SQL decoded from the given encoding. SQL
+// with no encoding is returned as is.
+func decodeSQL(s, encoding string) (string, error) {
+	switch encoding {
+	case "":
+		return s, nil
+	case sqlEncodingGzip:
+		b, err := base64.StdEncoding.DecodeString(s)
 
-			if peek == '/' {
-				br.UnreadRune()
-				r0 = r
-				continue
-			}
+		if err != nil {
+			return "", err
 		}
 
-	cont:
-		buf = append(buf, r)
-		r0 = r
-	}
+		zr, err := gzip.NewReader(bytes.NewReader(b))
 
-	parts := strings.Split(rev.ID, "/")
-	end := len(parts)-1
+		if err != nil {
+			return "", err
+		}
 
-	rev.ID = parts[len(parts)-1]
-	rev.Category = strings.Join(parts[:end], "/")
+		defer zr.Close()
 
-	if _, err := time.Parse(revisionIdFormat, rev.ID); err != nil {
-		return nil, ErrInvalid
-	}
-	return rev, nil
-}
+		decoded, err := io.ReadAll(zr)
 
-func (n *node) walk(visit func(*Revision)) {
-	if n.left != nil {
-		n.left.walk(visit)
+		if err != nil {
+			return "", err
+		}
+		return string(decoded), nil
+	default:
+		return "", errors.New("unknown sql encoding " + encoding)
 	}
+}
 
-	visit(n.rev)
+// BackfillHashes records the hash of each revision in the given database that
+// was performed before hashes were recorded. The hash is computed from the
+// author and SQL that were recorded when the revision was performed. This
+// returns the number of revisions that were updated, and is safe to call
+// repeatedly.
+func BackfillHashes(db *DB) (int, error) {
+	rows, err := db.Query("SELECT id, author, sql, sql_encoding FROM mgrt_revisions WHERE hash IS NULL OR hash = ''")
 
-	if n.right != nil {
-		n.right.walk(visit)
+	if err != nil {
+		return 0, err
 	}
-}
 
-func (e Errors) err() error {
-	if len(e) == 0 {
-		return nil
-	}
-	return e
-}
+	revs := make([]*Revision, 0)
 
-// Error returns the string representation of all the errors in the underlying
-// slice. Each error will be on a separate line in the returned string.
-func (e Errors) Error() string {
-	var buf bytes.Buffer
+	for rows.Next() {
+		var (
+			rev      Revision
+			encoding sql.NullString
+		)
 
-	for _, err := range e {
-		buf.WriteString(err.Error() + "\n")
-	}
-	return buf.String()
-}
+		if err := rows.Scan(&rev.ID, &rev.Author, &rev.SQL, &encoding); err != nil {
+			rows.Close()
+			return 0, err
+		}
 
-// Put puts the given Revision in the current Collection.
-func (c *Collection) Put(r *Revision) error {
-	if r.ID == "" {
-		return ErrInvalid
-	}
+		s, err := decodeSQL(rev.SQL, encoding.String)
 
-	t, err := time.Parse(revisionIdFormat, r.ID)
+		if err != nil {
+			rows.Close()
+			return 0, &RevisionError{
+				ID:  rev.ID,
+				Err: err,
+			}
+		}
 
-	if err != nil {
-		return ErrInvalid
+		rev.SQL = s
+		revs = append(revs, &rev)
 	}
 
-	insertNode(&c.root, t.Unix(), r)
-	c.len++
-	return nil
-}
+	rows.Close()
 
-// Len returns the number of items in the collection.
-func (c *Collection) Len() int { return c.len }
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
 
-// Slice returns a sorted slice of all the revisions in the collection.
-func (c *Collection) Slice() []*Revision {
-	revs := make([]*Revision, 0, c.len)
+	q := db.Parameterize("UPDATE mgrt_revisions SET hash = ? WHERE (id = ?) AND (hash IS NULL OR hash = '')")
 
-	c.root.walk(func(r *Revision) {
-		revs = append(revs, r)
-	})
-	return revs
-}
+	n := 0
 
-func (e *RevisionError) Error() string {
-	return "revision error " + e.ID + ": " + e.Err.Error()
-}
+	for _, rev := range revs {
+		res, err := db.Exec(q, rev.genHash(), rev.ID)
 
-// Unwrap returns the underlying error that caused the original RevisionError.
-func (e *RevisionError) Unwrap() error { return e.Err }
+		if err != nil {
+			return n, &RevisionError{
+				ID:  rev.ID,
+				Err: err,
+			}
+		}
 
-// Slug returns the slug of the revision ID, this will be in the format of
-// category/id if the revision belongs to a category.
-func (r *Revision) Slug() string {
-	if r.Category != "" {
-		return r.Category + "/" + r.ID
+		if affected, err := res.RowsAffected(); err == nil {
+			n += int(affected)
+		}
 	}
-	return r.ID
+	return n, nil
 }
 
-// Perform will perform the current Revision against the given database. If
-// the Revision is emtpy, then nothing happens. If the Revision has already
-// been performed, then ErrPerformed is returned.
-func (r *Revision) Perform(db *DB) error {
-	if r.SQL == "" {
-		return nil
-	}
-
-	if err := RevisionPerformed(db, r); err != nil {
-		return err
-	}
+// ForgetRevision deletes the record of the revision with the given ID from the
+// given database, so that it is no longer considered performed. The ID should
+// include the category of the revision if it has one. This only changes what
+// mgrt has recorded, the SQL of the revision is not undone, so this should only
+// be used when the changes made by the revision have been undone by some other
+// means. Otherwise, the revision would be performed again the next time it is
+// run. If the revision has not been performed, then a *RevisionError wrapping
+// ErrNotFound is returned.
+func ForgetRevision(db *DB, id string) error {
+	res, err := db.Exec(db.Parameterize("DELETE FROM mgrt_revisions WHERE (id = ?)"), id)
 
-	if _, err := db.Exec(r.SQL); err != nil {
+	if err != nil {
 		return &RevisionError{
-			ID: r.Slug(),
+			ID:  id,
 			Err: err,
 		}
 	}
 
-	q := db.Parameterize("INSERT INTO mgrt_revisions (id, author, comment, sql, performed_at) VALUES (?, ?, ?, ?, ?)")
+	n, err := res.RowsAffected()
 
-	if _, err := db.Exec(q, r.Slug(), r.Author, r.Comment, r.SQL, time.Now().Unix()); err != nil {
+	if err != nil {
 		return &RevisionError{
-			ID: r.Slug(),
+			ID:  id,
 			Err: err,
 		}
 	}
+
+	if n == 0 {
+		return &RevisionError{
+			ID:  id,
+			Err: ErrNotFound,
+		}
+	}
 	return nil
 }
 
-// Title will extract the title from the comment of the current Revision. First,
-// this will truncate the title to being 72 characters. If the comment was longer
-// than 72 characters, then the title will be suffixed with "...". If a LF
-// character can be found in the title, then the title will be truncated again
-// up to where that LF character occurs.
-func (r *Revision) Title() string {
-	title := r.Comment
+// RevisionStats returns a summary of the revisions that have been performed
+// against the given database. This is done in a single query, without
+// retrieving each of the revisions.
+func RevisionStats(db *DB) (Stats, error) {
+	var (
+		stats  Stats
+		first  sql.NullInt64
+		last   sql.NullInt64
+		lastid sql.NullString
+	)
 
-	if l := len(title); l >= 72 {
-		title = title[:72]
+	q := `SELECT COUNT(id), MIN(performed_at), MAX(performed_at),
+	(SELECT id FROM mgrt_revisions ORDER BY performed_at DESC, id DESC LIMIT 1)
+	FROM mgrt_revisions`
 
-		if l > 72 {
-			title += "..."
-		}
+	if err := db.QueryRow(q).Scan(&stats.Total, &first, &last, &lastid); err != nil {
+		return stats, err
 	}
 
-	if i := bytes.IndexByte([]byte(title), '\n'); i > 0 {
-		title = title[:i]
+	if first.Valid {
+		stats.FirstPerformedAt = time.Unix(first.Int64, 0)
 	}
-	return title
+
+	if last.Valid {
+		stats.LastPerformedAt = time.Unix(last.Int64, 0)
+	}
+
+	stats.LastID = lastid.String
+	return stats, nil
 }
 
-// String returns the string representation of the Revision. This will be the
-// comment block header followed by the Revision SQL itself.
-func (r *Revision) String() string {
-	var buf bytes.Buffer
+// DiffApplied compares the revisions that have been performed against the two
+// given databases. This returns the revisions that have only been performed in
+// a, and the revisions that have only been performed in b. Revisions are
+// compared by their slug, and will be ordered as they are in GetRevisions.
+func DiffApplied(a, b *DB) ([]*Revision, []*Revision, error) {
+	revsa, err := GetRevisions(a, -1)
 
-	buf.WriteString("/*\n")
-	buf.WriteString("Revision: " + r.Slug() + "\n")
-	buf.WriteString("Author:   " + r.Author + "\n")
+	if err != nil {
+		return nil, nil, err
+	}
 
-	if r.Comment != "" {
-		buf.WriteString("\n" + r.Comment + "\n")
+	revsb, err := GetRevisions(b, -1)
+
+	if err != nil {
+		return nil, nil, err
 	}
-	buf.WriteString("*/\n\n")
-	buf.WriteString(r.SQL)
+
+	diff := func(revs0, revs1 []*Revision) []*Revision {
+		set := make(map[string]struct{}, len(revs1))
+
+		for _, rev := range revs1 {
+			set[rev.Slug()] = struct{}{}
+		}
+
+		revs := make([]*Revision, 0)
+
+		for _, rev := range revs0 {
+			if _, ok := set[rev.Slug()]; !ok {
+				revs = append(revs, rev)
+			}
+		}
+		return revs
+	}
+	return diff(revsa, revsb), diff(revsb, revsa), nil
+}
+
+// AuditOption is a function for configuring how the revisions performed
+// against a database are audited by OrphanedRevisions.
+type AuditOption func(*audit)
+
+// audit is the policy used when auditing revisions.
+type audit struct {
+	ignoreMissing bool
+}
+
+// IgnoreMissing returns an AuditOption that sets whether revisions performed
+// against the database with no local revision are ignored. By default they are
+// ignored, and only returned to be warned about. If false, then they are
+// treated as an error.
+func IgnoreMissing(ignore bool) AuditOption {
+	return func(a *audit) {
+		a.ignoreMissing = ignore
+	}
+}
+
+// OrphanedRevisions returns the revisions that have been performed against the
+// given database, but whose IDs are not in the given local IDs. The IDs should
+// be prefixed with the category of the revision, as returned by Slug. This is
+// typically the result of a revision being performed from another branch. The
+// returned revisions will be ordered by their performance date ascending.
+//
+// If IgnoreMissing(false) is given, then the Errors type will also be returned
+// containing a *RevisionError wrapping ErrMissing for each of the revisions.
+func OrphanedRevisions(db *DB, localIDs []string, opts ...AuditOption) ([]*Revision, error) {
+	a := audit{
+		ignoreMissing: true,
+	}
+
+	for _, opt := range opts {
+		opt(&a)
+	}
+
+	applied, err := GetRevisionsAsc(db, -1)
+
+	if err != nil {
+		return nil, err
+	}
+
+	set := make(map[string]struct{}, len(localIDs))
+
+	for _, id := range localIDs {
+		set[id] = struct{}{}
+	}
+
+	orphaned := make([]*Revision, 0)
+	errs := make(Errors, 0)
+
+	for _, rev := range applied {
+		if _, ok := set[rev.Slug()]; !ok {
+			orphaned = append(orphaned, rev)
+
+			if !a.ignoreMissing {
+				errs = append(errs, &RevisionError{
+					ID:  rev.Slug(),
+					Err: ErrMissing,
+				})
+			}
+		}
+	}
+	return orphaned, errs.err()
+}
+
+// PendingRevisions returns the revisions in local that have not been performed
+// against the given database. The returned revisions will be sorted into
+// ascending order.
+func PendingRevisions(db *DB, local []*Revision) ([]*Revision, error) {
+	applied, err := GetRevisions(db, -1)
+
+	if err != nil {
+		return nil, err
+	}
+
+	set := make(map[string]struct{}, len(applied))
+
+	for _, rev := range applied {
+		set[rev.Slug()] = struct{}{}
+	}
+
+	var c Collection
+
+	for _, rev := range local {
+		if _, ok := set[rev.Slug()]; ok {
+			continue
+		}
+
+		if err := c.Put(rev); err != nil {
+			return nil, err
+		}
+	}
+	return c.Slice(), nil
+}
+
+// AuditOrder returns the revisions in local that have not been performed
+// against the given database, but which are older than the newest revision
+// that has been performed in the same category. Performing these revisions
+// would interleave them with changes that have already been made, which is
+// typically the result of a mistake when merging branches. The returned
+// revisions will be sorted into ascending order.
+func AuditOrder(db *DB, local []*Revision) ([]*Revision, error) {
+	applied, err := GetRevisions(db, -1)
+
+	if err != nil {
+		return nil, err
+	}
+
+	set := make(map[string]struct{}, len(applied))
+	newest := make(map[string]string)
+
+	for _, rev := range applied {
+		set[rev.Slug()] = struct{}{}
+
+		if rev.ID > newest[rev.Category] {
+			newest[rev.Category] = rev.ID
+		}
+	}
+
+	var c Collection
+
+	for _, rev := range local {
+		if _, ok := set[rev.Slug()]; ok {
+			continue
+		}
+
+		if rev.ID < newest[rev.Category] {
+			if err := c.Put(rev); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return c.Slice(), nil
+}
+
+// PerformRevisions will perform the given revisions against the given database.
+// The mgrt_revisions table will be created via EnsureTable if it does not
+// already exist. The given revisions will be sorted into ascending order first
+// before they are performed. If any of the given revisions have already been
+// performed then the Errors type will be returned containing *RevisionError for
+// each revision that was already performed. If all of them had already been
+// performed, then the returned Errors will also contain ErrNoPending. If
+// any of the given revisions are invalid, as reported by Validate, or have a
+// duplicate ID, then nothing is performed.
+func PerformRevisions(db *DB, revs ...*Revision) error {
+	m := Migrator{DB: db}
+	return m.PerformRevisions(revs...)
+}
+
+// EnsureRevisions will perform the given revisions against the given database
+// that have not already been performed. Unlike PerformRevisions, revisions that
+// have already been performed are not reported as errors, so this returns nil
+// when all of the given revisions have been performed.
+func EnsureRevisions(db *DB, revs ...*Revision) error {
+	m := Migrator{DB: db}
+	return m.EnsureRevisions(revs...)
+}
+
+// PerformRevisionsWithVars is like PerformRevisions, only the SQL of each
+// revision is rendered via text/template against the given variables before
+// it is performed. See Migrator.Vars for details, including the risk of SQL
+// injection.
+func PerformRevisionsWithVars(db *DB, vars map[string]string, revs ...*Revision) error {
+	m := Migrator{
+		DB:   db,
+		Vars: vars,
+	}
+	return m.PerformRevisions(revs...)
+}
+
+// PerformRevisionsCategory will perform the given revisions that are in the
+// given category against the given database. Revisions in other categories are
+// not performed. An empty category is the default category.
+func PerformRevisionsCategory(db *DB, category string, revs ...*Revision) error {
+	m := Migrator{DB: db}
+	return m.PerformRevisionsCategory(category, revs...)
+}
+
+// PerformRevisionsTo will perform the given revisions against the given
+// database up to and including the revision with the given target ID. Any
+// revisions after the target are not performed. If the target is not in the
+// given revisions, then a *RevisionError wrapping ErrNotFound is returned.
+func PerformRevisionsTo(db *DB, target string, revs ...*Revision) error {
+	m := Migrator{DB: db}
+	return m.PerformRevisionsTo(target, revs...)
+}
+
+// TestRevision executes the SQL of the given Revision against the given
+// database to check that it can be performed, such as before committing it. The
+// revision is not recorded in the mgrt_revisions table. Unless the revision
+// sets NoTransaction, or the database was given an Execer via With, it is
+// executed within a transaction that is rolled back afterwards, however some
+// databases, such as MySQL, implicitly commit changes to the schema, so this
+// should only be used against a throwaway database. If the SQL fails, then a
+// *RevisionError wrapping the error is returned, along with its SQLState and
+// Code.
+func TestRevision(db *DB, rev *Revision) error {
+	if err := rev.EnsureLoaded(); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+
+	e := db.execer
+
+	if e == nil && rev.NoTransaction {
+		e = db.DB
+	}
+
+	if e == nil {
+		tx, err := db.BeginTx(ctx, nil)
+
+		if err != nil {
+			return err
+		}
+
+		defer tx.Rollback()
+
+		e = tx
+	}
+
+	if _, err := e.ExecContext(ctx, rev.SQL); err != nil {
+		return wrapRevisionError(db, rev, err)
+	}
+	return nil
+}
+
+// IsAllPerformed reports whether the given error only reports revisions that
+// have already been performed. This is the case when every error in an Errors
+// wraps ErrPerformed, other than ErrNoPending. This can be used to treat the
+// re-running of revisions that have all been performed as a success, for
+// example,
+//
+//	if err := mgrt.PerformRevisions(db, revs...); err != nil && !mgrt.IsAllPerformed(err) {
+//	    // handle error
+//	}
+func IsAllPerformed(err error) bool {
+	errs, ok := err.(Errors)
+
+	if !ok {
+		return errors.Is(err, ErrPerformed)
+	}
+
+	if len(errs) == 0 {
+		return false
+	}
+
+	for _, err := range errs {
+		if err != ErrNoPending && !errors.Is(err, ErrPerformed) {
+			return false
+		}
+	}
+	return true
+}
+
+// VerifyRevisions checks the given revisions against the revisions that have
+// been performed in the given database. If the hash of a given revision differs
+// from the hash that was recorded when it was performed, then the Errors type
+// will be returned containing a *RevisionError wrapping ErrChanged for each
+// revision that has changed. Revisions that have not been performed, or that
+// were performed without a hash being recorded, are skipped.
+func VerifyRevisions(db *DB, revs ...*Revision) error {
+	m := Migrator{DB: db}
+	return m.Verify(revs...)
+}
+
+// Squash squashes the revisions from the given revisions in the range of from
+// up to and including to into a single Revision. The given revisions should be
+// all of the local revisions, such as those loaded via LoadDirs, so that every
+// revision within the range is squashed, and the range is contiguous. The from
+// and to IDs are prefixed with their category, as returned by Slug, and both
+// must be in the same category, otherwise ErrNotFound is returned for the one
+// that does not exist. The SQL of each revision in the range is concatenated
+// in ascending order into the SQL of the returned Revision, and its comment
+// lists the revisions that were squashed. The given revisions must have unique
+// IDs, otherwise ErrDuplicate is returned.
+//
+// The returned Revision has the ID and version of to, so databases that have
+// performed to will treat it as performed. Since its SQL differs from that of
+// to, VerifyRevisions will report it as changed in those databases, and it
+// should only be squashed when each database has performed either all or none
+// of the range, otherwise the revisions that were performed would be performed
+// again.
+func Squash(revs []*Revision, from, to string) (*Revision, error) {
+	var c Collection
+
+	for _, rev := range revs {
+		if err := c.Put(rev); err != nil {
+			return nil, err
+		}
+	}
+
+	first, ok := c.Get(from)
+
+	if !ok {
+		return nil, &RevisionError{
+			ID:  from,
+			Err: ErrNotFound,
+		}
+	}
+
+	last, ok := c.Get(to)
+
+	if !ok {
+		return nil, &RevisionError{
+			ID:  to,
+			Err: ErrNotFound,
+		}
+	}
+
+	if first.Category != last.Category {
+		return nil, errors.New("cannot squash revisions across categories")
+	}
+
+	if first.ID > last.ID {
+		return nil, errors.New("cannot squash revisions, " + from + " is after " + to)
+	}
+
+	sorted := make([]*Revision, 0)
+
+	for _, rev := range c.Slice() {
+		if rev.Category == first.Category && rev.ID >= first.ID && rev.ID <= last.ID {
+			sorted = append(sorted, rev)
+		}
+	}
+
+
+	var (
+		authors []string
+		comment bytes.Buffer
+		sqlbuf  bytes.Buffer
+		notx    bool
+	)
+
+	seenAuthors := make(map[string]struct{})
+
+	comment.WriteString("Squash of the following revisions:\n")
+
+	for i, rev := range sorted {
+		if _, ok := seenAuthors[rev.Author]; !ok {
+			seenAuthors[rev.Author] = struct{}{}
+			authors = append(authors, rev.Author)
+		}
+
+		comment.WriteString("\n" + rev.Slug())
+
+		if title := rev.Title(); title != "" {
+			comment.WriteString(": " + title)
+		}
+
+		if i > 0 {
+			sqlbuf.WriteString("\n\n")
+		}
+		sqlbuf.WriteString(rev.SQL)
+
+		notx = notx || rev.NoTransaction
+	}
+
+	return &Revision{
+		ID:            last.ID,
+		Category:      last.Category,
+		Author:        strings.Join(authors, ", "),
+		Comment:       comment.String(),
+		SQL:           sqlbuf.String(),
+		Version:       last.Version,
+		NoTransaction: notx,
+	}, nil
+}
+
+// OpenRevision opens the revision at the given path. If the revision cannot
+// be unmarshalled, then the returned *RevisionError will contain the path. If
+// the file is gzip compressed, then it is decompressed as it is read.
+func OpenRevision(path string) (*Revision, error) {
+	f, err := os.Open(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	br := bufio.NewReader(f)
+
+	var r io.Reader = br
+
+	if magic, _ := br.Peek(2); bytes.Equal(magic, gzipMagic) {
+		gr, err := gzip.NewReader(br)
+
+		if err != nil {
+			return nil, &RevisionError{
+				Path: path,
+				Err:  err,
+			}
+		}
+
+		defer gr.Close()
+
+		r = gr
+	}
+
+	rev, err := UnmarshalRevision(r)
+
+	if err != nil {
+		var rerr *RevisionError
+
+		if errors.As(err, &rerr) {
+			rerr.Path = path
+			return nil, rerr
+		}
+		return nil, &RevisionError{
+			Path: path,
+			Err:  err,
+		}
+	}
+	return rev, nil
+}
+
+// OpenRevisionLazy opens the revision at the given path like OpenRevision,
+// but only reads its comment block header. The SQL of the revision is not read
+// until it is needed, at which point it is loaded via EnsureLoaded. This is
+// useful when opening many revisions just to see which are pending.
+//
+// A revision opened this way is loaded automatically when it is performed, but
+// EnsureLoaded must be called before anything else that uses its SQL, such as
+// WriteTo or Squash.
+func OpenRevisionLazy(path string) (*Revision, error) {
+	f, err := os.Open(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	br := bufio.NewReader(f)
+
+	if magic, _ := br.Peek(2); bytes.Equal(magic, gzipMagic) {
+		gr, err := gzip.NewReader(br)
+
+		if err != nil {
+			return nil, &RevisionError{
+				Path: path,
+				Err:  err,
+			}
+		}
+
+		defer gr.Close()
+
+		br = bufio.NewReader(gr)
+	}
+
+	rev, err := unmarshalHeader(br)
+
+	if err != nil {
+		var rerr *RevisionError
+
+		if errors.As(err, &rerr) {
+			rerr.Path = path
+			return nil, rerr
+		}
+		return nil, &RevisionError{
+			Path: path,
+			Err:  err,
+		}
+	}
+
+	rev.path = path
+	return rev, nil
+}
+
+// ValidateDir checks that each of the revisions in the given directory, and
+// its sub-directories, can be opened via OpenRevision. A revision is invalid
+// if it cannot be parsed, if its ID is invalid, if it has no author, or if its
+// ID is the same as that of another revision. This does not stop at the first
+// invalid revision, each error is returned, typically as a *RevisionError
+// with the Path of the invalid revision.
+func ValidateDir(dir string) []error {
+	errs := make([]error, 0)
+
+	var c Collection
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			return nil
+		}
+
+		rev, err := OpenRevision(path)
+
+		if err != nil {
+			errs = append(errs, err)
+			return nil
+		}
+
+		if rev.Author == "" {
+			errs = append(errs, &RevisionError{
+				ID:   rev.Slug(),
+				Path: path,
+				Err:  errors.New("missing " + headerAuthor + " header"),
+			})
+		}
+
+		if err := c.Put(rev); err != nil {
+			if rerr, ok := err.(*RevisionError); ok {
+				rerr.Path = path
+			}
+			errs = append(errs, err)
+		}
+		return nil
+	})
+
+	if err != nil {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// ImportSQLFile creates a Revision from the file of raw SQL at the given path,
+// that has no comment block header. This is for importing the SQL files of
+// other migration tools. If the name of the file begins with a valid Revision
+// ID, such as 20060102150405_create_users.sql, then that is used as the ID,
+// otherwise the modification time of the file is used. The rest of the name,
+// without any leading numbering, is used as the comment.
+func ImportSQLFile(path, author string) (*Revision, error) {
+	info, err := os.Stat(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := os.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+
+	id := info.ModTime().Format(revisionIdFormat)
+
+	if len(name) >= len(revisionIdFormat) {
+		if _, err := time.Parse(revisionIdFormat, name[:len(revisionIdFormat)]); err == nil {
+			id = name[:len(revisionIdFormat)]
+			name = name[len(revisionIdFormat):]
+		}
+	}
+
+	name = strings.TrimLeft(name, "0123456789")
+	name = strings.NewReplacer("_", " ", "-", " ", ".", " ").Replace(name)
+
+	return &Revision{
+		ID:      id,
+		Author:  author,
+		Comment: strings.Join(strings.Fields(name), " "),
+		SQL:     strings.TrimSpace(string(b)),
+	}, nil
+}
+
+// UnmarshalRevision will unmarshal a Revision from the given io.Reader. This
+// will expect to see a comment block header that contains the metadata about
+// the Revision itself. The header is ended by the first line that ends with */,
+// anything after this is the SQL of the Revision. This will check to see if the
+// given Revision ID is valid. A Revision id is considered valid when it can be
+// parsed into a valid time via time.Parse using the layout of 20060102150405.
+func UnmarshalRevision(r io.Reader) (*Revision, error) {
+	b, err := io.ReadAll(r)
+
+	if err != nil {
+		return nil, err
+	}
+
+	rev := &Revision{}
+
+	s := strings.TrimSpace(string(b))
+
+	if strings.HasPrefix(s, headerOpen) {
+		var block string
+
+		block, s = splitHeader(s[len(headerOpen):])
+		parseHeader(rev, block)
+	}
+
+	rev.SQL = strings.TrimSpace(s)
+
+	if err := parseID(rev); err != nil {
+		return nil, err
+	}
+	return rev, nil
+}
+
+// parseID splits the ID of the given Revision into its category and ID, and
+// checks that the ID is valid.
+func parseID(rev *Revision) error {
+	parts := strings.Split(rev.ID, "/")
+	end := len(parts) - 1
+
+	rev.ID = parts[end]
+	rev.Category = strings.Join(parts[:end], "/")
+
+	if _, err := time.Parse(revisionIdFormat, rev.ID); err != nil {
+		return &RevisionError{
+			ID:  rev.Slug(),
+			Err: ErrInvalid,
+		}
+	}
+	return nil
+}
+
+// unmarshalHeader will unmarshal a Revision from only the comment block header
+// read from the given reader. Reading stops at the end of the header, so the
+// SQL of the Revision is not read.
+func unmarshalHeader(br *bufio.Reader) (*Revision, error) {
+	var buf strings.Builder
+
+	for {
+		line, err := br.ReadString('\n')
+
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+
+		buf.WriteString(line)
+
+		s := strings.TrimSpace(buf.String())
+
+		if err == io.EOF || (s != "" && !strings.HasPrefix(s, headerOpen)) {
+			break
+		}
+
+		if len(s) > len(headerOpen) && strings.HasSuffix(strings.TrimRightFunc(line, unicode.IsSpace), headerClose) {
+			break
+		}
+	}
+
+	rev := &Revision{}
+
+	if s := strings.TrimSpace(buf.String()); strings.HasPrefix(s, headerOpen) {
+		block, _ := splitHeader(s[len(headerOpen):])
+		parseHeader(rev, block)
+	}
+
+	if err := parseID(rev); err != nil {
+		return nil, err
+	}
+	return rev, nil
+}
+
+// splitHeader splits the given string at the end of the comment block header.
+// This returns the contents of the header, and everything that follows it. The
+// given string should not include the opening of the comment block. The header
+// is ended by the first line that ends with the close of the comment block, so
+// the close may appear elsewhere in the comment, and anywhere in the SQL.
+func splitHeader(s string) (string, string) {
+	off := 0
+
+	for {
+		end := len(s)
+
+		i := strings.IndexByte(s[off:], '\n')
+
+		if i >= 0 {
+			end = off + i
+		}
+
+		line := strings.TrimRightFunc(s[off:end], unicode.IsSpace)
+
+		if strings.HasSuffix(line, headerClose) {
+			return s[:off+len(line)-len(headerClose)], s[end:]
+		}
+
+		if i < 0 {
+			return s, ""
+		}
+		off = end + 1
+	}
+}
+
+// parseHeader parses the contents of a comment block header into the given
+// Revision. The header begins with lines in the form of "Key: value", the
+// first line that is not a known header ends these, and everything from there
+// on is the comment of the Revision.
+func parseHeader(rev *Revision, block string) {
+	lines := strings.Split(block, "\n")
+
+	i := 0
+
+loop:
+	for ; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+
+		if line == "" {
+			if rev.ID == "" && rev.Author == "" {
+				continue
+			}
+			break
+		}
+
+		pos := strings.Index(line, ":")
+
+		if pos < 0 {
+			break
+		}
+
+		val := strings.TrimSpace(line[pos+1:])
+
+		switch line[:pos] {
+		case headerRevision:
+			rev.ID = val
+		case headerAuthor:
+			rev.Author = val
+		case headerVersion:
+			rev.Version = val
+		case headerTransaction:
+			rev.NoTransaction = val == "no"
+		case headerRecord:
+			rev.NoRecord = val == "no"
+		default:
+			break loop
+		}
+	}
+	rev.Comment = strings.TrimSpace(strings.Join(lines[i:], "\n"))
+}
+
+// MarshalRevision writes the given Revision to the given io.Writer, in the form
+// that is read by UnmarshalRevision. This is the comment block header followed
+// by the Revision SQL itself.
+func MarshalRevision(w io.Writer, r *Revision) error {
+	_, err := r.WriteTo(w)
+	return err
+}
+
+// UnmarshalRevisions will unmarshal multiple revisions from the given
+// io.Reader. Each revision begins with a comment block header, which is an
+// occurrence of /* followed by a Revision: or Author: header with only
+// whitespace in between. The SQL between a header and the next header, or the
+// end of the reader, is attributed to the revision of the preceding header. If
+// any header is missing its Revision ID then ErrInvalid is returned. Any
+// non-empty text before the first header will be treated as a revision without
+// a header, and so will also result in ErrInvalid being returned.
+func UnmarshalRevisions(r io.Reader) ([]*Revision, error) {
+	b, err := io.ReadAll(r)
+
+	if err != nil {
+		return nil, err
+	}
+
+	s := string(b)
+
+	locs := revisionHeaderPattern.FindAllStringIndex(s, -1)
+	blocks := make([]string, 0, len(locs)+1)
+
+	start := 0
+
+	for _, loc := range locs {
+		if block := s[start:loc[0]]; strings.TrimSpace(block) != "" {
+			blocks = append(blocks, block)
+		}
+		start = loc[0]
+	}
+
+	if block := s[start:]; strings.TrimSpace(block) != "" {
+		blocks = append(blocks, block)
+	}
+
+	revs := make([]*Revision, 0, len(blocks))
+
+	for _, block := range blocks {
+		rev, err := UnmarshalRevision(strings.NewReader(block))
+
+		if err != nil {
+			return nil, err
+		}
+		revs = append(revs, rev)
+	}
+	return revs, nil
+}
+
+func (n *node) walk(visit func(*Revision)) {
+	if n.left != nil {
+		n.left.walk(visit)
+	}
+
+	visit(n.rev)
+
+	if n.right != nil {
+		n.right.walk(visit)
+	}
+}
+
+func (e Errors) err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+// Error returns the string representation of all the errors in the underlying
+// slice. Each error will be on a separate line in the returned string.
+func (e Errors) Error() string {
+	var buf bytes.Buffer
+
+	for _, err := range e {
+		buf.WriteString(err.Error() + "\n")
+	}
+	return buf.String()
+}
+
+// Unwrap returns the errors that occurred. From Go 1.20, this allows for
+// errors.Is and errors.As to match against each of the errors.
+func (e Errors) Unwrap() []error { return e }
+
+// Is reports whether any of the errors matches the given target via
+// errors.Is, so the Errors returned when there were no pending revisions
+// matches ErrNoPending before Go 1.20 too. This implements the interface used
+// by errors.Is.
+func (e Errors) Is(target error) bool {
+	for _, err := range e {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// Put puts the given Revision in the current Collection. If the Collection
+// already has a Revision with the same ID in the same category, then a
+// *RevisionError wrapping ErrDuplicate is returned.
+func (c *Collection) Put(r *Revision) error {
+	t, err := time.Parse(revisionIdFormat, r.ID)
+
+	if err != nil {
+		return &RevisionError{
+			ID:  r.Slug(),
+			Err: ErrInvalid,
+		}
+	}
+
+	if err := checkSkew(r, c.MaxSkew); err != nil {
+		return err
+	}
+
+	if _, ok := findNode(c.root, t.Unix(), r.Slug()); ok {
+		return &RevisionError{
+			ID:  r.Slug(),
+			Err: ErrDuplicate,
+		}
+	}
+
+	insertNode(&c.root, t.Unix(), r)
+	c.len++
+	return nil
+}
+
+// checkSkew checks that the time of the given Revision's ID is no further in
+// the future than the given skew. IDs are created from the local time, so they
+// are parsed as such. Nothing is checked if the skew is zero.
+func checkSkew(r *Revision, skew time.Duration) error {
+	if skew <= 0 {
+		return nil
+	}
+
+	t, err := time.ParseInLocation(revisionIdFormat, r.ID, time.Local)
+
+	if err != nil {
+		return &RevisionError{
+			ID:  r.Slug(),
+			Err: ErrInvalid,
+		}
+	}
+
+	if limit := now().Add(skew); t.After(limit) {
+		return &RevisionError{
+			ID:  r.Slug(),
+			Err: fmt.Errorf("%w, %s is more than %s from now", ErrFuture, t.Format("2006-01-02 15:04:05"), skew),
+		}
+	}
+	return nil
+}
+
+// Get returns the Revision with the given ID from the Collection. If the
+// Revision belongs to a category, then the ID should be prefixed with the
+// category, as returned by Slug. This returns false if the Collection does not
+// have the Revision, or if the given ID is invalid.
+func (c *Collection) Get(id string) (*Revision, bool) {
+	rev := &Revision{ID: id}
+
+	if i := strings.LastIndex(id, "/"); i >= 0 {
+		rev.Category = id[:i]
+		rev.ID = id[i+1:]
+	}
+
+	t, err := time.Parse(revisionIdFormat, rev.ID)
+
+	if err != nil {
+		return nil, false
+	}
+	return findNode(c.root, t.Unix(), rev.Slug())
+}
+
+// Has returns whether the Collection has the Revision with the given ID, as
+// given to Get.
+func (c *Collection) Has(id string) bool {
+	_, ok := c.Get(id)
+	return ok
+}
+
+// Len returns the number of items in the collection.
+func (c *Collection) Len() int { return c.len }
+
+// Slice returns a sorted slice of all the revisions in the collection.
+func (c *Collection) Slice() []*Revision {
+	revs := make([]*Revision, 0, c.len)
+
+	if c.root == nil {
+		return revs
+	}
+
+	c.root.walk(func(r *Revision) {
+		revs = append(revs, r)
+	})
+	return revs
+}
+
+func (e *RevisionError) Error() string {
+	s := "revision error"
+
+	if e.ID != "" {
+		s += " " + e.ID
+	}
+
+	if e.Path != "" {
+		s += " in " + e.Path
+	}
+	return s + ": " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error that caused the original RevisionError.
+func (e *RevisionError) Unwrap() error { return e.Err }
+
+// wrapRevisionError returns the given error wrapped in a *RevisionError for the
+// given Revision, unless it already is one. The SQLState and Code are set from
+// the error via the ErrorCode function of the given *DB, which should be the
+// database the error came from.
+func wrapRevisionError(db *DB, r *Revision, err error) error {
+	if rerr, ok := err.(*RevisionError); ok {
+		return rerr
+	}
+
+	var (
+		state string
+		code  int
+	)
+
+	if db != nil && db.ErrorCode != nil {
+		state, code = db.ErrorCode(err)
+	}
+
+	return &RevisionError{
+		ID:       r.Slug(),
+		Err:      err,
+		SQLState: state,
+		Code:     code,
+	}
+}
+
+// Validate checks that the Revision can be performed. The ID must be valid,
+// and the author and SQL must not be empty. The SQL is not checked if it has
+// not yet been loaded. The returned *RevisionError names the field that is
+// invalid.
+func (r *Revision) Validate() error {
+	if _, err := time.Parse(revisionIdFormat, r.ID); err != nil {
+		return &RevisionError{
+			ID:  r.Slug(),
+			Err: ErrInvalid,
+		}
+	}
+
+	if r.Author == "" {
+		return &RevisionError{
+			ID:  r.Slug(),
+			Err: errors.New("revision author empty"),
+		}
+	}
+
+	if r.path == "" && strings.TrimSpace(r.SQL) == "" {
+		return &RevisionError{
+			ID:  r.Slug(),
+			Err: errors.New("revision sql empty"),
+		}
+	}
+	return nil
+}
+
+// EnsureLoaded loads the SQL of a Revision that was opened via
+// OpenRevisionLazy. This does nothing if the SQL has already been loaded, or if
+// the Revision was not opened lazily. If the revision file no longer has the
+// same ID, then a *RevisionError wrapping ErrChanged is returned.
+func (r *Revision) EnsureLoaded() error {
+	if r.path == "" {
+		return nil
+	}
+
+	rev, err := OpenRevision(r.path)
+
+	if err != nil {
+		return err
+	}
+
+	if rev.Slug() != r.Slug() {
+		return &RevisionError{
+			ID:   r.Slug(),
+			Path: r.path,
+			Err:  ErrChanged,
+		}
+	}
+
+	r.SQL = rev.SQL
+	r.path = ""
+	return nil
+}
+
+// Slug returns the slug of the revision ID, this will be in the format of
+// category/id if the revision belongs to a category.
+func (r *Revision) Slug() string {
+	if r.Category != "" {
+		return r.Category + "/" + r.ID
+	}
+	return r.ID
+}
+
+// Equal reports whether the current Revision has the same content as the
+// given Revision. This compares the slug, author, comment, and SQL of each,
+// with the leading and trailing whitespace of the comment and SQL ignored,
+// since this is trimmed when a revision is unmarshalled. When the revisions
+// were performed is not compared, so a Revision from a database can be
+// compared against one from a file. A Revision opened via OpenRevisionLazy
+// should be loaded via EnsureLoaded first.
+func (r *Revision) Equal(other *Revision) bool {
+	return r.equal(other, strings.TrimSpace)
+}
+
+// EqualNormalized is the same as Equal, only the SQL of each Revision is
+// normalized via NormalizeSQL before being compared, so revisions that only
+// differ in how their SQL is formatted are equal.
+func (r *Revision) EqualNormalized(other *Revision) bool {
+	return r.equal(other, NormalizeSQL)
+}
+
+// equal compares the current Revision with the given Revision, with the SQL of
+// each passed through the given function first.
+func (r *Revision) equal(other *Revision, sql func(string) string) bool {
+	if r == nil || other == nil {
+		return r == other
+	}
+
+	return r.Slug() == other.Slug() &&
+		r.Author == other.Author &&
+		strings.TrimSpace(r.Comment) == strings.TrimSpace(other.Comment) &&
+		sql(r.SQL) == sql(other.SQL)
+}
+
+// Perform will perform the current Revision against the given database. If
+// the Revision is emtpy, then nothing happens. If the Revision has already
+// been performed, then ErrPerformed is returned.
+func (r *Revision) Perform(db *DB) error {
+	m := Migrator{DB: db}
+	return m.Perform(r)
+}
+
+// genHash returns the hex encoded SHA256 hash of the Revision's author and
+// SQL.
+func (r *Revision) genHash() string {
+	return hashRevision(r.Author, r.SQL)
+}
+
+// normalizedHash returns the hex encoded SHA256 hash of the Revision's author
+// and SQL, with the SQL normalized via NormalizeSQL.
+func (r *Revision) normalizedHash() string {
+	return hashRevision(r.Author, NormalizeSQL(r.SQL))
+}
+
+// NormalizeSQL returns the given SQL with its whitespace normalized. Line
+// endings are normalized, leading and trailing whitespace is stripped, and each
+// run of whitespace is collapsed into a single space. This is lexical, not
+// semantic, so whitespace within string literals and comments is normalized
+// too, and SQL that is equivalent but written differently, such as with a
+// different case, will not be the same once normalized.
+func NormalizeSQL(sql string) string {
+	return strings.Join(strings.Fields(sql), " ")
+}
+
+// hashRevision returns the hex encoded SHA256 hash of the given author and
+// SQL.
+func hashRevision(author, sql string) string {
+	h := sha256.New()
+	h.Write([]byte(author))
+	h.Write([]byte(sql))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Title will extract the title from the comment of the current Revision. The
+// title is the first line of the comment, truncated to 72 characters. If the
+// first line was longer than 72 characters, then the title will be suffixed
+// with "...". Characters are counted as runes, so a multibyte character will
+// never be cut in half.
+func (r *Revision) Title() string {
+	title := r.Comment
+
+	if i := strings.IndexRune(title, '\n'); i >= 0 {
+		title = title[:i]
+	}
+
+	if utf8.RuneCountInString(title) > 72 {
+		title = string([]rune(title)[:72]) + "..."
+	}
+	return title
+}
+
+// WriteTo writes the Revision to the given io.Writer. This will be the comment
+// block header followed by the Revision SQL itself. This implements the
+// io.WriterTo interface.
+func (r *Revision) WriteTo(w io.Writer) (int64, error) {
+	var n int64
+
+	write := func(s string) error {
+		n0, err := io.WriteString(w, s)
+		n += int64(n0)
+		return err
+	}
+
+	parts := []string{
+		headerOpen + "\n",
+		headerLine(headerRevision, r.Slug()),
+		headerLine(headerAuthor, r.Author),
+	}
+
+	if r.Version != "" {
+		parts = append(parts, headerLine(headerVersion, r.Version))
+	}
+
+	if r.NoTransaction {
+		parts = append(parts, headerLine(headerTransaction, "no"))
+	}
+
+	if r.NoRecord {
+		parts = append(parts, headerLine(headerRecord, "no"))
+	}
+
+	if r.Comment != "" {
+		parts = append(parts, "\n"+r.Comment+"\n")
+	}
+
+	parts = append(parts, headerClose+"\n\n", r.SQL)
+
+	for _, part := range parts {
+		if err := write(part); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// MarshalJSON returns the JSON representation of the Revision. The time the
+// Revision was performed is formatted via RFC3339, and is omitted if the
+// Revision has not been performed. This implements the json.Marshaler
+// interface.
+func (r *Revision) MarshalJSON() ([]byte, error) {
+	v := revisionJSON{
+		ID:            r.ID,
+		Category:      r.Category,
+		Author:        r.Author,
+		Comment:       r.Comment,
+		SQL:           r.SQL,
+		Hash:          r.Hash,
+		PerformedBy:   r.PerformedBy,
+		DurationMs:    r.Duration.Milliseconds(),
+		Version:       r.Version,
+		NoTransaction: r.NoTransaction,
+		NoRecord:      r.NoRecord,
+	}
+
+	if !r.PerformedAt.IsZero() {
+		v.PerformedAt = r.PerformedAt.Format(time.RFC3339)
+	}
+	return json.Marshal(v)
+}
+
+// UnmarshalJSON unmarshals the Revision from the JSON returned by MarshalJSON.
+// This implements the json.Unmarshaler interface.
+func (r *Revision) UnmarshalJSON(b []byte) error {
+	var v revisionJSON
+
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+
+	var performedAt time.Time
+
+	if v.PerformedAt != "" {
+		t, err := time.Parse(time.RFC3339, v.PerformedAt)
+
+		if err != nil {
+			return err
+		}
+		performedAt = t
+	}
+
+	*r = Revision{
+		ID:            v.ID,
+		Category:      v.Category,
+		Author:        v.Author,
+		Comment:       v.Comment,
+		SQL:           v.SQL,
+		PerformedAt:   performedAt,
+		Hash:          v.Hash,
+		PerformedBy:   v.PerformedBy,
+		Duration:      time.Duration(v.DurationMs) * time.Millisecond,
+		Version:       v.Version,
+		NoTransaction: v.NoTransaction,
+		NoRecord:      v.NoRecord,
+	}
+	return nil
+}
+
+// headerLine returns a line of the comment block header for the given key and
+// value.
+func headerLine(key, val string) string {
+	return fmt.Sprintf("%-*s %s\n", headerWidth, key+":", val)
+}
+
+// String returns the string representation of the Revision. This will be the
+// comment block header followed by the Revision SQL itself.
+func (r *Revision) String() string {
+	var buf bytes.Buffer
+
+	r.WriteTo(&buf)
 	return buf.String()
 }
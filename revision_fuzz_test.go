@@ -0,0 +1,44 @@
+// +build go1.18
+
+package mgrt
+
+import (
+	"strings"
+	"testing"
+)
+
+func FuzzUnmarshalRevision(f *testing.F) {
+	seeds := []string{
+		"",
+		"/*",
+		"*/",
+		"/**/",
+		"abc: x",
+		"/*\nabc: x\n*/",
+		"/*\nRevision: 20060102150405\nAuthor:   Andrew\n\nComment\n*/\n\nSELECT 1;",
+		"/* Revision: perms/20060102150405\nAuthor: Andrew\nTransaction: no\n*/ SELECT 1;",
+		"/*\nRevision: 20060102150405\n\nfix the a*/b regex\n*/\n/* comment */ SELECT 1;",
+	}
+
+	for _, seed := range seeds {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, s string) {
+		rev, err := UnmarshalRevision(strings.NewReader(s))
+
+		if err != nil {
+			return
+		}
+
+		rev2, err := UnmarshalRevision(strings.NewReader(rev.String()))
+
+		if err != nil {
+			t.Fatalf("failed to unmarshal marshalled revision %q\n%s\n", err, rev.String())
+		}
+
+		if rev2.Slug() != rev.Slug() || rev2.Author != rev.Author || rev2.NoTransaction != rev.NoTransaction {
+			t.Fatalf("unexpected revision, expected=%+v, got=%+v\n", *rev, *rev2)
+		}
+	})
+}
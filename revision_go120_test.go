@@ -0,0 +1,38 @@
+// +build go1.20
+
+package mgrt
+
+import (
+	"errors"
+	"io"
+	"testing"
+)
+
+func Test_ErrorsUnwrap(t *testing.T) {
+	err := error(Errors{
+		&RevisionError{ID: "20060102150405", Err: ErrPerformed},
+		&RevisionError{ID: "20060102150406", Err: io.ErrUnexpectedEOF},
+	})
+
+	if !errors.Is(err, ErrPerformed) {
+		t.Errorf("expected errors.Is to match %q\n", ErrPerformed)
+	}
+
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("expected errors.Is to match %q\n", io.ErrUnexpectedEOF)
+	}
+
+	if errors.Is(err, ErrNotFound) {
+		t.Errorf("unexpected match for %q\n", ErrNotFound)
+	}
+
+	var rerr *RevisionError
+
+	if !errors.As(err, &rerr) {
+		t.Fatal("expected errors.As to match *RevisionError")
+	}
+
+	if rerr.ID != "20060102150405" {
+		t.Errorf("unexpected revision id, expected=%q, got=%q\n", "20060102150405", rerr.ID)
+	}
+}
@@ -0,0 +1,1356 @@
+// +build sqlite3
+
+package mgrt
+
+import (
+	"database/sql"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_RevisionPerformMultiple(t *testing.T) {
+	tmp, err := ioutil.TempFile("", "mgrt-db-*")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.Remove(tmp.Name())
+
+	db, err := Open("sqlite3", tmp.Name())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	tests := []struct {
+		id      string
+		author  string
+		comment string
+		sql     string
+	}{
+		{
+			"20060102150407",
+			"Andrew",
+			"Add password to users table",
+			"ALTER TABLE users ADD COLUMN password VARCHAR NOT NULL;",
+		},
+		{
+			"20060102150405",
+			"Andrew",
+			"Add users table",
+			"CREATE TABLE users ( id INT NOT NULL UNIQUE );",
+		},
+		{
+			"20060102150406",
+			"Andrew",
+			"Add username to users table",
+			"ALTER TABLE users ADD COLUMN username VARCHAR NOT NULL;",
+		},
+	}
+
+	revs := make([]*Revision, 0, len(tests))
+
+	for _, test := range tests {
+		rev := NewRevision(test.author, test.comment)
+		rev.ID = test.id
+		rev.SQL = test.sql
+
+		revs = append(revs, rev)
+	}
+
+	if err := PerformRevisions(db, revs...); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = GetRevision(db, "foo")
+
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("unexpected error, expected=%T, got=%T\n", ErrNotFound, err)
+	}
+
+	var rerr *RevisionError
+
+	if !errors.As(err, &rerr) || rerr.ID != "foo" {
+		t.Fatalf("expected *RevisionError for revision foo, got=%q\n", err)
+	}
+
+	if _, err = GetRevision(db, "20060102150406"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_PerformRevisionsTo(t *testing.T) {
+	tmp, err := ioutil.TempFile("", "mgrt-db-*")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.Remove(tmp.Name())
+
+	db, err := Open("sqlite3", tmp.Name())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	revs := []*Revision{
+		{ID: "20060102150407", Author: "Andrew", SQL: "ALTER TABLE users ADD COLUMN password VARCHAR NOT NULL;"},
+		{ID: "20060102150405", Author: "Andrew", SQL: "CREATE TABLE users ( id INT NOT NULL UNIQUE );"},
+		{ID: "20060102150406", Author: "Andrew", SQL: "ALTER TABLE users ADD COLUMN username VARCHAR NOT NULL;"},
+	}
+
+	if err := PerformRevisionsTo(db, "20060102150408", revs...); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("unexpected error, expected=%q, got=%q\n", ErrNotFound, err)
+	}
+
+	if err := PerformRevisionsTo(db, "20060102150406", revs...); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		id  string
+		err error
+	}{
+		{"20060102150405", nil},
+		{"20060102150406", nil},
+		{"20060102150407", ErrNotFound},
+	}
+
+	for i, test := range tests {
+		if _, err := GetRevision(db, test.id); !errors.Is(err, test.err) {
+			t.Errorf("tests[%d] - unexpected error, expected=%v, got=%v\n", i, test.err, err)
+		}
+	}
+}
+
+func Test_RevisionPerform(t *testing.T) {
+	tmp, err := ioutil.TempFile("", "mgrt-db-*")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.Remove(tmp.Name())
+
+	db, err := Open("sqlite3", tmp.Name())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	tests := []struct {
+		id      string
+		repeat  bool
+		author  string
+		comment string
+		sql     string
+	}{
+		{
+			"20060102150405",
+			true,
+			"Andrew",
+			"Add users table",
+			"CREATE TABLE users ( id INT NOT NULL UNIQUE );",
+		},
+		{
+			"20060102150406",
+			false,
+			"Andrew",
+			"Add username to users table",
+			"ALTER TABLE users ADD COLUMN username VARCHAR NOT NULL;",
+		},
+		{
+			"20060102150407",
+			false,
+			"Andrew",
+			"Add password to users table",
+			"ALTER TABLE users ADD COLUMN password VARCHAR NOT NULL;",
+		},
+	}
+
+	for i, test := range tests {
+		rev := NewRevision(test.author, test.comment)
+		rev.ID = test.id
+		rev.SQL = test.sql
+
+		if err := rev.Perform(db); err != nil {
+			t.Fatalf("tests[%d] - unexpected error %T %q\n", i, err, err)
+		}
+
+		if test.repeat {
+			if err := rev.Perform(db); err != nil {
+				if !errors.Is(err, ErrPerformed) {
+					t.Fatalf("tests[%d] - unexpected error, expected=%T, got=%t\n", i, ErrPerformed, errors.Unwrap(err))
+				}
+			}
+		}
+	}
+
+	revs, err := GetRevisions(db, -1)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(revs) != len(tests) {
+		t.Fatalf("unexpected revision count, expected=%d, got=%d\n", len(tests), len(revs))
+	}
+}
+
+func Test_VerifyRevisions(t *testing.T) {
+	tmp, err := ioutil.TempFile("", "mgrt-db-*")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.Remove(tmp.Name())
+
+	db, err := Open("sqlite3", tmp.Name())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	rev := NewRevision("Andrew", "Add users table")
+	rev.ID = "20060102150405"
+	rev.SQL = "CREATE TABLE users ( id INT NOT NULL UNIQUE );"
+
+	if err := rev.Perform(db); err != nil {
+		t.Fatal(err)
+	}
+
+	performed, err := GetRevision(db, rev.ID)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if performed.Hash != rev.genHash() {
+		t.Fatalf("unexpected revision hash, expected=%q, got=%q\n", rev.genHash(), performed.Hash)
+	}
+
+	if err := VerifyRevisions(db, rev); err != nil {
+		t.Fatal(err)
+	}
+
+	rev.SQL = "CREATE TABLE users ( id INT NOT NULL );"
+
+	if err := VerifyRevisions(db, rev); !errors.Is(err.(Errors)[0], ErrChanged) {
+		t.Fatalf("unexpected error, expected=%q, got=%q\n", ErrChanged, err)
+	}
+
+	rev.SQL = "CREATE TABLE users (\r\n\tid INT NOT NULL UNIQUE  \r\n);\r\n"
+
+	if err := VerifyRevisions(db, rev); !errors.Is(err.(Errors)[0], ErrChanged) {
+		t.Fatalf("unexpected error, expected=%q, got=%q\n", ErrChanged, err)
+	}
+
+	m := Migrator{
+		DB:           db,
+		NormalizeSQL: true,
+	}
+
+	if err := m.Verify(rev); err != nil {
+		t.Fatalf("unexpected error for reformatted revision %q\n", err)
+	}
+
+	rev.SQL = "CREATE TABLE users (\r\n\tid INT NOT NULL\r\n);\r\n"
+
+	if err := m.Verify(rev); !errors.Is(err.(Errors)[0], ErrChanged) {
+		t.Fatalf("unexpected error, expected=%q, got=%q\n", ErrChanged, err)
+	}
+
+	if _, err := db.Exec("UPDATE mgrt_revisions SET hash = NULL"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := VerifyRevisions(db, rev); err != nil {
+		t.Fatalf("unexpected error for unknown hash %q\n", err)
+	}
+}
+
+func Test_DiffApplied(t *testing.T) {
+	dbs := make([]*DB, 0, 2)
+
+	for i := 0; i < 2; i++ {
+		tmp, err := ioutil.TempFile("", "mgrt-db-*")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer os.Remove(tmp.Name())
+
+		db, err := Open("sqlite3", tmp.Name())
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer db.Close()
+
+		dbs = append(dbs, db)
+	}
+
+	tests := []struct {
+		id  string
+		dbs []*DB
+	}{
+		{"20060102150405", dbs},
+		{"20060102150406", dbs[:1]},
+		{"20060102150407", dbs[1:]},
+	}
+
+	for _, test := range tests {
+		for _, db := range test.dbs {
+			rev := NewRevision("Andrew", "")
+			rev.ID = test.id
+			rev.SQL = "SELECT 1;"
+
+			if err := rev.Perform(db); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	onlya, onlyb, err := DiffApplied(dbs[0], dbs[1])
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(onlya) != 1 || onlya[0].ID != "20060102150406" {
+		t.Errorf("unexpected revisions only in a, expected=%q, got=%v\n", "20060102150406", onlya)
+	}
+
+	if len(onlyb) != 1 || onlyb[0].ID != "20060102150407" {
+		t.Errorf("unexpected revisions only in b, expected=%q, got=%v\n", "20060102150407", onlyb)
+	}
+}
+
+func Test_AuditOrder(t *testing.T) {
+	tmp, err := ioutil.TempFile("", "mgrt-db-*")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.Remove(tmp.Name())
+
+	db, err := Open("sqlite3", tmp.Name())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	local := []*Revision{
+		{ID: "20060102150405", Author: "Andrew", SQL: "SELECT 1;"},
+		{ID: "20060102150406", Author: "Andrew", SQL: "SELECT 1;"},
+		{ID: "20060102150407", Author: "Andrew", SQL: "SELECT 1;"},
+		{ID: "20060102150408", Author: "Andrew", SQL: "SELECT 1;"},
+		{ID: "20060102150404", Category: "perms", Author: "Andrew", SQL: "SELECT 1;"},
+	}
+
+	for _, i := range []int{0, 2} {
+		if err := local[i].Perform(db); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pending, err := PendingRevisions(db, local)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(pending) != 3 {
+		t.Fatalf("unexpected pending count, expected=%d, got=%d\n", 3, len(pending))
+	}
+
+	revs, err := AuditOrder(db, local)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(revs) != 1 || revs[0].ID != "20060102150406" {
+		t.Fatalf("unexpected out of order revisions, expected=%q, got=%v\n", "20060102150406", revs)
+	}
+}
+
+func Test_RevisionStats(t *testing.T) {
+	tmp, err := ioutil.TempFile("", "mgrt-db-*")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.Remove(tmp.Name())
+
+	db, err := Open("sqlite3", tmp.Name())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	stats, err := RevisionStats(db)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stats.Total != 0 || !stats.LastPerformedAt.IsZero() || stats.LastID != "" {
+		t.Fatalf("unexpected stats for empty database %+v\n", stats)
+	}
+
+	revs := []*Revision{
+		{ID: "20060102150405", Author: "Andrew", SQL: "CREATE TABLE users ( id INT NOT NULL UNIQUE );"},
+		{ID: "20060102150406", Category: "perms", Author: "Andrew", SQL: "CREATE TABLE perms ( id INT NOT NULL UNIQUE );"},
+		{ID: "20060102150407", Author: "Andrew", SQL: "CREATE TABLE posts ( id INT NOT NULL UNIQUE );"},
+	}
+
+	if err := PerformRevisions(db, revs...); err != nil {
+		t.Fatal(err)
+	}
+
+	q := `UPDATE mgrt_revisions SET performed_at = 100 WHERE id = '20060102150405';
+UPDATE mgrt_revisions SET performed_at = 300 WHERE id = 'perms/20060102150406';
+UPDATE mgrt_revisions SET performed_at = 200 WHERE id = '20060102150407';`
+
+	if _, err := db.Exec(q); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err = RevisionStats(db)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stats.Total != 3 {
+		t.Errorf("unexpected total, expected=%d, got=%d\n", 3, stats.Total)
+	}
+
+	if stats.FirstPerformedAt.Unix() != 100 {
+		t.Errorf("unexpected first performed at, expected=%d, got=%d\n", 100, stats.FirstPerformedAt.Unix())
+	}
+
+	if stats.LastPerformedAt.Unix() != 300 {
+		t.Errorf("unexpected last performed at, expected=%d, got=%d\n", 300, stats.LastPerformedAt.Unix())
+	}
+
+	if stats.LastID != "perms/20060102150406" {
+		t.Errorf("unexpected last id, expected=%q, got=%q\n", "perms/20060102150406", stats.LastID)
+	}
+}
+
+func Test_GetRevisionsAsc(t *testing.T) {
+	tmp, err := ioutil.TempFile("", "mgrt-db-*")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.Remove(tmp.Name())
+
+	db, err := Open("sqlite3", tmp.Name())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	revs := []*Revision{
+		{ID: "20060102150405", Author: "Andrew", SQL: "CREATE TABLE users ( id INT NOT NULL UNIQUE );"},
+		{ID: "20060102150406", Author: "Andrew", SQL: "CREATE TABLE posts ( id INT NOT NULL UNIQUE );"},
+		{ID: "20060102150407", Author: "Andrew", SQL: "CREATE TABLE perms ( id INT NOT NULL UNIQUE );"},
+	}
+
+	if err := PerformRevisions(db, revs...); err != nil {
+		t.Fatal(err)
+	}
+
+	q := `UPDATE mgrt_revisions SET performed_at = 300 WHERE id = '20060102150405';
+UPDATE mgrt_revisions SET performed_at = 100 WHERE id = '20060102150406';
+UPDATE mgrt_revisions SET performed_at = 200 WHERE id = '20060102150407';`
+
+	if _, err := db.Exec(q); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		n        int
+		expected []string
+	}{
+		{0, []string{"20060102150406", "20060102150407", "20060102150405"}},
+		{2, []string{"20060102150406", "20060102150407"}},
+	}
+
+	for i, test := range tests {
+		revs, err := GetRevisionsAsc(db, test.n)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(revs) != len(test.expected) {
+			t.Fatalf("tests[%d] - unexpected revision count, expected=%d, got=%d\n", i, len(test.expected), len(revs))
+		}
+
+		for j, rev := range revs {
+			if rev.ID != test.expected[j] {
+				t.Errorf("tests[%d] - revs[%d] - unexpected id, expected=%q, got=%q\n", i, j, test.expected[j], rev.ID)
+			}
+		}
+	}
+
+	// GetRevisions should order by when the revisions were performed too,
+	// rather than by their IDs.
+	desc, err := GetRevisions(db, 0)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"20060102150405", "20060102150407", "20060102150406"}
+
+	if len(desc) != len(expected) {
+		t.Fatalf("unexpected revision count, expected=%d, got=%d\n", len(expected), len(desc))
+	}
+
+	for i, rev := range desc {
+		if rev.ID != expected[i] {
+			t.Errorf("desc[%d] - unexpected id, expected=%q, got=%q\n", i, expected[i], rev.ID)
+		}
+	}
+}
+
+func Test_GetRevisionsByAuthor(t *testing.T) {
+	tmp, err := ioutil.TempFile("", "mgrt-db-*")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.Remove(tmp.Name())
+
+	db, err := Open("sqlite3", tmp.Name())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	revs := []*Revision{
+		{ID: "20060102150405", Author: "Andrew <me@andrewpillar.com>", SQL: "CREATE TABLE users ( id INT NOT NULL UNIQUE );"},
+		{ID: "20060102150406", Author: "Ben <ben@example.com>", SQL: "CREATE TABLE posts ( id INT NOT NULL UNIQUE );"},
+		{ID: "20060102150407", Author: "Andrew <me@andrewpillar.com>", SQL: "CREATE TABLE perms ( id INT NOT NULL UNIQUE );"},
+	}
+
+	if err := PerformRevisions(db, revs...); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		author   string
+		n        int
+		expected []string
+	}{
+		{"Andrew <me@andrewpillar.com>", 0, []string{"20060102150407", "20060102150405"}},
+		{"Andrew <me@andrewpillar.com>", 1, []string{"20060102150407"}},
+		{"Ben <ben@example.com>", 0, []string{"20060102150406"}},
+		{"Andrew", 0, []string{}},
+	}
+
+	for i, test := range tests {
+		revs, err := GetRevisionsByAuthor(db, test.author, test.n)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(revs) != len(test.expected) {
+			t.Fatalf("tests[%d] - unexpected revision count, expected=%d, got=%d\n", i, len(test.expected), len(revs))
+		}
+
+		for j, rev := range revs {
+			if rev.ID != test.expected[j] {
+				t.Errorf("tests[%d] - revs[%d] - unexpected id, expected=%q, got=%q\n", i, j, test.expected[j], rev.ID)
+			}
+		}
+	}
+}
+
+func Test_EnsureRevisions(t *testing.T) {
+	tmp, err := ioutil.TempFile("", "mgrt-db-*")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.Remove(tmp.Name())
+
+	db, err := Open("sqlite3", tmp.Name())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	revs := []*Revision{
+		{ID: "20060102150405", Author: "Andrew", SQL: "CREATE TABLE users ( id INT NOT NULL UNIQUE );"},
+		{ID: "20060102150406", Author: "Andrew", SQL: "CREATE TABLE posts ( id INT NOT NULL UNIQUE );"},
+	}
+
+	if err := PerformRevisions(db, revs[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := EnsureRevisions(db, revs...); err != nil {
+			t.Fatalf("unexpected error on EnsureRevisions %q\n", err)
+		}
+	}
+
+	if _, err := GetRevision(db, revs[1].ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := PerformRevisions(db, revs...); !IsAllPerformed(err) {
+		t.Fatalf("unexpected error, expected all performed, got=%q\n", err)
+	}
+
+	rev := &Revision{ID: "20060102150407", Author: "Andrew", SQL: "ALTER TABLE nonexistent ADD COLUMN id INT;"}
+
+	if err := EnsureRevisions(db, append(revs, rev)...); err == nil {
+		t.Fatal("expected error for revision against nonexistent table")
+	}
+}
+
+func Test_PerformRevisionsCategory(t *testing.T) {
+	tmp, err := ioutil.TempFile("", "mgrt-db-*")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.Remove(tmp.Name())
+
+	db, err := Open("sqlite3", tmp.Name())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	revs := []*Revision{
+		{ID: "20060102150405", Author: "Andrew", SQL: "CREATE TABLE users ( id INT NOT NULL UNIQUE );"},
+		{ID: "20060102150406", Category: "seed", Author: "Andrew", SQL: "INSERT INTO users VALUES (1);"},
+		{ID: "20060102150407", Author: "Andrew", SQL: "CREATE TABLE posts ( id INT NOT NULL UNIQUE );"},
+	}
+
+	if err := PerformRevisionsCategory(db, "", revs...); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		id  string
+		err error
+	}{
+		{"20060102150405", nil},
+		{"seed/20060102150406", ErrNotFound},
+		{"20060102150407", nil},
+	}
+
+	for i, test := range tests {
+		if _, err := GetRevision(db, test.id); !errors.Is(err, test.err) {
+			t.Errorf("tests[%d] - unexpected error, expected=%v, got=%v\n", i, test.err, err)
+		}
+	}
+
+	if err := PerformRevisionsCategory(db, "seed", revs...); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := GetRevision(db, "seed/20060102150406"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_RevisionPerformedParameterized(t *testing.T) {
+	tmp, err := ioutil.TempFile("", "mgrt-db-*")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.Remove(tmp.Name())
+
+	db, err := Open("sqlite3", tmp.Name())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	// The ID is validated, but the category is not, so this is what would
+	// reach the query if it were not parameterized.
+	rev := &Revision{
+		ID:       "20060102150405",
+		Category: "1); DROP TABLE mgrt_revisions; --",
+	}
+
+	if err := RevisionPerformed(db, rev); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := GetRevisions(db, 0); err != nil {
+		t.Fatalf("unexpected error after RevisionPerformed %q\n", err)
+	}
+}
+
+func Test_BackfillHashes(t *testing.T) {
+	tmp, err := ioutil.TempFile("", "mgrt-db-*")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.Remove(tmp.Name())
+
+	db, err := Open("sqlite3", tmp.Name())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	revs := []*Revision{
+		{ID: "20060102150405", Author: "Andrew", SQL: "CREATE TABLE users ( id INT NOT NULL UNIQUE );"},
+		{ID: "20060102150406", Author: "Andrew", SQL: "CREATE TABLE posts ( id INT NOT NULL UNIQUE );"},
+		{ID: "20060102150407", Author: "Andrew", SQL: "CREATE TABLE tags ( id INT NOT NULL UNIQUE );"},
+	}
+
+	if err := PerformRevisions(db, revs...); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.Exec("UPDATE mgrt_revisions SET hash = NULL WHERE id <> '20060102150405'"); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := BackfillHashes(db)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 2 {
+		t.Fatalf("unexpected backfilled count, expected=%d, got=%d\n", 2, n)
+	}
+
+	for _, rev := range revs {
+		performed, err := GetRevision(db, rev.ID)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if performed.Hash != rev.genHash() {
+			t.Fatalf("unexpected revision hash for %s, expected=%q, got=%q\n", rev.ID, rev.genHash(), performed.Hash)
+		}
+	}
+
+	n, err = BackfillHashes(db)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 0 {
+		t.Fatalf("unexpected backfilled count, expected=%d, got=%d\n", 0, n)
+	}
+}
+
+func Test_RevisionPerformedAt(t *testing.T) {
+	tmp, err := ioutil.TempFile("", "mgrt-db-*")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.Remove(tmp.Name())
+
+	db, err := Open("sqlite3", tmp.Name())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	performedAt := time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)
+
+	setNow(t, performedAt)
+
+	rev := NewRevision("Andrew", "Add users table")
+	rev.SQL = "CREATE TABLE users ( id INT NOT NULL UNIQUE );"
+
+	if err := rev.Perform(db); err != nil {
+		t.Fatal(err)
+	}
+
+	performed, err := GetRevision(db, "20060102150405")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !performed.PerformedAt.Equal(performedAt) {
+		t.Errorf("unexpected performed at, expected=%q, got=%q\n", performedAt, performed.PerformedAt)
+	}
+}
+
+func Test_RevisionDuration(t *testing.T) {
+	tmp, err := ioutil.TempFile("", "mgrt-db-*")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.Remove(tmp.Name())
+
+	db, err := Open("sqlite3", tmp.Name())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	rev := &Revision{ID: "20060102150405", Author: "Andrew", SQL: "CREATE TABLE users ( id INT NOT NULL UNIQUE );"}
+
+	if err := rev.Perform(db); err != nil {
+		t.Fatal(err)
+	}
+
+	var durationMs sql.NullInt64
+
+	if err := db.QueryRow("SELECT duration_ms FROM mgrt_revisions WHERE (id = ?)", rev.ID).Scan(&durationMs); err != nil {
+		t.Fatal(err)
+	}
+
+	if !durationMs.Valid {
+		t.Fatal("expected revision duration to be recorded")
+	}
+
+	if _, err := db.Exec("UPDATE mgrt_revisions SET duration_ms = 1200"); err != nil {
+		t.Fatal(err)
+	}
+
+	revs, err := GetRevisions(db, -1)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if revs[0].Duration != 1200*time.Millisecond {
+		t.Fatalf("unexpected revision duration, expected=%s, got=%s\n", 1200*time.Millisecond, revs[0].Duration)
+	}
+}
+
+func Test_OrphanedRevisions(t *testing.T) {
+	tmp, err := ioutil.TempFile("", "mgrt-db-*")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.Remove(tmp.Name())
+
+	db, err := Open("sqlite3", tmp.Name())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	revs := []*Revision{
+		{ID: "20060102150405", Author: "Andrew", SQL: "SELECT 1;"},
+		{ID: "20060102150406", Author: "Andrew", SQL: "SELECT 1;"},
+		{ID: "20060102150405", Category: "perms", Author: "Andrew", SQL: "SELECT 1;"},
+	}
+
+	if err := PerformRevisions(db, revs...); err != nil {
+		t.Fatal(err)
+	}
+
+	orphaned, err := OrphanedRevisions(db, []string{"20060102150405", "20060102150407"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"20060102150406", "perms/20060102150405"}
+
+	if len(orphaned) != len(expected) {
+		t.Fatalf("unexpected orphaned count, expected=%d, got=%d\n", len(expected), len(orphaned))
+	}
+
+	for i, rev := range orphaned {
+		found := false
+
+		for _, slug := range expected {
+			if rev.Slug() == slug {
+				found = true
+			}
+		}
+
+		if !found {
+			t.Errorf("orphaned[%d] - unexpected revision %s\n", i, rev.Slug())
+		}
+	}
+
+	orphaned, err = OrphanedRevisions(db, []string{"20060102150405", "20060102150407"}, IgnoreMissing(false))
+
+	errs, ok := err.(Errors)
+
+	if !ok || len(errs) != len(expected) {
+		t.Fatalf("expected %d errors, got=%v\n", len(expected), err)
+	}
+
+	for i, err := range errs {
+		if !errors.Is(err, ErrMissing) {
+			t.Errorf("errs[%d] - unexpected error, expected=%q, got=%q\n", i, ErrMissing, err)
+		}
+	}
+
+	if len(orphaned) != len(expected) {
+		t.Fatalf("unexpected orphaned count, expected=%d, got=%d\n", len(expected), len(orphaned))
+	}
+}
+
+func Test_ForgetRevision(t *testing.T) {
+	tmp, err := ioutil.TempFile("", "mgrt-db-*")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.Remove(tmp.Name())
+
+	db, err := Open("sqlite3", tmp.Name())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	revs := []*Revision{
+		{ID: "20060102150405", Author: "Andrew", SQL: "CREATE TABLE users ( id INT NOT NULL UNIQUE );"},
+		{ID: "20060102150406", Category: "posts", Author: "Andrew", SQL: "CREATE TABLE posts ( id INT NOT NULL UNIQUE );"},
+	}
+
+	if err := PerformRevisions(db, revs...); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ForgetRevision(db, revs[1].Slug()); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := GetRevision(db, revs[1].Slug()); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected forgotten revision to not be found, got=%v\n", err)
+	}
+
+	if _, err := GetRevision(db, revs[0].Slug()); err != nil {
+		t.Fatalf("expected other revision to be kept, got=%v\n", err)
+	}
+
+	if err := ForgetRevision(db, revs[1].Slug()); !errors.Is(err, ErrNotFound) {
+		t.Errorf("unexpected error, expected=%q, got=%q\n", ErrNotFound, err)
+	}
+
+	// The table was not dropped, so performing the revision again fails.
+	if err := PerformRevisions(db, revs[1]); err == nil {
+		t.Errorf("expected error performing forgotten revision whose table exists")
+	}
+}
+
+func Test_GetRevisionsByVersion(t *testing.T) {
+	tmp, err := ioutil.TempFile("", "mgrt-db-*")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.Remove(tmp.Name())
+
+	db, err := Open("sqlite3", tmp.Name())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	revs := []*Revision{
+		{ID: "20060102150405", Author: "Andrew", SQL: "CREATE TABLE users ( id INT NOT NULL UNIQUE );", Version: "v2.3.0"},
+		{ID: "20060102150406", Author: "Andrew", SQL: "CREATE TABLE posts ( id INT NOT NULL UNIQUE );"},
+		{ID: "20060102150407", Author: "Andrew", SQL: "CREATE TABLE perms ( id INT NOT NULL UNIQUE );", Version: "v2.3.0"},
+		{ID: "20060102150408", Author: "Andrew", SQL: "CREATE TABLE tags ( id INT NOT NULL UNIQUE );", Version: "v2.4.0"},
+	}
+
+	if err := PerformRevisions(db, revs...); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		version  string
+		n        int
+		expected []string
+	}{
+		{"v2.3.0", 0, []string{"20060102150407", "20060102150405"}},
+		{"v2.3.0", 1, []string{"20060102150407"}},
+		{"v2.4.0", 0, []string{"20060102150408"}},
+		{"v2.3", 0, []string{}},
+		{"", 0, []string{}},
+	}
+
+	for i, test := range tests {
+		revs, err := GetRevisionsByVersion(db, test.version, test.n)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(revs) != len(test.expected) {
+			t.Fatalf("tests[%d] - unexpected revision count, expected=%d, got=%d\n", i, len(test.expected), len(revs))
+		}
+
+		for j, rev := range revs {
+			if rev.ID != test.expected[j] {
+				t.Errorf("tests[%d] - unexpected revision at %d, expected=%q, got=%q\n", i, j, test.expected[j], rev.ID)
+			}
+
+			if rev.Version != test.version {
+				t.Errorf("tests[%d] - unexpected version at %d, expected=%q, got=%q\n", i, j, test.version, rev.Version)
+			}
+		}
+	}
+
+	rev, err := GetRevision(db, revs[1].ID)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rev.Version != "" {
+		t.Errorf("unexpected version, expected=%q, got=%q\n", "", rev.Version)
+	}
+}
+
+func Test_StatusAll(t *testing.T) {
+	local := []*Revision{
+		{ID: "20060102150405", Author: "Andrew", SQL: "SELECT 1;"},
+		{ID: "20060102150406", Author: "Andrew", SQL: "SELECT 1;"},
+	}
+
+	items := make([]DBItem, 0, 4)
+
+	for i := 0; i < 3; i++ {
+		tmp, err := ioutil.TempFile("", "mgrt-db-*")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer os.Remove(tmp.Name())
+
+		db, err := Open("sqlite3", tmp.Name())
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, rev := range local[:i] {
+			if err := rev.Perform(db); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		db.Close()
+
+		items = append(items, DBItem{
+			Name: tmp.Name(),
+			Type: "sqlite3",
+			DSN:  tmp.Name(),
+		})
+	}
+
+	items = append(items, DBItem{
+		Name: "bad",
+		Type: "unknown",
+		DSN:  "mgrt.db",
+	})
+
+	statuses, err := StatusAll(items, local, 2)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(statuses) != len(items) {
+		t.Fatalf("unexpected status count, expected=%d, got=%d\n", len(items), len(statuses))
+	}
+
+	for i, st := range statuses[:3] {
+		if st.Name != items[i].Name {
+			t.Fatalf("statuses[%d] - unexpected name, expected=%q, got=%q\n", i, items[i].Name, st.Name)
+		}
+
+		if st.Err != nil {
+			t.Fatalf("statuses[%d] - unexpected error: %s\n", i, st.Err)
+		}
+
+		if pending := len(local) - i; len(st.Pending) != pending {
+			t.Fatalf("statuses[%d] - unexpected pending count, expected=%d, got=%d\n", i, pending, len(st.Pending))
+		}
+
+		if st.Stats.Total != int64(i) {
+			t.Fatalf("statuses[%d] - unexpected total, expected=%d, got=%d\n", i, i, st.Stats.Total)
+		}
+	}
+
+	if st := statuses[3]; st.Name != "bad" || st.Err == nil {
+		t.Fatalf("expected error for database %q, got=%v\n", "bad", st.Err)
+	}
+}
+
+func Test_RevisionPerformLazy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mgrt-revisions-*")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "20060102150405.sql")
+
+	if err := ioutil.WriteFile(path, []byte("/*\nRevision: 20060102150405\nAuthor:   Andrew\n*/\n\nCREATE TABLE users ( id INT NOT NULL UNIQUE );"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	rev, err := OpenRevisionLazy(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := Open("sqlite3", filepath.Join(dir, "mgrt.db"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	if err := PerformRevisions(db, rev); err != nil {
+		t.Fatal(err)
+	}
+
+	performed, err := GetRevision(db, rev.ID)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if performed.SQL != "CREATE TABLE users ( id INT NOT NULL UNIQUE );" {
+		t.Fatalf("unexpected sql, got=%q\n", performed.SQL)
+	}
+}
+
+func Test_GetRevisionsFunc(t *testing.T) {
+	tmp, err := ioutil.TempFile("", "mgrt-db-*")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.Remove(tmp.Name())
+
+	db, err := Open("sqlite3", tmp.Name())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	revs := []*Revision{
+		{ID: "20060102150405", Author: "Andrew", SQL: "SELECT 1;"},
+		{ID: "20060102150406", Author: "Andrew", SQL: "SELECT 1;"},
+		{ID: "20060102150407", Author: "Andrew", SQL: "SELECT 1;"},
+	}
+
+	if err := PerformRevisions(db, revs...); err != nil {
+		t.Fatal(err)
+	}
+
+	ids := make([]string, 0, len(revs))
+
+	err = GetRevisionsFunc(db, func(rev *Revision) error {
+		ids = append(ids, rev.ID)
+		return nil
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"20060102150407", "20060102150406", "20060102150405"}
+
+	if strings.Join(ids, ",") != strings.Join(expected, ",") {
+		t.Fatalf("unexpected revisions, expected=%v, got=%v\n", expected, ids)
+	}
+
+	errStop := errors.New("stop")
+
+	n := 0
+
+	err = GetRevisionsFunc(db, func(rev *Revision) error {
+		n++
+		return errStop
+	})
+
+	if err != errStop {
+		t.Fatalf("unexpected error, expected=%v, got=%v\n", errStop, err)
+	}
+
+	if n != 1 {
+		t.Fatalf("expected iteration to stop after 1 revision, got=%d\n", n)
+	}
+}
+
+func Test_TestRevision(t *testing.T) {
+	db, err := Open("sqlite3", ":memory:", WithSingleConn())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	ok := &Revision{ID: "20060102150405", Author: "Andrew", SQL: "CREATE TABLE users ( id INT NOT NULL UNIQUE );"}
+
+	if err := TestRevision(db, ok); err != nil {
+		t.Fatalf("unexpected error %q\n", err)
+	}
+
+	// The revision was rolled back, and not recorded.
+	if _, err := db.Exec("SELECT * FROM users"); err == nil {
+		t.Fatalf("expected tested revision to be rolled back\n")
+	}
+
+	if err := RevisionPerformed(db, ok); err != nil {
+		t.Fatalf("expected tested revision to not be recorded, got=%q\n", err)
+	}
+
+	bad := &Revision{ID: "20060102150406", Author: "Andrew", SQL: "CREAT TABLE posts ( id INT );"}
+
+	err = TestRevision(db, bad)
+
+	var rerr *RevisionError
+
+	if !errors.As(err, &rerr) {
+		t.Fatalf("unexpected error, expected=%T, got=%T\n", rerr, err)
+	}
+
+	if rerr.ID != bad.Slug() {
+		t.Fatalf("unexpected revision id, expected=%q, got=%q\n", bad.Slug(), rerr.ID)
+	}
+
+	if !strings.Contains(rerr.Err.Error(), "syntax error") {
+		t.Fatalf("expected syntax error, got=%q\n", rerr.Err)
+	}
+}
+
+func Test_StatusAllReadOnly(t *testing.T) {
+	local := []*Revision{
+		{ID: "20060102150406", Author: "Andrew", SQL: "SELECT 1;"},
+		{ID: "20060102150405", Author: "Andrew", SQL: "SELECT 1;"},
+	}
+
+	tmp, err := ioutil.TempFile("", "mgrt-db-*")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.Remove(tmp.Name())
+
+	items := []DBItem{
+		{Name: "new", Type: "sqlite3", DSN: tmp.Name()},
+	}
+
+	statuses, err := StatusAll(items, local, 1)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	st := statuses[0]
+
+	if st.Err != nil {
+		t.Fatalf("unexpected error: %s\n", st.Err)
+	}
+
+	if len(st.Pending) != len(local) {
+		t.Fatalf("unexpected pending count, expected=%d, got=%d\n", len(local), len(st.Pending))
+	}
+
+	if st.Pending[0].ID != "20060102150405" {
+		t.Fatalf("unexpected first pending revision, expected=%q, got=%q\n", "20060102150405", st.Pending[0].ID)
+	}
+
+	db, err := OpenReadOnly("sqlite3", tmp.Name())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	if _, err := RevisionStats(db); err == nil {
+		t.Fatalf("expected mgrt_revisions table to not be created\n")
+	}
+}
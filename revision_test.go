@@ -1,13 +1,17 @@
 package mgrt
 
 import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
 	"errors"
+	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
-
-	_ "github.com/mattn/go-sqlite3"
+	"time"
 )
 
 func Test_UnmarshalRevision(t *testing.T) {
@@ -49,12 +53,175 @@ DROP TABLE users;`)
 	}
 }
 
+func Test_UnmarshalRevisionCommentMarkers(t *testing.T) {
+	sql := `/* Users are looked up by email. */
+CREATE INDEX users_email ON users (email); /* not unique */`
+
+	r := strings.NewReader(`/*
+Revision: 20060102150405
+Author:   Author <me@example.com>
+
+fix the a*/b regex
+*/
+
+` + sql)
+
+	rev, err := UnmarshalRevision(r)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rev.Comment != "fix the a*/b regex" {
+		t.Errorf("unexpected revision comment, expected=%q, got=%q\n", "fix the a*/b regex", rev.Comment)
+	}
+
+	if rev.SQL != sql {
+		t.Errorf("unexpected revision sql, expected=%q, got=%q\n", sql, rev.SQL)
+	}
+
+	rev2, err := UnmarshalRevision(strings.NewReader(rev.String()))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if *rev2 != *rev {
+		t.Errorf("unexpected revision, expected=%+v, got=%+v\n", *rev, *rev2)
+	}
+}
+
+func Test_UnmarshalRevisionTransaction(t *testing.T) {
+	tests := []struct {
+		header   string
+		expected bool
+	}{
+		{"", false},
+		{"Transaction: no\n", true},
+		{"Transaction: yes\n", false},
+	}
+
+	for i, test := range tests {
+		r := strings.NewReader("/*\nRevision: 20060102150405\nAuthor:   Andrew\n" + test.header + "\nComment\n*/\n\nSELECT 1;")
+
+		rev, err := UnmarshalRevision(r)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if rev.NoTransaction != test.expected {
+			t.Errorf("tests[%d] - unexpected no transaction, expected=%v, got=%v\n", i, test.expected, rev.NoTransaction)
+		}
+
+		if rev.Comment != "Comment" {
+			t.Errorf("tests[%d] - unexpected comment, expected=%q, got=%q\n", i, "Comment", rev.Comment)
+		}
+	}
+}
+
+func Test_UnmarshalRevisionRecord(t *testing.T) {
+	tests := []struct {
+		header   string
+		expected bool
+	}{
+		{"", false},
+		{"Record: no\n", true},
+		{"Record: yes\n", false},
+		{"Transaction: no\nRecord: no\n", true},
+	}
+
+	for i, test := range tests {
+		r := strings.NewReader("/*\nRevision: 20060102150405\nAuthor:   Andrew\n" + test.header + "\nComment\n*/\n\nREFRESH MATERIALIZED VIEW totals;")
+
+		rev, err := UnmarshalRevision(r)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if rev.NoRecord != test.expected {
+			t.Errorf("tests[%d] - unexpected no record, expected=%v, got=%v\n", i, test.expected, rev.NoRecord)
+		}
+
+		if rev.Comment != "Comment" {
+			t.Errorf("tests[%d] - unexpected comment, expected=%q, got=%q\n", i, "Comment", rev.Comment)
+		}
+
+		var buf bytes.Buffer
+
+		if _, err := rev.WriteTo(&buf); err != nil {
+			t.Fatal(err)
+		}
+
+		written, err := UnmarshalRevision(&buf)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if written.NoRecord != rev.NoRecord {
+			t.Errorf("tests[%d] - no record not written, expected=%v, got=%v\n", i, rev.NoRecord, written.NoRecord)
+		}
+	}
+}
+
+func Test_UnmarshalRevisionVersion(t *testing.T) {
+	tests := []struct {
+		header   string
+		expected string
+	}{
+		{"", ""},
+		{"Version:  v2.3.0\n", "v2.3.0"},
+		{"Version:v2.3.0-rc.1  \n", "v2.3.0-rc.1"},
+	}
+
+	for i, test := range tests {
+		r := strings.NewReader("/*\nRevision: 20060102150405\nAuthor:   Andrew\n" + test.header + "\nComment\n*/\n\nSELECT 1;")
+
+		rev, err := UnmarshalRevision(r)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if rev.Version != test.expected {
+			t.Errorf("tests[%d] - unexpected version, expected=%q, got=%q\n", i, test.expected, rev.Version)
+		}
+
+		if rev.Comment != "Comment" {
+			t.Errorf("tests[%d] - unexpected comment, expected=%q, got=%q\n", i, "Comment", rev.Comment)
+		}
+	}
+}
+
+// setNow replaces the clock used by the package with one that always returns
+// the given time, until the end of the test.
+func setNow(t *testing.T, tm time.Time) {
+	now = func() time.Time { return tm }
+	t.Cleanup(func() { now = time.Now })
+}
+
+func Test_NewRevision(t *testing.T) {
+	setNow(t, time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC))
+
+	rev := NewRevision("Andrew", "Add users table")
+
+	if rev.ID != "20060102150405" {
+		t.Errorf("unexpected revision id, expected=%q, got=%q\n", "20060102150405", rev.ID)
+	}
+}
+
 func Test_RevisionTitle(t *testing.T) {
 	singleLineComment := "A title that is longer than 72 characters in length this should be trimmed with an ellipsis."
 	multiLineComment := `A comment that will have multiple lines and a long title line
 
 This is the body of the comment.`
 	shortComment := "A simple comment that is shorter thant 72 characters in length"
+	cjkComment := strings.Repeat("迁移", 40)
+	shortMultiLineComment := "add index\n\nlong explanation of why the index is needed"
+	exactMultiLineComment := strings.Repeat("a", 72) + "\n\nThis is the body of the comment."
+	emojiComment := strings.Repeat("🚀", 71) + "é"
 
 	tests := []struct {
 		comment  string
@@ -72,6 +239,22 @@ This is the body of the comment.`
 			comment:  shortComment,
 			expected: shortComment,
 		},
+		{
+			comment:  cjkComment,
+			expected: strings.Repeat("迁移", 36) + "...",
+		},
+		{
+			comment:  emojiComment,
+			expected: emojiComment,
+		},
+		{
+			comment:  shortMultiLineComment,
+			expected: "add index",
+		},
+		{
+			comment:  exactMultiLineComment,
+			expected: strings.Repeat("a", 72),
+		},
 	}
 
 	for i, test := range tests {
@@ -83,76 +266,234 @@ This is the body of the comment.`
 	}
 }
 
-func Test_RevisionPerformMultiple(t *testing.T) {
-	tmp, err := ioutil.TempFile("", "mgrt-db-*")
+func Test_Squash(t *testing.T) {
+	revs := []*Revision{
+		{ID: "20060102150407", Author: "Andrew", Comment: "Add password to users table", SQL: "ALTER TABLE users ADD COLUMN password VARCHAR NOT NULL;"},
+		{ID: "20060102150405", Author: "Andrew", Comment: "Add users table", SQL: "CREATE TABLE users ( id INT NOT NULL UNIQUE );"},
+		{ID: "20060102150406", Author: "Pillar", Comment: "Add username to users table", SQL: "ALTER TABLE users ADD COLUMN username VARCHAR NOT NULL;"},
+		{ID: "20060102150406", Category: "perms", Author: "Andrew", Comment: "Grant users", SQL: "GRANT SELECT ON users TO app;"},
+		{ID: "20060102150408", Author: "Andrew", Comment: "Add posts table", SQL: "CREATE TABLE posts ( id INT NOT NULL UNIQUE );"},
+	}
+
+	rev, err := Squash(revs, "20060102150405", "20060102150407")
 
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	defer os.Remove(tmp.Name())
+	if rev.ID != "20060102150407" {
+		t.Errorf("unexpected revision id, expected=%q, got=%q\n", "20060102150407", rev.ID)
+	}
+
+	if rev.Author != "Andrew, Pillar" {
+		t.Errorf("unexpected revision author, expected=%q, got=%q\n", "Andrew, Pillar", rev.Author)
+	}
+
+	// The revision between from and to should be squashed too, and the
+	// revision in the perms category should not be.
+	expected := `Squash of the following revisions:
+
+20060102150405: Add users table
+20060102150406: Add username to users table
+20060102150407: Add password to users table`
+
+	if rev.Comment != expected {
+		t.Errorf("unexpected revision comment, expected=%q, got=%q\n", expected, rev.Comment)
+	}
 
-	db, err := Open("sqlite3", tmp.Name())
+	expected = `CREATE TABLE users ( id INT NOT NULL UNIQUE );
+
+ALTER TABLE users ADD COLUMN username VARCHAR NOT NULL;
+
+ALTER TABLE users ADD COLUMN password VARCHAR NOT NULL;`
+
+	if rev.SQL != expected {
+		t.Errorf("unexpected revision sql, expected=%q, got=%q\n", expected, rev.SQL)
+	}
+
+	errtests := []struct {
+		from string
+		to   string
+	}{
+		{"20060102150405", "20060102150409"},
+		{"20060102150404", "20060102150407"},
+		{"20060102150405", "perms/20060102150406"},
+		{"20060102150407", "20060102150405"},
+	}
+
+	for i, test := range errtests {
+		if _, err := Squash(revs, test.from, test.to); err == nil {
+			t.Errorf("errtests[%d] - expected error for squash of %s to %s\n", i, test.from, test.to)
+		}
+	}
+
+	if _, err := Squash(revs, "20060102150405", "20060102150409"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("unexpected error, expected=%q, got=%q\n", ErrNotFound, err)
+	}
+
+	revs[0].ID = revs[1].ID
+
+	if _, err := Squash(revs, "20060102150405", "20060102150406"); !errors.Is(err, ErrDuplicate) {
+		t.Errorf("unexpected error, expected=%q, got=%q\n", ErrDuplicate, err)
+	}
+}
+
+func Test_UnmarshalRevisions(t *testing.T) {
+	r := strings.NewReader(`/*
+Revision: 20060102150405
+Author:   Andrew
+
+Add users table
+*/
+
+CREATE TABLE users (
+	id INT NOT NULL UNIQUE
+);
+/*
+Revision: 20060102150406
+Author:   Andrew
+
+Add username to users table
+*/
+
+ALTER TABLE users ADD COLUMN username VARCHAR NOT NULL;/* Revision: perms/20060102150407
+Author:   Andrew */
+
+GRANT SELECT ON users TO app;
+`)
+
+	revs, err := UnmarshalRevisions(r)
 
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	defer db.Close()
-
 	tests := []struct {
-		id      string
-		author  string
-		comment string
-		sql     string
+		slug string
+		sql  string
 	}{
-		{
-			"20060102150407",
-			"Andrew",
-			"Add password to users table",
-			"ALTER TABLE users ADD COLUMN password VARCHAR NOT NULL;",
-		},
-		{
-			"20060102150405",
-			"Andrew",
-			"Add users table",
-			"CREATE TABLE users ( id INT NOT NULL UNIQUE );",
-		},
-		{
-			"20060102150406",
-			"Andrew",
-			"Add username to users table",
-			"ALTER TABLE users ADD COLUMN username VARCHAR NOT NULL;",
-		},
+		{"20060102150405", "CREATE TABLE users (\n\tid INT NOT NULL UNIQUE\n);"},
+		{"20060102150406", "ALTER TABLE users ADD COLUMN username VARCHAR NOT NULL;"},
+		{"perms/20060102150407", "GRANT SELECT ON users TO app;"},
 	}
 
-	revs := make([]*Revision, 0, len(tests))
+	if len(revs) != len(tests) {
+		t.Fatalf("unexpected revision count, expected=%d, got=%d\n", len(tests), len(revs))
+	}
+
+	for i, test := range tests {
+		if slug := revs[i].Slug(); slug != test.slug {
+			t.Errorf("revs[%d] - unexpected slug, expected=%q, got=%q\n", i, test.slug, slug)
+		}
+
+		if revs[i].SQL != test.sql {
+			t.Errorf("revs[%d] - unexpected sql, expected=%q, got=%q\n", i, test.sql, revs[i].SQL)
+		}
+	}
+}
+
+func Test_UnmarshalRevisionsInvalid(t *testing.T) {
+	tests := []string{
+		`/*
+Revision: 20060102150405
+Author:   Andrew
+*/
+
+CREATE TABLE users ( id INT NOT NULL UNIQUE );
+
+/*
+Author:   Andrew
+
+No revision ID
+*/
+
+DROP TABLE users;`,
+		`CREATE TABLE users ( id INT NOT NULL UNIQUE );
 
-	for _, test := range tests {
-		rev := NewRevision(test.author, test.comment)
-		rev.ID = test.id
-		rev.SQL = test.sql
+/*
+Revision: 20060102150405
+Author:   Andrew
+*/
 
-		revs = append(revs, rev)
+DROP TABLE users;`,
 	}
 
-	if err := PerformRevisions(db, revs...); err != nil {
+	for i, test := range tests {
+		if _, err := UnmarshalRevisions(strings.NewReader(test)); !errors.Is(err, ErrInvalid) {
+			t.Errorf("tests[%d] - unexpected error, expected=%q, got=%q\n", i, ErrInvalid, err)
+		}
+	}
+
+	revs, err := UnmarshalRevisions(strings.NewReader("\n\n"))
+
+	if err != nil {
 		t.Fatal(err)
 	}
 
-	_, err = GetRevision(db, "foo")
+	if len(revs) != 0 {
+		t.Fatalf("unexpected revision count, expected=%d, got=%d\n", 0, len(revs))
+	}
+}
 
-	if !errors.Is(err, ErrNotFound) {
-		t.Fatalf("unexpected error, expected=%T, got=%T\n", ErrNotFound, err)
+func Test_RevisionWriteTo(t *testing.T) {
+	revs := []*Revision{
+		{ID: "20060102150405", Author: "Andrew", Comment: "Add users table", SQL: "CREATE TABLE users ( id INT NOT NULL UNIQUE );"},
+		{ID: "20060102150406", Category: "perms", Author: "Andrew", SQL: "GRANT SELECT ON users TO app;"},
 	}
 
-	if _, err = GetRevision(db, "20060102150406"); err != nil {
-		t.Fatal(err)
+	for i, rev := range revs {
+		var buf strings.Builder
+
+		n, err := rev.WriteTo(&buf)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if s := rev.String(); buf.String() != s {
+			t.Errorf("revs[%d] - unexpected output, expected=%q, got=%q\n", i, s, buf.String())
+		}
+
+		if n != int64(buf.Len()) {
+			t.Errorf("revs[%d] - unexpected byte count, expected=%d, got=%d\n", i, buf.Len(), n)
+		}
+	}
+}
+
+func Test_RevisionRoundTrip(t *testing.T) {
+	revs := []*Revision{
+		{ID: "20060102150405", Author: "Andrew", Comment: "Add users table", SQL: "CREATE TABLE users ( id INT NOT NULL UNIQUE );"},
+		{ID: "20060102150406", Category: "perms", Author: "Andrew", SQL: "GRANT SELECT ON users TO app;"},
+		{ID: "20060102150407", Author: "Andrew", Comment: "Add posts table\n\nNote: this is for the blog", SQL: "CREATE TABLE posts (\n\tid INT NOT NULL UNIQUE\n);"},
+		{ID: "20060102150408", Author: "Andrew", Comment: "Index users by email", SQL: "CREATE INDEX CONCURRENTLY users_email ON users (email);", NoTransaction: true},
+		{ID: "20060102150409", Author: "Andrew", Comment: "Add tags table", SQL: "CREATE TABLE tags ( id INT NOT NULL UNIQUE );", Version: "v2.3.0", NoTransaction: true},
+	}
+
+	for i, rev := range revs {
+		var buf bytes.Buffer
+
+		if err := MarshalRevision(&buf, rev); err != nil {
+			t.Fatal(err)
+		}
+
+		if s := rev.String(); buf.String() != s {
+			t.Errorf("revs[%d] - unexpected output, expected=%q, got=%q\n", i, s, buf.String())
+		}
+
+		rev2, err := UnmarshalRevision(&buf)
+
+		if err != nil {
+			t.Fatalf("revs[%d] - %s\n", i, err)
+		}
+
+		if *rev2 != *rev {
+			t.Errorf("revs[%d] - unexpected revision, expected=%+v, got=%+v\n", i, *rev, *rev2)
+		}
 	}
 }
 
-func Test_RevisionPerform(t *testing.T) {
-	tmp, err := ioutil.TempFile("", "mgrt-db-*")
+func Test_RevisionErrorInvalid(t *testing.T) {
+	tmp, err := ioutil.TempFile("", "mgrt-revision-*.sql")
 
 	if err != nil {
 		t.Fatal(err)
@@ -160,69 +501,519 @@ func Test_RevisionPerform(t *testing.T) {
 
 	defer os.Remove(tmp.Name())
 
-	db, err := Open("sqlite3", tmp.Name())
+	tmp.WriteString(`/*
+Revision: 2006-01-02
+Author:   Andrew
+*/
+
+DROP TABLE users;`)
+	tmp.Close()
+
+	_, err = OpenRevision(tmp.Name())
+
+	if !errors.Is(err, ErrInvalid) {
+		t.Fatalf("unexpected error, expected=%q, got=%q\n", ErrInvalid, err)
+	}
+
+	var rerr *RevisionError
+
+	if !errors.As(err, &rerr) {
+		t.Fatalf("unexpected error type, expected=%T, got=%T\n", rerr, err)
+	}
+
+	if rerr.ID != "2006-01-02" {
+		t.Errorf("unexpected error id, expected=%q, got=%q\n", "2006-01-02", rerr.ID)
+	}
+
+	if rerr.Path != tmp.Name() {
+		t.Errorf("unexpected error path, expected=%q, got=%q\n", tmp.Name(), rerr.Path)
+	}
+
+	var c Collection
+
+	err = c.Put(&Revision{ID: "foo"})
+
+	if !errors.As(err, &rerr) || rerr.ID != "foo" || !errors.Is(err, ErrInvalid) {
+		t.Errorf("unexpected error, expected=%q, got=%q\n", "revision error foo: revision id invalid", err)
+	}
+}
+
+func Test_CollectionPutDuplicate(t *testing.T) {
+	var c Collection
+
+	revs := []*Revision{
+		{ID: "20060102150405"},
+		{ID: "20060102150406"},
+		{ID: "20060102150405", Category: "perms"},
+	}
+
+	for _, rev := range revs {
+		if err := c.Put(rev); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, id := range []string{"20060102150405", "20060102150406", "perms/20060102150405"} {
+		if !c.Has(id) {
+			t.Errorf("expected collection to have revision %s\n", id)
+		}
+	}
+
+	for _, id := range []string{"20060102150407", "perms/20060102150406", "foo"} {
+		if c.Has(id) {
+			t.Errorf("expected collection to not have revision %s\n", id)
+		}
+	}
+
+	err := c.Put(&Revision{ID: "20060102150405", Category: "perms"})
+
+	var rerr *RevisionError
+
+	if !errors.As(err, &rerr) || rerr.ID != "perms/20060102150405" || !errors.Is(err, ErrDuplicate) {
+		t.Errorf("unexpected error, expected=%q, got=%q\n", "revision error perms/20060102150405: duplicate revision", err)
+	}
+
+	if c.Len() != len(revs) {
+		t.Errorf("unexpected collection length, expected=%d, got=%d\n", len(revs), c.Len())
+	}
+}
+
+func Test_CollectionGet(t *testing.T) {
+	var c Collection
+
+	revs := []*Revision{
+		{ID: "20060102150407", Comment: "Add posts table"},
+		{ID: "20060102150405", Comment: "Add users table"},
+		{ID: "20060102150406", Comment: "Add tags table"},
+		{ID: "20060102150405", Category: "perms", Comment: "Grant users"},
+		{ID: "20060102150408", Category: "perms", Comment: "Grant posts"},
+	}
+
+	for _, rev := range revs {
+		if err := c.Put(rev); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i, rev := range revs {
+		got, ok := c.Get(rev.Slug())
+
+		if !ok {
+			t.Fatalf("revs[%d] - expected to get revision %s\n", i, rev.Slug())
+		}
+
+		if got != rev {
+			t.Fatalf("revs[%d] - unexpected revision, expected=%q, got=%q\n", i, rev.Comment, got.Comment)
+		}
+	}
+
+	for _, id := range []string{"20060102150408", "perms/20060102150406", "", "foo", "perms/", "2006-01-02"} {
+		if rev, ok := c.Get(id); ok || rev != nil {
+			t.Errorf("expected no revision for %q, got=%v\n", id, rev)
+		}
+	}
+}
+
+func Test_CollectionMaxSkew(t *testing.T) {
+	nextYear := &Revision{ID: time.Now().AddDate(1, 0, 0).Format(revisionIdFormat)}
+	current := &Revision{ID: time.Now().Add(time.Minute).Format(revisionIdFormat)}
+
+	var c Collection
+
+	if err := c.Put(nextYear); err != nil {
+		t.Fatalf("unexpected error without MaxSkew %q\n", err)
+	}
+
+	c = Collection{MaxSkew: time.Hour}
+
+	if err := c.Put(current); err != nil {
+		t.Fatalf("unexpected error within MaxSkew %q\n", err)
+	}
+
+	err := c.Put(nextYear)
+
+	var rerr *RevisionError
+
+	if !errors.As(err, &rerr) || !errors.Is(err, ErrFuture) {
+		t.Fatalf("unexpected error, expected=%q, got=%q\n", ErrFuture, err)
+	}
+
+	if rerr.ID != nextYear.ID {
+		t.Fatalf("unexpected revision id, expected=%q, got=%q\n", nextYear.ID, rerr.ID)
+	}
+
+	if c.Len() != 1 {
+		t.Fatalf("unexpected collection length, expected=1, got=%d\n", c.Len())
+	}
+}
+
+func Test_RevisionValidate(t *testing.T) {
+	tests := []struct {
+		rev    *Revision
+		substr string
+	}{
+		{&Revision{ID: "20060102150405", Author: "Andrew", SQL: "SELECT 1;"}, ""},
+		{&Revision{ID: "2006-01-02", Author: "Andrew", SQL: "SELECT 1;"}, "id"},
+		{&Revision{ID: "20060102150405", SQL: "SELECT 1;"}, "author"},
+		{&Revision{ID: "20060102150405", Author: "Andrew", SQL: "\n"}, "sql"},
+	}
+
+	for i, test := range tests {
+		err := test.rev.Validate()
+
+		if test.substr == "" {
+			if err != nil {
+				t.Errorf("tests[%d] - unexpected error %q\n", i, err)
+			}
+			continue
+		}
+
+		var rerr *RevisionError
+
+		if !errors.As(err, &rerr) || !strings.Contains(err.Error(), test.substr) {
+			t.Errorf("tests[%d] - expected error naming %s, got=%q\n", i, test.substr, err)
+		}
+	}
+}
+
+func Test_RevisionEqual(t *testing.T) {
+	rev := &Revision{
+		ID:      "20060102150405",
+		Author:  "Andrew",
+		Comment: "Create users table",
+		SQL:     "CREATE TABLE users ( id INT );",
+	}
+
+	tests := []struct {
+		other    *Revision
+		expected bool
+	}{
+		{&Revision{ID: "20060102150405", Author: "Andrew", Comment: "Create users table", SQL: "CREATE TABLE users ( id INT );"}, true},
+		{&Revision{ID: "20060102150405", Author: "Andrew", Comment: "Create users table\n", SQL: "\nCREATE TABLE users ( id INT );\n\n", PerformedAt: time.Now()}, true},
+		{&Revision{ID: "20060102150406", Author: "Andrew", Comment: "Create users table", SQL: "CREATE TABLE users ( id INT );"}, false},
+		{&Revision{ID: "20060102150405", Category: "users", Author: "Andrew", Comment: "Create users table", SQL: "CREATE TABLE users ( id INT );"}, false},
+		{&Revision{ID: "20060102150405", Author: "andrew", Comment: "Create users table", SQL: "CREATE TABLE users ( id INT );"}, false},
+		{&Revision{ID: "20060102150405", Author: "Andrew", Comment: "Create the users table", SQL: "CREATE TABLE users ( id INT );"}, false},
+		{&Revision{ID: "20060102150405", Author: "Andrew", Comment: "Create users table", SQL: "CREATE TABLE users ( id BIGINT );"}, false},
+		{nil, false},
+	}
+
+	for i, test := range tests {
+		if eq := rev.Equal(test.other); eq != test.expected {
+			t.Errorf("tests[%d] - unexpected Equal, expected=%v, got=%v\n", i, test.expected, eq)
+		}
+	}
+}
+
+func Test_NormalizeSQL(t *testing.T) {
+	tests := []struct {
+		sql      string
+		expected string
+	}{
+		{"SELECT 1;", "SELECT 1;"},
+		{"CREATE TABLE users (\r\n    id INT  \r\n);\r\n", "CREATE TABLE users ( id INT );"},
+		{"\n\tSELECT\t1;\n\nSELECT 2;   \n", "SELECT 1; SELECT 2;"},
+		{"SELECT 'a  b';", "SELECT 'a b';"},
+	}
+
+	for i, test := range tests {
+		if sql := NormalizeSQL(test.sql); sql != test.expected {
+			t.Errorf("tests[%d] - unexpected sql, expected=%q, got=%q\n", i, test.expected, sql)
+		}
+	}
+
+	a := &Revision{ID: "20060102150405", Author: "Andrew", SQL: "CREATE TABLE users ( id INT );"}
+	b := &Revision{ID: "20060102150405", Author: "Andrew", SQL: "CREATE TABLE users (\r\n\tid INT\r\n);"}
+
+	if a.Equal(b) {
+		t.Fatal("expected reformatted revisions to not be equal")
+	}
+
+	if !a.EqualNormalized(b) {
+		t.Fatal("expected reformatted revisions to be equal once normalized")
+	}
+}
+
+func Test_IsAllPerformed(t *testing.T) {
+	performed := &RevisionError{ID: "20060102150405", Err: ErrPerformed}
+
+	tests := []struct {
+		err      error
+		expected bool
+	}{
+		{nil, false},
+		{performed, true},
+		{Errors{}, false},
+		{Errors{performed, performed}, true},
+		{Errors{performed, &RevisionError{ID: "20060102150406", Err: ErrChanged}}, false},
+		{Errors{performed, ErrNoPending}, true},
+		{Errors{ErrNoPending, &RevisionError{ID: "20060102150406", Err: ErrChanged}}, false},
+		{ErrInvalid, false},
+	}
+
+	for i, test := range tests {
+		if res := IsAllPerformed(test.err); res != test.expected {
+			t.Errorf("tests[%d] - unexpected result, expected=%v, got=%v\n", i, test.expected, res)
+		}
+	}
+}
+
+func Test_RevisionJSON(t *testing.T) {
+	revs := []*Revision{
+		{ID: "20060102150405", Author: "Andrew", Comment: "Add users table", SQL: "CREATE TABLE users ( id INT NOT NULL UNIQUE );"},
+		{
+			ID:          "20060102150406",
+			Category:    "perms",
+			Author:      "Andrew",
+			SQL:         "GRANT SELECT ON users TO app;",
+			PerformedAt: time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC),
+			Hash:        "b5bb9d8014a0f9b1d61e21e796d78dccdf1352f23cd32812f4850b878ae4944c",
+			PerformedBy: "andrew@workstation",
+			Duration:    1200 * time.Millisecond,
+		},
+	}
+
+	for i, rev := range revs {
+		b, err := json.Marshal(rev)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var rev2 Revision
+
+		if err := json.Unmarshal(b, &rev2); err != nil {
+			t.Fatal(err)
+		}
+
+		if !rev2.PerformedAt.Equal(rev.PerformedAt) {
+			t.Errorf("revs[%d] - unexpected performed at, expected=%s, got=%s\n", i, rev.PerformedAt, rev2.PerformedAt)
+		}
+
+		rev2.PerformedAt = rev.PerformedAt
+
+		if rev2 != *rev {
+			t.Errorf("revs[%d] - unexpected revision, expected=%+v, got=%+v\n", i, *rev, rev2)
+		}
+	}
+
+	b, err := json.Marshal(revs[1])
 
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	defer db.Close()
+	expected := `{"id":"20060102150406","category":"perms","author":"Andrew","comment":"","sql":"GRANT SELECT ON users TO app;","performed_at":"2006-01-02T15:04:05Z","hash":"b5bb9d8014a0f9b1d61e21e796d78dccdf1352f23cd32812f4850b878ae4944c","performed_by":"andrew@workstation","duration_ms":1200}`
+
+	if string(b) != expected {
+		t.Errorf("unexpected json, expected=%s, got=%s\n", expected, string(b))
+	}
+}
+
+func Test_ImportSQLFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mgrt-import-*")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	mtime := time.Date(2006, 1, 2, 15, 4, 5, 0, time.Local)
 
 	tests := []struct {
+		name    string
 		id      string
-		repeat  bool
-		author  string
 		comment string
-		sql     string
 	}{
-		{
-			"20060102150405",
-			true,
-			"Andrew",
-			"Add users table",
-			"CREATE TABLE users ( id INT NOT NULL UNIQUE );",
-		},
-		{
-			"20060102150406",
-			false,
-			"Andrew",
-			"Add username to users table",
-			"ALTER TABLE users ADD COLUMN username VARCHAR NOT NULL;",
-		},
-		{
-			"20060102150407",
-			false,
-			"Andrew",
-			"Add password to users table",
-			"ALTER TABLE users ADD COLUMN password VARCHAR NOT NULL;",
-		},
+		{"20210304050607_create_users.sql", "20210304050607", "create users"},
+		{"001_create-posts.sql", "20060102150405", "create posts"},
+		{"seed.sql", "20060102150405", "seed"},
+		{"002.sql", "20060102150405", ""},
 	}
 
 	for i, test := range tests {
-		rev := NewRevision(test.author, test.comment)
-		rev.ID = test.id
-		rev.SQL = test.sql
+		path := filepath.Join(dir, test.name)
 
-		if err := rev.Perform(db); err != nil {
-			t.Fatalf("tests[%d] - unexpected error %T %q\n", i, err, err)
+		if err := ioutil.WriteFile(path, []byte("\nCREATE TABLE users ( id INT );\n"), os.FileMode(0644)); err != nil {
+			t.Fatal(err)
 		}
 
-		if test.repeat {
-			if err := rev.Perform(db); err != nil {
-				if !errors.Is(err, ErrPerformed) {
-					t.Fatalf("tests[%d] - unexpected error, expected=%T, got=%t\n", i, ErrPerformed, errors.Unwrap(err))
-				}
-			}
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+
+		rev, err := ImportSQLFile(path, "Andrew")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if rev.ID != test.id {
+			t.Errorf("tests[%d] - unexpected id, expected=%q, got=%q\n", i, test.id, rev.ID)
+		}
+
+		if rev.Comment != test.comment {
+			t.Errorf("tests[%d] - unexpected comment, expected=%q, got=%q\n", i, test.comment, rev.Comment)
+		}
+
+		if rev.Author != "Andrew" {
+			t.Errorf("tests[%d] - unexpected author, expected=%q, got=%q\n", i, "Andrew", rev.Author)
+		}
+
+		if rev.SQL != "CREATE TABLE users ( id INT );" {
+			t.Errorf("tests[%d] - unexpected sql, expected=%q, got=%q\n", i, "CREATE TABLE users ( id INT );", rev.SQL)
 		}
 	}
+}
 
-	revs, err := GetRevisions(db, -1)
+func Test_OpenRevisionGzip(t *testing.T) {
+	f, err := ioutil.TempFile("", "mgrt-rev-*.sql.gz")
 
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	if len(revs) != len(tests) {
-		t.Fatalf("unexpected revision count, expected=%d, got=%d\n", len(tests), len(revs))
+	defer os.Remove(f.Name())
+
+	rev := &Revision{ID: "20060102150405", Author: "Andrew", Comment: "Seed users", SQL: "INSERT INTO users VALUES (1);"}
+
+	zw := gzip.NewWriter(f)
+
+	if err := MarshalRevision(zw, rev); err != nil {
+		t.Fatal(err)
+	}
+
+	zw.Close()
+	f.Close()
+
+	rev2, err := OpenRevision(f.Name())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if *rev2 != *rev {
+		t.Errorf("unexpected revision, expected=%+v, got=%+v\n", *rev, *rev2)
+	}
+}
+
+func Test_OpenRevisionLazy(t *testing.T) {
+	rev := &Revision{ID: "20060102150405", Category: "users", Author: "Andrew", Comment: "Seed users", SQL: "INSERT INTO users VALUES (1);"}
+
+	for _, compress := range []bool{false, true} {
+		f, err := ioutil.TempFile("", "mgrt-rev-*.sql")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer os.Remove(f.Name())
+
+		var w io.WriteCloser = f
+
+		if compress {
+			w = gzip.NewWriter(f)
+		}
+
+		if err := MarshalRevision(w, rev); err != nil {
+			t.Fatal(err)
+		}
+
+		w.Close()
+		f.Close()
+
+		lazy, err := OpenRevisionLazy(f.Name())
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if lazy.SQL != "" {
+			t.Fatalf("expected sql to not be loaded, got=%q\n", lazy.SQL)
+		}
+
+		if lazy.Slug() != rev.Slug() || lazy.Author != rev.Author || lazy.Comment != rev.Comment {
+			t.Fatalf("unexpected revision, expected=%+v, got=%+v\n", *rev, *lazy)
+		}
+
+		if err := lazy.Validate(); err != nil {
+			t.Fatalf("unexpected error validating unloaded revision: %s\n", err)
+		}
+
+		if err := lazy.EnsureLoaded(); err != nil {
+			t.Fatal(err)
+		}
+
+		if *lazy != *rev {
+			t.Fatalf("unexpected revision, expected=%+v, got=%+v\n", *rev, *lazy)
+		}
+	}
+}
+
+func Test_ValidateDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mgrt-revisions-*")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"20060102150405.sql":       "/*\nRevision: 20060102150405\nAuthor:   Andrew\n*/\n\nCREATE TABLE users ( id INT NOT NULL UNIQUE );",
+		"perms/20060102150405.sql": "/*\nRevision: perms/20060102150405\nAuthor:   Andrew\n*/\n\nGRANT SELECT ON users TO app;",
+		"20060102150406.sql":       "CREATE TABLE posts ( id INT NOT NULL UNIQUE );",
+		"20060102150407.sql":       "/*\nRevision: 20060102150407\n*/\n\nCREATE TABLE tags ( id INT NOT NULL UNIQUE );",
+		"20060102150408.sql":       "/*\nRevision: 20060102150405\nAuthor:   Andrew\n*/\n\nCREATE TABLE users ( id INT NOT NULL UNIQUE );",
+	}
+
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+
+		if err := os.MkdirAll(filepath.Dir(path), os.FileMode(0755)); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := ioutil.WriteFile(path, []byte(content), os.FileMode(0644)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	errs := ValidateDir(dir)
+
+	expected := map[string]error{
+		"20060102150406.sql": ErrInvalid,
+		"20060102150407.sql": nil,
+		"20060102150408.sql": ErrDuplicate,
+	}
+
+	if len(errs) != len(expected) {
+		t.Fatalf("unexpected error count, expected=%d, got=%d %v\n", len(expected), len(errs), errs)
+	}
+
+	for _, err := range errs {
+		var rerr *RevisionError
+
+		if !errors.As(err, &rerr) {
+			t.Fatalf("unexpected error, expected=%T, got=%T\n", rerr, err)
+		}
+
+		name := filepath.Base(rerr.Path)
+
+		target, ok := expected[name]
+
+		if !ok {
+			t.Errorf("unexpected error for %s: %s\n", name, err)
+			continue
+		}
+
+		if target != nil && !errors.Is(err, target) {
+			t.Errorf("unexpected error for %s, expected=%q, got=%q\n", name, target, err)
+		}
+	}
+
+	if errs := ValidateDir(filepath.Join(dir, "nonexistent")); len(errs) != 1 {
+		t.Errorf("expected error for nonexistent directory, got=%v\n", errs)
 	}
 }
@@ -0,0 +1,124 @@
+package mgrt
+
+import "strings"
+
+// splitStatements splits the given SQL into the individual statements that
+// are separated by a semicolon. Semicolons that appear within string literals,
+// quoted identifiers, comments, or dollar quoted strings, such as the body of
+// a PostgreSQL function, are not treated as separators. The given Type of the
+// *DB determines the dialect, for MySQL a backslash escapes a quote within a
+// string and # starts a comment, and for PostgreSQL, pgx, a backslash only
+// escapes a quote within an escape string, such as E'it\'s'. Each of the
+// returned statements is trimmed of whitespace and its terminating semicolon,
+// and empty statements are omitted.
+func splitStatements(typ, sql string) []string {
+	stmts := make([]string, 0)
+
+	add := func(stmt string) {
+		if stmt = strings.TrimSpace(stmt); stmt != "" {
+			stmts = append(stmts, stmt)
+		}
+	}
+
+	start := 0
+
+	for i := 0; i < len(sql); i++ {
+		switch c := sql[i]; c {
+		case '\'', '"', '`':
+			escapes := (typ == "mysql" && c != '`') || (typ == "pgx" && c == '\'' && isEscapeString(sql, i))
+
+			i = skipQuoted(sql, i, c, escapes)
+		case '#':
+			if typ == "mysql" {
+				i = skipUntil(sql, i+1, "\n")
+			}
+		case '-':
+			if strings.HasPrefix(sql[i:], "--") {
+				i = skipUntil(sql, i+2, "\n")
+			}
+		case '/':
+			if strings.HasPrefix(sql[i:], "/*") {
+				i = skipUntil(sql, i+2, "*/")
+			}
+		case '$':
+			if tag, ok := dollarTag(sql, i); ok {
+				i = skipUntil(sql, i+len(tag), tag)
+			}
+		case ';':
+			add(sql[start:i])
+			start = i + 1
+		}
+	}
+
+	add(sql[start:])
+	return stmts
+}
+
+// skipQuoted returns the position of the quote that closes the quoted string
+// opened at i. A quote can be escaped within the string by doubling it, or if
+// escapes is true, by preceding it with a backslash. If the string is not
+// closed, then the end of the given SQL is returned.
+func skipQuoted(sql string, i int, quote byte, escapes bool) int {
+	for i++; i < len(sql); i++ {
+		switch sql[i] {
+		case '\\':
+			if escapes {
+				i++
+			}
+		case quote:
+			if i+1 < len(sql) && sql[i+1] == quote {
+				i++
+				continue
+			}
+			return i
+		}
+	}
+	return len(sql)
+}
+
+// skipUntil returns the position of the last byte of the first occurrence of
+// the given delimiter in the SQL from position i onwards. If the delimiter
+// does not occur, then the end of the given SQL is returned.
+func skipUntil(sql string, i int, delim string) int {
+	j := strings.Index(sql[i:], delim)
+
+	if j < 0 {
+		return len(sql)
+	}
+	return i + j + len(delim) - 1
+}
+
+// dollarTag returns the tag of the dollar quoted string opened at i, such as
+// $$ or $body$. This returns false if a dollar quoted string is not opened at
+// i, for example if it is a positional parameter such as $1.
+func dollarTag(sql string, i int) (string, bool) {
+	if i > 0 && isIdent(sql[i-1]) {
+		return "", false
+	}
+
+	for j := i + 1; j < len(sql); j++ {
+		c := sql[j]
+
+		if c == '$' {
+			return sql[i : j+1], true
+		}
+
+		if !isIdent(c) || (j == i+1 && c >= '0' && c <= '9') {
+			return "", false
+		}
+	}
+	return "", false
+}
+
+// isEscapeString reports whether the string opened at i is a PostgreSQL escape
+// string, such as E'it\'s', where a backslash escapes the following character.
+func isEscapeString(sql string, i int) bool {
+	if i == 0 || (sql[i-1] != 'E' && sql[i-1] != 'e') {
+		return false
+	}
+	return i == 1 || !isIdent(sql[i-2])
+}
+
+func isIdent(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
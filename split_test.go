@@ -0,0 +1,142 @@
+package mgrt
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"testing"
+)
+
+func Test_SplitStatements(t *testing.T) {
+	tests := []struct {
+		typ      string
+		sql      string
+		expected []string
+	}{
+		{
+			"sqlite3",
+			"CREATE TABLE users ( id INT );\nCREATE TABLE posts ( id INT );",
+			[]string{"CREATE TABLE users ( id INT )", "CREATE TABLE posts ( id INT )"},
+		},
+		{
+			"sqlite3",
+			"INSERT INTO users VALUES ('a;b'), ('it''s;');; ",
+			[]string{"INSERT INTO users VALUES ('a;b'), ('it''s;')"},
+		},
+		{
+			"sqlite3",
+			"-- drop the users; table\nDROP TABLE users;\n/* and the posts; table */\nDROP TABLE posts",
+			[]string{"-- drop the users; table\nDROP TABLE users", "/* and the posts; table */\nDROP TABLE posts"},
+		},
+		{
+			"pgx",
+			`CREATE TABLE "a;b" ( id INT ); SELECT $1;`,
+			[]string{`CREATE TABLE "a;b" ( id INT )`, "SELECT $1"},
+		},
+		{
+			"pgx",
+			`DO $$
+BEGIN
+	CREATE TABLE users ( id INT );
+	CREATE TABLE posts ( id INT );
+END
+$$;
+CREATE FUNCTION one() RETURNS INT AS $body$ SELECT 1; $body$ LANGUAGE SQL;`,
+			[]string{
+				"DO $$\nBEGIN\n\tCREATE TABLE users ( id INT );\n\tCREATE TABLE posts ( id INT );\nEND\n$$",
+				"CREATE FUNCTION one() RETURNS INT AS $body$ SELECT 1; $body$ LANGUAGE SQL",
+			},
+		},
+		{
+			"sqlite3",
+			`INSERT INTO paths VALUES ('C:\'); DELETE FROM paths;`,
+			[]string{`INSERT INTO paths VALUES ('C:\')`, "DELETE FROM paths"},
+		},
+	}
+
+	for i, test := range tests {
+		stmts := splitStatements(test.typ, test.sql)
+
+		if !reflect.DeepEqual(stmts, test.expected) {
+			t.Errorf("tests[%d] - unexpected statements, expected=%q, got=%q\n", i, test.expected, stmts)
+		}
+	}
+}
+
+// execRecorder is an Execer that records the statements it is given, without
+// executing them.
+type execRecorder struct {
+	stmts []string
+}
+
+func (e *execRecorder) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	e.stmts = append(e.stmts, query)
+	return nil, nil
+}
+
+func (e *execRecorder) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return nil, nil
+}
+
+func (e *execRecorder) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return nil
+}
+
+func Test_MigratorSplitStatementsDialect(t *testing.T) {
+	tests := []struct {
+		typ      string
+		dsn      string
+		sql      string
+		expected []string
+	}{
+		{
+			"postgresql",
+			"host=localhost dbname=dev",
+			`INSERT INTO paths VALUES ('C:\'); INSERT INTO users VALUES (E'it\'s; fine');`,
+			[]string{`INSERT INTO paths VALUES ('C:\')`, `INSERT INTO users VALUES (E'it\'s; fine')`},
+		},
+		{
+			"postgresql",
+			"host=localhost dbname=dev",
+			"SELECT '#'; SELECT 1 # 2;",
+			[]string{"SELECT '#'", "SELECT 1 # 2"},
+		},
+		{
+			"mysql",
+			"root@/dev",
+			`INSERT INTO users VALUES ('it\'s;', "a\";b"); DELETE FROM users;`,
+			[]string{`INSERT INTO users VALUES ('it\'s;', "a\";b")`, "DELETE FROM users"},
+		},
+		{
+			"mysql",
+			"root@/dev",
+			"# drop the users; table\nDROP TABLE users; # and the posts; table\nDROP TABLE posts",
+			[]string{"# drop the users; table\nDROP TABLE users", "# and the posts; table\nDROP TABLE posts"},
+		},
+	}
+
+	for i, test := range tests {
+		db, err := OpenLazy(test.typ, test.dsn)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		m := Migrator{
+			DB:              db,
+			SplitStatements: true,
+		}
+
+		var e execRecorder
+
+		if err := m.execute(context.Background(), &e, &Revision{ID: "20060102150405", SQL: test.sql}); err != nil {
+			t.Fatal(err)
+		}
+
+		db.Close()
+
+		if !reflect.DeepEqual(e.stmts, test.expected) {
+			t.Errorf("tests[%d] - unexpected statements, expected=%q, got=%q\n", i, test.expected, e.stmts)
+		}
+	}
+}
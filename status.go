@@ -0,0 +1,116 @@
+package mgrt
+
+import "sync"
+
+// DefaultConcurrency is the number of databases queried at once by StatusAll
+// when no concurrency is given.
+const DefaultConcurrency = 8
+
+// DBItem is a database to get the status of via StatusAll.
+type DBItem struct {
+	Name string // Name identifies the database in its Status.
+	Type string // Type is the type of database, as given to Open.
+	DSN  string // DSN is the data source name of the database, as given to Open.
+}
+
+// Status is the status of the local revisions against a single database.
+type Status struct {
+	Name    string      // Name is the name of the DBItem the status is for.
+	Stats   Stats       // Stats are the stats of the revisions performed.
+	Pending []*Revision // Pending are the local revisions not yet performed.
+
+	// Err is the error that occurred when getting the status of the
+	// database, if any.
+	Err error
+}
+
+// StatusAll gets the status of the given local revisions against each of the
+// given databases. The databases are queried concurrently, at most the given
+// number at a time, or DefaultConcurrency if the concurrency is not positive.
+//
+// The returned statuses are in the same order as the given databases. An error
+// for one database does not stop the others from being queried, instead it is
+// set as the Err of its Status. An error is only returned if the local
+// revisions are invalid, such as if two of them have the same ID. Each database
+// is opened via OpenReadOnly, so nothing is written to it.
+func StatusAll(items []DBItem, local []*Revision, concurrency int) ([]Status, error) {
+	var c Collection
+
+	for _, rev := range local {
+		if err := c.Put(rev); err != nil {
+			return nil, err
+		}
+	}
+
+	if concurrency <= 0 {
+		concurrency = DefaultConcurrency
+	}
+
+	statuses := make([]Status, len(items))
+
+	queue := make(chan int)
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < concurrency && i < len(items); i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for j := range queue {
+				statuses[j] = getStatus(items[j], local)
+			}
+		}()
+	}
+
+	for i := range items {
+		queue <- i
+	}
+
+	close(queue)
+	wg.Wait()
+
+	return statuses, nil
+}
+
+// getStatus opens a read-only connection to the given database, and gets the
+// status of the local revisions against it. If the mgrt_revisions table does
+// not exist, then no revisions have been performed, so all of them are
+// pending.
+func getStatus(it DBItem, local []*Revision) Status {
+	st := Status{
+		Name: it.Name,
+	}
+
+	db, err := OpenReadOnly(it.Type, it.DSN)
+
+	if err != nil {
+		st.Err = err
+		return st
+	}
+
+	defer db.Close()
+
+	if st.Stats, err = RevisionStats(db); err != nil {
+		if !isNoTable(err) {
+			st.Err = err
+			return st
+		}
+
+		var c Collection
+
+		for _, rev := range local {
+			c.Put(rev)
+		}
+
+		st.Pending = c.Slice()
+		return st
+	}
+
+	if st.Pending, err = PendingRevisions(db, local); err != nil {
+		st.Err = err
+		return st
+	}
+	return st
+}
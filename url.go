@@ -0,0 +1,131 @@
+package mgrt
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"time"
+)
+
+// maxRevisionSize is the maximum size of a revision fetched via
+// OpenRevisionURL, both before and after it is decompressed.
+const maxRevisionSize = 10 << 20
+
+// revisionClient is the client used to fetch revisions via OpenRevisionURL.
+var revisionClient = &http.Client{
+	Timeout: 30 * time.Second,
+}
+
+// revisionContentTypes are the content types a revision fetched via
+// OpenRevisionURL can have. Anything else, such as an HTML error page, is not
+// treated as a revision.
+var revisionContentTypes = map[string]struct{}{
+	"text/plain":               {},
+	"text/x-sql":               {},
+	"application/sql":          {},
+	"application/x-sql":        {},
+	"application/octet-stream": {},
+	"application/gzip":         {},
+	"application/x-gzip":       {},
+}
+
+// ErrTooLarge is returned when a revision fetched via OpenRevisionURL exceeds
+// the maximum size of 10MB.
+var ErrTooLarge = errors.New("revision too large")
+
+// OpenRevisionURL fetches the revision at the given http or https URL, and
+// unmarshals it via UnmarshalRevision. This allows revisions to be published
+// as artifacts, and performed from there. Like OpenRevision, if the revision
+// is gzip compressed then it is decompressed.
+//
+// The revision must be fetched within 30 seconds, and cannot be larger than
+// 10MB, otherwise ErrTooLarge is returned. A response with a status other than
+// 200, or with a content type that is not plain text, SQL, or gzip, is an
+// error. The returned *RevisionError will contain the URL as its path.
+func OpenRevisionURL(url string) (*Revision, error) {
+	wrap := func(err error) error {
+		var rerr *RevisionError
+
+		if errors.As(err, &rerr) {
+			rerr.Path = url
+			return rerr
+		}
+		return &RevisionError{
+			Path: url,
+			Err:  err,
+		}
+	}
+
+	resp, err := revisionClient.Get(url)
+
+	if err != nil {
+		return nil, wrap(err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, wrap(errors.New("unexpected status " + resp.Status))
+	}
+
+	if typ := resp.Header.Get("Content-Type"); typ != "" {
+		mediatype, _, err := mime.ParseMediaType(typ)
+
+		if err != nil {
+			return nil, wrap(err)
+		}
+
+		if _, ok := revisionContentTypes[mediatype]; !ok {
+			return nil, wrap(errors.New("unexpected content type " + mediatype))
+		}
+	}
+
+	if resp.ContentLength > maxRevisionSize {
+		return nil, wrap(ErrTooLarge)
+	}
+
+	b, err := readAllLimit(resp.Body, maxRevisionSize)
+
+	if err != nil {
+		return nil, wrap(err)
+	}
+
+	if bytes.HasPrefix(b, gzipMagic) {
+		gr, err := gzip.NewReader(bytes.NewReader(b))
+
+		if err != nil {
+			return nil, wrap(err)
+		}
+
+		defer gr.Close()
+
+		if b, err = readAllLimit(gr, maxRevisionSize); err != nil {
+			return nil, wrap(err)
+		}
+	}
+
+	rev, err := UnmarshalRevision(bytes.NewReader(b))
+
+	if err != nil {
+		return nil, wrap(err)
+	}
+	return rev, nil
+}
+
+// readAllLimit reads from the given io.Reader until EOF. If more than the
+// given number of bytes are read, then ErrTooLarge is returned.
+func readAllLimit(r io.Reader, n int64) ([]byte, error) {
+	b, err := io.ReadAll(io.LimitReader(r, n+1))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(b)) > n {
+		return nil, ErrTooLarge
+	}
+	return b, nil
+}
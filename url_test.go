@@ -0,0 +1,102 @@
+package mgrt
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_OpenRevisionURL(t *testing.T) {
+	rev := &Revision{
+		ID:      "20060102150405",
+		Author:  "Andrew",
+		Comment: "Add users",
+		SQL:     "CREATE TABLE users ( id INT NOT NULL UNIQUE );",
+	}
+
+	var gz bytes.Buffer
+
+	zw := gzip.NewWriter(&gz)
+	rev.WriteTo(zw)
+	zw.Close()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/plain.sql", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		rev.WriteTo(w)
+	})
+	mux.HandleFunc("/compressed.sql.gz", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/gzip")
+		w.Write(gz.Bytes())
+	})
+	mux.HandleFunc("/html.sql", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<html></html>"))
+	})
+	mux.HandleFunc("/large.sql", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write(bytes.Repeat([]byte("-"), maxRevisionSize+1))
+	})
+	mux.HandleFunc("/slow.sql", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(time.Second)
+	})
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	for _, path := range []string{"/plain.sql", "/compressed.sql.gz"} {
+		rev2, err := OpenRevisionURL(srv.URL + path)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if rev2.ID != rev.ID || rev2.Comment != rev.Comment || rev2.SQL != rev.SQL {
+			t.Errorf("%s - unexpected revision, expected=%+v, got=%+v\n", path, *rev, *rev2)
+		}
+	}
+
+	tests := []struct {
+		path     string
+		contains string
+	}{
+		{"/missing.sql", "404 Not Found"},
+		{"/html.sql", "text/html"},
+		{"/large.sql", ErrTooLarge.Error()},
+	}
+
+	for i, test := range tests {
+		_, err := OpenRevisionURL(srv.URL + test.path)
+
+		if err == nil {
+			t.Errorf("tests[%d] - expected error for %s\n", i, test.path)
+			continue
+		}
+
+		var rerr *RevisionError
+
+		if !errors.As(err, &rerr) || rerr.Path != srv.URL+test.path {
+			t.Errorf("tests[%d] - expected *RevisionError with path %s, got=%q\n", i, srv.URL+test.path, err)
+		}
+
+		if !strings.Contains(err.Error(), test.contains) {
+			t.Errorf("tests[%d] - expected error to contain %q, got=%q\n", i, test.contains, err)
+		}
+	}
+
+	client := revisionClient
+	revisionClient = &http.Client{Timeout: 10 * time.Millisecond}
+
+	defer func() {
+		revisionClient = client
+	}()
+
+	if _, err := OpenRevisionURL(srv.URL + "/slow.sql"); err == nil {
+		t.Errorf("expected error for request that times out")
+	}
+}